@@ -2,13 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/control"
+	"ds/internal/pkg/logging"
+	"ds/internal/pkg/metrics"
 	"ds/internal/pkg/model"
+	"ds/internal/pkg/progress"
 	"ds/internal/pkg/repo"
-	"log"
+	"ds/internal/pkg/throttle"
+	"ds/internal/pkg/tracing"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"gopkg.in/yaml.v3"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,18 +35,68 @@ import (
 )
 
 var (
-	version    string
-	configPath string
+	version       string
+	configPath    string
+	metricsAddr   string
+	controlAddr   string
+	logFormat     string
+	logLevel      string
+	traceExporter string
+	traceFile     string
+	forceUnlock   bool
+	runID         string
+	onlyTables    []string
+	excludeTables []string
+
+	shutdownTracing = func(context.Context) error { return nil }
 )
 
-func main() {
-	log.SetFlags(0)
+// tableFunc shifts a single table from the source to the target database.
+type tableFunc func(context.Context, repo.Source, *pgxpool.Pool, checkpoint.Store, model.Table, model.Table, *progress.Tracker, *throttle.Pacer) (repo.Stats, error)
 
+func main() {
 	rootCmd := &cobra.Command{
-		Use:   "dshift",
-		Short: "Shift data from one from database to another",
+		Use:               "dshift",
+		Short:             "Shift data from one from database to another",
+		PersistentPreRunE: setup,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
 	}
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "absolute or relative path to the config file")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on (e.g. :9090)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log output format (text or json)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "minimum log level (debug, info, warn or error)")
+	rootCmd.PersistentFlags().StringVar(&traceExporter, "trace-exporter", "none", "where to send trace spans (none, otlp or file)")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "path to write trace spans to when using the file exporter")
+
+	insertCmd := &cobra.Command{
+		Use:   "insert",
+		Short: "Insert data from one database into another",
+		RunE:  runInsert,
+	}
+
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Bring the target database up-to-date with the source database",
+		RunE:  runUpdate,
+	}
+
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Replay a SQL dump, written by a sql target, into the target database",
+		RunE:  runApply,
+	}
+
+	for _, cmd := range []*cobra.Command{insertCmd, updateCmd, applyCmd} {
+		cmd.Flags().BoolVar(&forceUnlock, "force-unlock", false, "release locks held by other runs of the job before starting")
+		cmd.Flags().StringVar(&controlAddr, "control-addr", "", "address to serve the HTTP control API on (e.g. localhost:9091)")
+	}
+
+	plan := planCmd()
+	for _, cmd := range []*cobra.Command{insertCmd, updateCmd, applyCmd, plan} {
+		cmd.Flags().StringSliceVar(&onlyTables, "tables", nil, "only shift source tables matching these patterns (e.g. public.*,!*_tmp)")
+		cmd.Flags().StringSliceVar(&excludeTables, "exclude-tables", nil, "skip source tables matching any of these patterns")
+	}
 
 	rootCmd.AddCommand(
 		&cobra.Command{
@@ -35,106 +104,515 @@ func main() {
 			Short: "Print dshift version information",
 			Run:   runVersion,
 		},
-		&cobra.Command{
-			Use:   "insert",
-			Short: "Insert data from one database into another",
-			Run:   runInsert,
-		},
-		&cobra.Command{
-			Use:   "update",
-			Short: "Bring the target database up-to-date with the source database",
-			Run:   runUpdate,
-		},
+		insertCmd,
+		updateCmd,
+		applyCmd,
+		validateCmd(),
+		plan,
+		stateCmd(),
+		historyCmd(),
 	)
 
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	err := rootCmd.Execute()
+
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		slog.Error("error shutting down tracing", "error", shutdownErr)
+	}
+
+	if err != nil {
+		slog.Error("error running command", "error", err)
+		os.Exit(1)
+	}
+}
+
+// setup configures logging and tracing before any command runs.
+func setup(cmd *cobra.Command, args []string) error {
+	logger, err := logging.New(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		return err
 	}
+
+	// Tag every log line with an identifier for the run.
+	runID = logging.NewRunID()
+	slog.SetDefault(logger.With("run_id", runID))
+
+	if shutdownTracing, err = tracing.Setup(cmd.Context(), traceExporter, traceFile, version); err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+
+	return nil
 }
 
 func runVersion(cmd *cobra.Command, args []string) {
-	log.Println(version)
+	fmt.Println(version)
 }
 
-func runInsert(cmd *cobra.Command, args []string) {
-	if configPath == "" {
-		log.Fatalf("missing config argument")
+func runInsert(cmd *cobra.Command, args []string) error {
+	return run(cmd.Context(), "insert", false, repo.InsertTable)
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	return run(cmd.Context(), "update", true, repo.UpdateTable)
+}
+
+// runApply replays the statements of a sql source, using a tableFunc that's
+// chosen once the config is loaded.
+func runApply(cmd *cobra.Command, args []string) error {
+	return run(cmd.Context(), "apply", false, nil)
+}
+
+// run shifts each of the configured tables using the given function, resetting
+// their offsets first if required.
+func run(ctx context.Context, command string, reset bool, shiftTable tableFunc) (err error) {
+	ctx, span := otel.Tracer("ds").Start(ctx, command)
+	span.SetAttributes(attribute.String("run_id", runID))
+	defer func() {
+		if err != nil {
+			msg := logging.Redact(err.Error())
+			span.RecordError(errors.New(msg))
+			span.SetStatus(codes.Error, msg)
+		}
+		span.End()
+	}()
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
 	}
 
-	config := loadConfig()
+	if err = checkConfig(config, command); err != nil {
+		return err
+	}
 
-	sourceDB, err := sql.Open(config.Source.Driver, config.Source.URL)
+	hash, err := hashConfig()
+	if err != nil {
+		return err
+	}
+
+	if err = serveMetrics(); err != nil {
+		return err
+	}
+
+	// SQL sources hold statements rather than rows, so they're replayed by the
+	// apply function instead of being read, and file targets are written to by
+	// the export function, rather than connected to.
+	switch {
+	case command == "apply":
+		shiftTable = applyFrom(config.Source)
+	case config.Target.IsFile():
+		shiftTable = exportTo(config.Target, command == "update")
+	}
+
+	src, targetDB, disconnect, err := connect(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	if config, err = expandTables(ctx, config, command, src, targetDB); err != nil {
+		return err
+	}
+
+	store, err := checkpoint.New(ctx, config, targetDB)
 	if err != nil {
-		log.Fatalf("error connecting to source database: %v", err)
+		return fmt.Errorf("creating state store: %w", err)
+	}
+	defer store.Close()
+
+	// Lock the job's tables before touching their state, so concurrent runs of
+	// the job can't clobber each other's offsets.
+	tables := lo.Map(config.Source.Tables, func(t model.Table, _ int) string {
+		return t.Name
+	})
+
+	if forceUnlock {
+		slog.Warn("forcing unlock", "tables", tables)
+		if err = store.ForceUnlock(ctx, tables...); err != nil {
+			return fmt.Errorf("unlocking tables: %w", err)
+		}
 	}
-	defer sourceDB.Close()
 
-	targetDB, err := pgxpool.New(context.Background(), config.Target.URL)
+	ctx, lease, err := checkpoint.Acquire(ctx, store, runID, config.State.LockDuration(), tables...)
 	if err != nil {
-		log.Fatalf("error connecting to target database: %v", err)
+		return fmt.Errorf("locking tables: %w", err)
+	}
+	defer func() {
+		if releaseErr := lease.Release(context.WithoutCancel(ctx)); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	if err = store.Ensure(ctx, config.Source, reset); err != nil {
+		return fmt.Errorf("ensuring state table: %w", err)
+	}
+
+	// Record the run in the job's history, updating it once the run finishes.
+	record := checkpoint.Run{
+		ID:         runID,
+		Command:    command,
+		ConfigHash: hash,
+		Version:    version,
+		StartedAt:  time.Now(),
+		Status:     checkpoint.StatusRunning,
+	}
+	if err = store.RecordRun(ctx, record); err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+	defer func() {
+		ended := time.Now()
+		record.EndedAt = &ended
+		record.Status = checkpoint.StatusComplete
+		if err != nil {
+			record.Status = checkpoint.StatusFailed
+			record.Error = logging.Redact(err.Error())
+		}
+
+		// Record the outcome even if the run was cancelled.
+		if recordErr := store.RecordRun(context.WithoutCancel(ctx), record); recordErr != nil && err == nil {
+			err = fmt.Errorf("recording run: %w", recordErr)
+		}
+	}()
+
+	// Throttle and batch size settings can be changed during the run by
+	// editing the config file and sending the process a SIGHUP.
+	var pressure throttle.PressureFunc
+	if targetDB != nil {
+		pressure = repo.AdmissionPressure(targetDB)
 	}
-	defer targetDB.Close()
+	controller := throttle.New(config.Throttle, config.BatchSize, pressure)
+	defer reloadThrottle(controller)()
 
-	if err = repo.EnsureStateTable(targetDB, config.Target, false); err != nil {
-		log.Fatalf("error ensuring state table: %v", err)
+	// The run and its tables can also be paused, resumed, cancelled and
+	// re-throttled through the control API, if it's being served.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	live := control.NewRun(runID, command, cancel)
+	tableControls := make([]*control.Table, len(config.Source.Tables))
+	for i, sourceTable := range config.Source.Tables {
+		windows, err := config.WindowsFor(sourceTable)
+		if err != nil {
+			return fmt.Errorf("scheduling %s: %w", sourceTable.Name, err)
+		}
+		tableControls[i] = live.Add(sourceTable, controller.Pacer(sourceTable, windows))
+	}
+
+	if err = serveControl(live); err != nil {
+		return err
 	}
 
-	for _, sourceTable := range config.Source.Tables {
-		targetTable, err := config.Target.GetTargetTable(sourceTable.SourceName)
+	var cancelled []string
+	for i, sourceTable := range config.Source.Tables {
+		targetTable, err := config.Target.GetTargetTable(sourceTable)
 		if err != nil {
-			log.Fatalf("error getting target table: %v", err)
+			return fmt.Errorf("getting target table: %w", err)
 		}
 
-		if err = repo.InsertTable(sourceDB, targetDB, sourceTable, targetTable); err != nil {
-			log.Fatalf("error inserting %s -> %s: %v", sourceTable.Name, targetTable.Name, err)
+		table := tableControls[i]
+		stats, err := runTable(table.Start(ctx), src, targetDB, store, sourceTable, targetTable, table, shiftTable)
+		table.Finish(err)
+
+		record.Tables = append(record.Tables, checkpoint.TableRun{
+			Table:        sourceTable.Name,
+			RowsRead:     stats.RowsRead,
+			RowsWritten:  stats.RowsWritten,
+			RowsRejected: stats.RowsRejected,
+		})
+		if err != nil {
+			// Tables cancelled on their own are skipped, and the run carries
+			// on with the rest.
+			if table.Cancelled() && ctx.Err() == nil {
+				slog.Warn("table cancelled", "table", sourceTable.Name)
+				cancelled = append(cancelled, sourceTable.Name)
+				continue
+			}
+
+			// Report why the run was cancelled, e.g. because its lock was lost.
+			if ctx.Err() != nil {
+				err = context.Cause(ctx)
+			}
+			return fmt.Errorf("%s %s -> %s: %w", command, sourceTable.Name, targetTable.Name, err)
 		}
 	}
+
+	// The run isn't complete if any of its tables were skipped.
+	if len(cancelled) > 0 {
+		return fmt.Errorf("%w: %s", control.ErrCancelled, strings.Join(cancelled, ", "))
+	}
+
+	return nil
 }
 
-func runUpdate(cmd *cobra.Command, args []string) {
-	if configPath == "" {
-		log.Fatalf("missing config argument")
+// runTable shifts a single table using the given function, once its pacer
+// lets it start, reporting its progress to the control API, then advances the
+// target table's sequences past the rows it loaded.
+func runTable(ctx context.Context, src repo.Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, table *control.Table, shiftTable tableFunc) (repo.Stats, error) {
+	// Skip tables that were cancelled before they started.
+	if ctx.Err() != nil {
+		return repo.Stats{}, context.Cause(ctx)
 	}
 
-	config := loadConfig()
+	// Wait for a maintenance window, or to be resumed, before touching the
+	// table at all, so nothing, not even truncating it, happens outside of one.
+	pacer := table.Pacer()
+	if err := pacer.Open(ctx); err != nil {
+		return repo.Stats{}, fmt.Errorf("waiting for maintenance window for %s: %w", sourceTable.Name, err)
+	}
 
-	sourceDB, err := sql.Open(config.Source.Driver, config.Source.URL)
+	total, err := repo.EstimateRows(ctx, src, sourceTable)
 	if err != nil {
-		log.Fatalf("error connecting to source database: %v", err)
+		return repo.Stats{}, fmt.Errorf("estimating rows for %s: %w", sourceTable.Name, err)
+	}
+
+	tracker := progress.Start(sourceTable.Name, total)
+	defer tracker.Stop()
+
+	table.Track(tracker)
+	stats, err := shiftTable(ctx, src, targetDB, store, sourceTable, targetTable, tracker, pacer)
+	if err != nil || targetDB == nil {
+		return stats, err
+	}
+
+	// Rows are loaded with their values, rather than taking them from the
+	// target's sequences, so advance the sequences past them.
+	if err = repo.SyncSequences(ctx, src, targetDB, sourceTable, targetTable); err != nil {
+		return stats, fmt.Errorf("syncing sequences of %s: %w", targetTable.Name, err)
+	}
+
+	return stats, nil
+}
+
+// validateConfig checks the config for mistakes that can be found without
+// connecting to either database, including sources and targets that don't
+// support the given command, returning every problem it finds, one per line.
+func validateConfig(config model.Config, command string) error {
+	errs := []error{
+		config.Validate(command == "update"),
+		checkpoint.Validate(config),
+	}
+
+	// SQL sources can only be applied, and SQL files can hold upserts, so they
+	// also support update, unlike other file targets.
+	switch {
+	case command == "apply" && config.Source.Driver != model.DriverSQL:
+		errs = append(errs, fmt.Errorf("apply requires a %s source", model.DriverSQL))
+	case command != "apply" && config.Source.Driver == model.DriverSQL:
+		errs = append(errs, fmt.Errorf("%s sources only support apply", model.DriverSQL))
+	}
+
+	if config.Target.IsFile() && command != "insert" && (command != "update" || config.Target.Driver != model.DriverSQL) {
+		errs = append(errs, fmt.Errorf("%s targets don't support %s", config.Target.Driver, command))
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkConfig returns an error listing the config's problems on a single
+// line, if it has any.
+func checkConfig(config model.Config, command string) error {
+	if err := validateConfig(config, command); err != nil {
+		return fmt.Errorf("invalid config: %s", strings.ReplaceAll(err.Error(), "\n", "; "))
 	}
-	defer sourceDB.Close()
+	return nil
+}
 
-	targetDB, err := pgxpool.New(context.Background(), config.Target.URL)
+// expandTables expands the table patterns of the source and target, restricts
+// the source's tables to those selected by --tables and --exclude-tables, and
+// then validates the config again, now that all of its tables are known.
+func expandTables(ctx context.Context, config model.Config, command string, src repo.Source, targetDB *pgxpool.Pool) (model.Config, error) {
+	var err error
+	if config.Source, err = repo.ExpandSourceTables(ctx, src, config.Source); err != nil {
+		return model.Config{}, fmt.Errorf("expanding source tables: %w", err)
+	}
+
+	if config.Target.IsFile() {
+		config.Target, err = config.Target.ExpandTables(nil)
+	} else {
+		config.Target, err = repo.ExpandTargetTables(ctx, targetDB, config.Target)
+	}
 	if err != nil {
-		log.Fatalf("error connecting to target database: %v", err)
+		return model.Config{}, fmt.Errorf("expanding target tables: %w", err)
 	}
-	defer targetDB.Close()
 
-	if err = repo.EnsureStateTable(targetDB, config.Target, true); err != nil {
-		log.Fatalf("error ensuring state table: %v", err)
+	if config.Source, err = config.Source.SelectTables(onlyTables, excludeTables); err != nil {
+		return model.Config{}, fmt.Errorf("selecting tables: %w", err)
 	}
 
-	for _, sourceTable := range config.Source.Tables {
-		targetTable, err := config.Target.GetTargetTable(sourceTable.SourceName)
-		if err != nil {
-			log.Fatalf("error getting target table: %v", err)
+	// Target tables for source tables that weren't selected aren't needed.
+	config.Target.Tables = lo.Filter(config.Target.Tables, func(t model.Table, _ int) bool {
+		return lo.ContainsBy(config.Source.Tables, func(s model.Table) bool { return t.IsTargetOf(s.Name) })
+	})
+
+	if err = checkConfig(config, command); err != nil {
+		return model.Config{}, err
+	}
+
+	return config, nil
+}
+
+// connect opens the source and, unless it's a directory of files, the target
+// database, returning a function that closes them both. File sources are
+// parsed using the target's column types.
+func connect(ctx context.Context, config model.Config) (src repo.Source, targetDB *pgxpool.Pool, disconnect func(), err error) {
+	if !config.Target.IsFile() {
+		if targetDB, err = pgxpool.New(ctx, config.Target.URL); err != nil {
+			return nil, nil, nil, fmt.Errorf("connecting to target database: %w", err)
 		}
+	}
+
+	if config.Source.IsFile() {
+		src = repo.NewFileSource(config.Source, targetDB)
+		return src, targetDB, func() { closePool(targetDB) }, nil
+	}
+
+	sourceDB, err := sql.Open(config.Source.Driver, config.Source.URL)
+	if err != nil {
+		closePool(targetDB)
+		return nil, nil, nil, fmt.Errorf("connecting to source database: %w", err)
+	}
+
+	return repo.NewDBSource(sourceDB), targetDB, func() {
+		sourceDB.Close()
+		closePool(targetDB)
+	}, nil
+}
 
-		if err = repo.UpdateTable(sourceDB, targetDB, sourceTable, targetTable); err != nil {
-			log.Fatalf("error updating %s -> %s: %v", sourceTable.Name, targetTable.Name, err)
+func closePool(db *pgxpool.Pool) {
+	if db != nil {
+		db.Close()
+	}
+}
+
+// exportTo returns a tableFunc that exports tables to the files of the given
+// target, upserting rows into SQL files if required.
+func exportTo(target model.Database, upsert bool) tableFunc {
+	return func(ctx context.Context, src repo.Source, _ *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer) (repo.Stats, error) {
+		return repo.ExportTable(ctx, src, target, store, sourceTable, targetTable, upsert, tracker, pacer)
+	}
+}
+
+// applyFrom returns a tableFunc that replays the statements in the SQL files
+// of the given source.
+func applyFrom(dump model.Database) tableFunc {
+	return func(ctx context.Context, _ repo.Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer) (repo.Stats, error) {
+		return repo.ApplyTable(ctx, dump, targetDB, store, sourceTable, targetTable, tracker, pacer)
+	}
+}
+
+// reloadThrottle updates the controller's throttle and batch size settings
+// from the config file each time the process receives a SIGHUP, returning a
+// function that stops it. Invalid settings are logged and ignored.
+func reloadThrottle(controller *throttle.Controller) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+
+			config, err := loadConfig()
+			if err == nil {
+				err = errors.Join(append(config.Throttle.Validate(), config.BatchSize.Validate()...)...)
+			}
+			if err != nil {
+				slog.Error("error reloading throttle", "error", err)
+				continue
+			}
+
+			controller.Set(config.Throttle, config.BatchSize)
+			minRows, maxRows := config.BatchSize.Bounds()
+			slog.Info("throttle reloaded",
+				"rows_per_second", config.Throttle.RowsPerSecond,
+				"max_batch_latency", config.Throttle.MaxBatchLatency,
+				"admission_control", config.Throttle.AdmissionControl,
+				"max_delay", config.Throttle.DelayLimit(),
+				"auto_batch_size", config.BatchSize.Auto(),
+				"min_rows", minRows,
+				"max_rows", maxRows)
 		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func serveMetrics() error {
+	if metricsAddr == "" {
+		return nil
+	}
+
+	if err := metrics.Serve(metricsAddr); err != nil {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+
+	return nil
+}
+
+func serveControl(run *control.Run) error {
+	if controlAddr == "" {
+		return nil
 	}
+
+	if err := control.Serve(controlAddr, run); err != nil {
+		return fmt.Errorf("serving control API: %w", err)
+	}
+
+	slog.Info("serving control API", "addr", controlAddr)
+	return nil
 }
 
-func loadConfig() model.Config {
+func loadConfig() (model.Config, error) {
+	if configPath == "" {
+		return model.Config{}, fmt.Errorf("missing config argument")
+	}
+
 	f, err := os.Open(configPath)
 	if err != nil {
-		log.Fatalf("error opening config file: %v", err)
+		return model.Config{}, fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	// Expand environment variables before decoding, so they can be used in
+	// any value.
+	var node yaml.Node
+	if err = yaml.NewDecoder(f).Decode(&node); err != nil {
+		return model.Config{}, fmt.Errorf("reading config file: %w", err)
+	}
+	if err = model.ExpandEnv(&node, os.LookupEnv); err != nil {
+		return model.Config{}, fmt.Errorf("expanding config file: %w", err)
 	}
 
 	var c model.Config
-	if err = yaml.NewDecoder(f).Decode(&c); err != nil {
-		log.Fatalf("error reading config file: %v", err)
+	if err = node.Decode(&c); err != nil {
+		return model.Config{}, fmt.Errorf("reading config file: %w", err)
+	}
+
+	if c, err = c.ResolveSecrets(); err != nil {
+		return model.Config{}, fmt.Errorf("resolving secrets: %w", err)
+	}
+
+	// Keep the config's passwords out of logs and errors, even when they
+	// appear outside of a connection URL.
+	logging.AddSecrets(c.Secrets()...)
+
+	return c, nil
+}
+
+// hashConfig returns a SHA-256 hash of the config file, so runs can be tied to
+// the exact configuration they used.
+func hashConfig() (string, error) {
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("reading config file: %w", err)
 	}
-	return c
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var historyLimit int
+
+func historyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history [run-id]",
+		Short: "Show the job's previous runs, or the details of a single run",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runHistory,
+	}
+	cmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "maximum number of runs to show")
+
+	return cmd
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	return withState(cmd.Context(), false, nil, func(ctx context.Context, store checkpoint.Store) error {
+		if len(args) == 1 {
+			r, err := store.Run(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return printRun(r)
+		}
+
+		runs, err := store.Runs(ctx, historyLimit)
+		if err != nil {
+			return err
+		}
+		return printRuns(runs)
+	})
+}
+
+func printRuns(runs []checkpoint.Run) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tCOMMAND\tSTATUS\tSTARTED\tDURATION\tREAD\tWRITTEN\tREJECTED\tERROR")
+	for _, r := range runs {
+		total := r.Totals()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			r.ID, r.Command, r.Status, r.StartedAt.Format(time.RFC3339), r.Duration().Round(time.Second),
+			total.RowsRead, total.RowsWritten, total.RowsRejected, r.Error)
+	}
+	return w.Flush()
+}
+
+func printRun(r checkpoint.Run) error {
+	ended := "-"
+	if r.EndedAt != nil {
+		ended = r.EndedAt.Format(time.RFC3339)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%s\n", r.ID)
+	fmt.Fprintf(w, "Job:\t%s\n", r.Job)
+	fmt.Fprintf(w, "Command:\t%s\n", r.Command)
+	fmt.Fprintf(w, "Version:\t%s\n", r.Version)
+	fmt.Fprintf(w, "Config hash:\t%s\n", r.ConfigHash)
+	fmt.Fprintf(w, "Started:\t%s\n", r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Ended:\t%s\n", ended)
+	fmt.Fprintf(w, "Status:\t%s\n", r.Status)
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", r.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tREAD\tWRITTEN\tREJECTED")
+	for _, t := range r.Tables {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", t.Table, t.RowsRead, t.RowsWritten, t.RowsRejected)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,551 @@
+package checkpoint
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DBStore stores the offsets of a job's tables in a state table.
+type DBStore struct {
+	db     *pgxpool.Pool
+	owned  bool
+	schema string
+	name   string
+	table  string
+	runs   string
+	locks  string
+	job    string
+
+	locksOnce sync.Once
+	locksErr  error
+}
+
+// NewDBStore returns a DBStore that stores offsets for the configured job in
+// the configured state table of the given database.
+func NewDBStore(db *pgxpool.Pool, c model.Config) *DBStore {
+	return &DBStore{
+		db:     db,
+		schema: c.State.Schema,
+		name:   c.State.Name(),
+		table:  c.State.TableName(),
+		runs:   c.State.RunsTableName(),
+		locks:  c.State.LocksTableName(),
+		job:    c.JobName(),
+	}
+}
+
+// Ensure creates the state table and initialises it with zeros for each of
+// the migration tables.
+//
+// If reset is true, the offsets of tables that completed on their previous run
+// are reset, so they're shifted again from the start. Tables that were
+// interrupted resume from their last offset.
+func (s *DBStore) Ensure(ctx context.Context, d model.Database, reset bool) error {
+	if s.schema != "" {
+		if _, err := s.db.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", s.schema)); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+	}
+
+	// Create table if it doesn't exist.
+	tableStmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		"job" TEXT NOT NULL DEFAULT '',
+		"table_name" TEXT NOT NULL,
+		"current_offset" BIGINT NOT NULL DEFAULT 0,
+		"current_position" TEXT NOT NULL DEFAULT '',
+		"status" TEXT NOT NULL DEFAULT 'pending',
+		"updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY ("job", "table_name")
+	)`, s.table)
+	if _, err := s.db.Exec(ctx, tableStmt); err != nil {
+		return fmt.Errorf("creating table: %w", err)
+	}
+
+	if err := s.migrate(ctx); err != nil {
+		return fmt.Errorf("migrating table: %w", err)
+	}
+
+	// Create the run history table if it doesn't exist.
+	runsStmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		"id" TEXT PRIMARY KEY,
+		"job" TEXT NOT NULL,
+		"command" TEXT NOT NULL,
+		"config_hash" TEXT NOT NULL,
+		"version" TEXT NOT NULL,
+		"started_at" TIMESTAMPTZ NOT NULL,
+		"ended_at" TIMESTAMPTZ,
+		"status" TEXT NOT NULL,
+		"error" TEXT NOT NULL DEFAULT '',
+		"tables" JSONB NOT NULL DEFAULT '[]'
+	)`, s.runs)
+	if _, err := s.db.Exec(ctx, runsStmt); err != nil {
+		return fmt.Errorf("creating runs table: %w", err)
+	}
+
+	slog.Info("ensuring state table", "state_table", s.table, "job", s.job, "tables", len(d.Tables), "reset", reset)
+
+	// Add tables if they don't exist.
+	for _, table := range d.Tables {
+		rowStmt := fmt.Sprintf(`INSERT INTO %s (job, table_name) VALUES ($1, $2)
+								ON CONFLICT DO NOTHING`, s.table)
+
+		if _, err := s.db.Exec(ctx, rowStmt, s.job, table.Name); err != nil {
+			return fmt.Errorf("initialising table state: %w", err)
+		}
+
+		if !reset {
+			continue
+		}
+
+		resetStmt := fmt.Sprintf(`UPDATE %s SET current_offset = 0, current_position = '', status = $1, updated_at = now()
+									WHERE job = $2 AND table_name = $3 AND status = $4`, s.table)
+		if _, err := s.db.Exec(ctx, resetStmt, StatusPending, s.job, table.Name, StatusComplete); err != nil {
+			return fmt.Errorf("resetting table state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// migrate brings state tables created by earlier versions up-to-date, adding
+// the status, updated_at and current_position columns and keying rows by job.
+func (s *DBStore) migrate(ctx context.Context) error {
+	columnStmts := []string{
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS "status" TEXT NOT NULL DEFAULT 'pending'`, s.table),
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now()`, s.table),
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS "current_position" TEXT NOT NULL DEFAULT ''`, s.table),
+	}
+	for _, stmt := range columnStmts {
+		if _, err := s.db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("adding column: %w", err)
+		}
+	}
+
+	key, constraint, err := s.primaryKey(ctx)
+	if err != nil {
+		return fmt.Errorf("checking primary key: %w", err)
+	}
+
+	if slices.Equal(key, []string{"job", "table_name"}) {
+		return nil
+	}
+
+	var version string
+	if err = s.db.QueryRow(ctx, "SELECT version()").Scan(&version); err != nil {
+		return fmt.Errorf("checking database version: %w", err)
+	}
+
+	// CockroachDB can't change a primary key in a transaction that's also
+	// written to the table, so its steps are run one at a time. Each of them
+	// can be repeated, so an interrupted migration is finished by the next run.
+	if strings.Contains(version, "CockroachDB") {
+		rekeyStmt := fmt.Sprintf(`ALTER TABLE %s ALTER PRIMARY KEY USING COLUMNS ("job", "table_name")`, s.table)
+		return keyByJob(ctx, s.db, s.table, rekeyStmt)
+	}
+
+	rekeyStmt := fmt.Sprintf(`ALTER TABLE %s ADD PRIMARY KEY ("job", "table_name")`, s.table)
+	if constraint != "" {
+		rekeyStmt = fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s, ADD PRIMARY KEY ("job", "table_name")`,
+			s.table, pgx.Identifier{constraint}.Sanitize())
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = keyByJob(ctx, tx, s.table, rekeyStmt); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// primaryKey returns the columns of the state table's primary key, in order,
+// along with the name of its constraint.
+func (s *DBStore) primaryKey(ctx context.Context) ([]string, string, error) {
+	const stmt = `SELECT tc.constraint_name, kcu.column_name
+								FROM information_schema.table_constraints tc
+								JOIN information_schema.key_column_usage kcu
+									ON kcu.constraint_schema = tc.constraint_schema
+									AND kcu.constraint_name = tc.constraint_name
+									AND kcu.table_name = tc.table_name
+								WHERE tc.constraint_type = 'PRIMARY KEY'
+								AND tc.table_schema = coalesce(nullif($1, ''), current_schema())
+								AND tc.table_name = $2
+								ORDER BY kcu.ordinal_position`
+
+	rows, err := s.db.Query(ctx, stmt, s.schema, s.name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var columns []string
+	var constraint string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&constraint, &column); err != nil {
+			return nil, "", err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, constraint, rows.Err()
+}
+
+// execer executes statements against a database or in a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// keyByJob adds the job column to a state table, assigns the rows written
+// before jobs existed to the default job, and then re-keys the table by job
+// with the given statement.
+func keyByJob(ctx context.Context, db execer, table, rekeyStmt string) error {
+	if _, err := db.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS "job" TEXT NOT NULL DEFAULT ''`, table)); err != nil {
+		return fmt.Errorf("adding job column: %w", err)
+	}
+
+	if _, err := db.Exec(ctx, fmt.Sprintf(`UPDATE %s SET job = $1 WHERE job = ''`, table), model.DefaultJob); err != nil {
+		return fmt.Errorf("assigning default job: %w", err)
+	}
+
+	if _, err := db.Exec(ctx, rekeyStmt); err != nil {
+		return fmt.Errorf("keying rows by job: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the state of the given tables, or of every table if none are
+// provided.
+func (s *DBStore) List(ctx context.Context, tables ...string) ([]TableState, error) {
+	stmt := fmt.Sprintf(`SELECT table_name, current_offset, current_position, status, updated_at FROM %s WHERE job = $1`, s.table)
+	args := []any{s.job}
+
+	if len(tables) > 0 {
+		stmt += ` AND table_name = ANY($2)`
+		args = append(args, tables)
+	}
+	stmt += ` ORDER BY table_name`
+
+	rows, err := s.db.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying state: %w", err)
+	}
+
+	states, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (TableState, error) {
+		var ts TableState
+		err := row.Scan(&ts.Table, &ts.Offset, &ts.Position, &ts.Status, &ts.UpdatedAt)
+		return ts, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning state: %w", err)
+	}
+
+	return states, nil
+}
+
+// Reset resets the offsets of the given tables to zero, or of every table if
+// none are provided.
+func (s *DBStore) Reset(ctx context.Context, tables ...string) error {
+	stmt := fmt.Sprintf(`UPDATE %s SET current_offset = 0, current_position = '', status = $1, updated_at = now() WHERE job = $2`, s.table)
+	args := []any{StatusPending, s.job}
+
+	if len(tables) > 0 {
+		stmt += ` AND table_name = ANY($3)`
+		args = append(args, tables)
+	}
+
+	if _, err := s.db.Exec(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("resetting state: %w", err)
+	}
+
+	return nil
+}
+
+// Set sets the offset of a table, so the next run resumes from there.
+func (s *DBStore) Set(ctx context.Context, table string, offset int) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid offset: %d", offset)
+	}
+
+	stmt := fmt.Sprintf(`UPDATE %s SET current_offset = $1, current_position = '', status = $2, updated_at = now()
+								WHERE job = $3 AND table_name = $4`, s.table)
+
+	tag, err := s.db.Exec(ctx, stmt, offset, StatusPending, s.job, table)
+	if err != nil {
+		return fmt.Errorf("setting state: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("missing state for %s", table)
+	}
+
+	return nil
+}
+
+// Offset returns the current_offset for a given table.
+func (s *DBStore) Offset(ctx context.Context, table string) (int, error) {
+	stmt := fmt.Sprintf(`SELECT current_offset FROM %s WHERE job = $1 AND table_name = $2`, s.table)
+
+	row := s.db.QueryRow(ctx, stmt, s.job, table)
+
+	var offset int
+	if err := row.Scan(&offset); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("missing state for %s", table)
+		}
+		return 0, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return offset, nil
+}
+
+// Position returns the current_position for a given table.
+func (s *DBStore) Position(ctx context.Context, table string) (string, error) {
+	stmt := fmt.Sprintf(`SELECT current_position FROM %s WHERE job = $1 AND table_name = $2`, s.table)
+
+	row := s.db.QueryRow(ctx, stmt, s.job, table)
+
+	var position string
+	if err := row.Scan(&position); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("missing state for %s", table)
+		}
+		return "", fmt.Errorf("scanning row: %w", err)
+	}
+
+	return position, nil
+}
+
+// Checkpoint sets the current_offset for a given table.
+func (s *DBStore) Checkpoint(ctx context.Context, table string, offset int) error {
+	return s.CheckpointPosition(ctx, table, offset, "")
+}
+
+// CheckpointPosition sets the current_offset and current_position for a given
+// table.
+func (s *DBStore) CheckpointPosition(ctx context.Context, table string, offset int, position string) error {
+	stmt := fmt.Sprintf(`UPDATE %s SET current_offset = $1, current_position = $2, updated_at = now()
+								WHERE job = $3 AND table_name = $4`, s.table)
+
+	if _, err := s.db.Exec(ctx, stmt, offset, position, s.job, table); err != nil {
+		return fmt.Errorf("updating offset: %w", err)
+	}
+
+	return nil
+}
+
+// SetStatus sets the status for a given table.
+func (s *DBStore) SetStatus(ctx context.Context, table, status string) error {
+	stmt := fmt.Sprintf(`UPDATE %s SET status = $1, updated_at = now() WHERE job = $2 AND table_name = $3`, s.table)
+
+	if _, err := s.db.Exec(ctx, stmt, status, s.job, table); err != nil {
+		return fmt.Errorf("updating status: %w", err)
+	}
+
+	return nil
+}
+
+// RecordRun inserts or updates a run in the runs table.
+func (s *DBStore) RecordRun(ctx context.Context, r Run) error {
+	tables, err := json.Marshal(r.Tables)
+	if err != nil {
+		return fmt.Errorf("encoding tables: %w", err)
+	}
+
+	stmt := fmt.Sprintf(`INSERT INTO %s (id, job, command, config_hash, version, started_at, ended_at, status, error, tables)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::JSONB)
+								ON CONFLICT (id) DO UPDATE SET
+									ended_at = excluded.ended_at,
+									status = excluded.status,
+									error = excluded.error,
+									tables = excluded.tables`, s.runs)
+
+	if _, err = s.db.Exec(ctx, stmt, r.ID, s.job, r.Command, r.ConfigHash, r.Version, r.StartedAt, r.EndedAt, r.Status, r.Error, string(tables)); err != nil {
+		return fmt.Errorf("recording run: %w", err)
+	}
+
+	return nil
+}
+
+// Runs returns up to limit of the job's most recent runs, newest first.
+func (s *DBStore) Runs(ctx context.Context, limit int) ([]Run, error) {
+	stmt := fmt.Sprintf(`SELECT %s FROM %s WHERE job = $1 ORDER BY started_at DESC LIMIT $2`, runColumns, s.runs)
+
+	rows, err := s.db.Query(ctx, stmt, s.job, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %w", err)
+	}
+
+	runs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Run, error) {
+		return scanRun(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// Run returns the run with the given id.
+func (s *DBStore) Run(ctx context.Context, id string) (Run, error) {
+	stmt := fmt.Sprintf(`SELECT %s FROM %s WHERE job = $1 AND id = $2`, runColumns, s.runs)
+
+	r, err := scanRun(s.db.QueryRow(ctx, stmt, s.job, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Run{}, fmt.Errorf("missing run %s", id)
+		}
+		return Run{}, fmt.Errorf("scanning run: %w", err)
+	}
+
+	return r, nil
+}
+
+// runColumns are the columns of the runs table, in the order scanned by scanRun.
+const runColumns = `id, job, command, config_hash, version, started_at, ended_at, status, error, tables`
+
+func scanRun(row pgx.Row) (Run, error) {
+	var r Run
+	err := row.Scan(&r.ID, &r.Job, &r.Command, &r.ConfigHash, &r.Version, &r.StartedAt, &r.EndedAt, &r.Status, &r.Error, &r.Tables)
+	return r, err
+}
+
+// Lock acquires, or renews, owner's locks on the given tables in one
+// transaction, so either every table is locked or none are.
+func (s *DBStore) Lock(ctx context.Context, owner string, ttl time.Duration, tables ...string) error {
+	if err := s.ensureLocks(ctx); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Take the lock if it's free, expired or already ours.
+	lockStmt := fmt.Sprintf(`INSERT INTO %s AS l (job, table_name, owner, expires_at)
+								VALUES ($1, $2, $3, now() + $4 * INTERVAL '1 millisecond')
+								ON CONFLICT (job, table_name) DO UPDATE SET
+									owner = excluded.owner,
+									expires_at = excluded.expires_at
+								WHERE l.owner = excluded.owner OR l.expires_at < now()`, s.locks)
+
+	holderStmt := fmt.Sprintf(`SELECT owner, expires_at FROM %s WHERE job = $1 AND table_name = $2`, s.locks)
+
+	for _, table := range tables {
+		tag, err := tx.Exec(ctx, lockStmt, s.job, table, owner, ttl.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("locking %s: %w", table, err)
+		}
+
+		if tag.RowsAffected() > 0 {
+			continue
+		}
+
+		lockErr := &LockError{Table: table}
+		if err = tx.QueryRow(ctx, holderStmt, s.job, table).Scan(&lockErr.Owner, &lockErr.ExpiresAt); err != nil {
+			return fmt.Errorf("fetching lock holder: %w", err)
+		}
+		return lockErr
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Unlock releases owner's locks on the given tables.
+func (s *DBStore) Unlock(ctx context.Context, owner string, tables ...string) error {
+	if err := s.ensureLocks(ctx); err != nil {
+		return err
+	}
+
+	stmt := fmt.Sprintf(`DELETE FROM %s WHERE job = $1 AND owner = $2 AND table_name = ANY($3)`, s.locks)
+
+	if _, err := s.db.Exec(ctx, stmt, s.job, owner, tables); err != nil {
+		return fmt.Errorf("unlocking: %w", err)
+	}
+
+	return nil
+}
+
+// ForceUnlock releases the locks on the given tables, or on every table if
+// none are provided, regardless of who holds them.
+func (s *DBStore) ForceUnlock(ctx context.Context, tables ...string) error {
+	if err := s.ensureLocks(ctx); err != nil {
+		return err
+	}
+
+	stmt := fmt.Sprintf(`DELETE FROM %s WHERE job = $1`, s.locks)
+	args := []any{s.job}
+
+	if len(tables) > 0 {
+		stmt += ` AND table_name = ANY($2)`
+		args = append(args, tables)
+	}
+
+	if _, err := s.db.Exec(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("force unlocking: %w", err)
+	}
+
+	return nil
+}
+
+// ensureLocks creates the lock table the first time it's needed. It can't be
+// created by Ensure, as locks are taken before Ensure runs to stop concurrent
+// runs resetting each other's offsets.
+func (s *DBStore) ensureLocks(ctx context.Context) error {
+	s.locksOnce.Do(func() {
+		if s.schema != "" {
+			if _, err := s.db.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", s.schema)); err != nil {
+				s.locksErr = fmt.Errorf("creating schema: %w", err)
+				return
+			}
+		}
+
+		stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			"job" TEXT NOT NULL,
+			"table_name" TEXT NOT NULL,
+			"owner" TEXT NOT NULL,
+			"expires_at" TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY ("job", "table_name")
+		)`, s.locks)
+		if _, err := s.db.Exec(ctx, stmt); err != nil {
+			s.locksErr = fmt.Errorf("creating lock table: %w", err)
+		}
+	})
+
+	return s.locksErr
+}
+
+// Close closes the state database, if the store opened it.
+func (s *DBStore) Close() error {
+	if s.owned {
+		s.db.Close()
+	}
+	return nil
+}
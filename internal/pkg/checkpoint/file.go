@@ -0,0 +1,510 @@
+package checkpoint
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// FileStore stores the offsets of a job's tables in a local JSON file, for
+// targets that can't (or mustn't) hold a state table. The file holds the
+// state of every job that uses it, keyed by job and then by table.
+//
+// Run history is appended to a newline-delimited JSON file alongside it, named
+// after the state file with a _runs.jsonl suffix, and locks are held in a
+// _locks.json file. Locks only protect against runs that share these files.
+//
+// Every change to the files is made whilst holding an exclusive lock on a .lock
+// file alongside them, so separate ds processes sharing the files don't
+// overwrite each other's changes. The files should be on a local filesystem,
+// as advisory locks aren't reliable over network filesystems.
+type FileStore struct {
+	mu        sync.Mutex
+	path      string
+	runsPath  string
+	locksPath string
+	lockPath  string
+	job       string
+}
+
+// fileState is the layout of the file.
+type fileState map[string]map[string]TableState
+
+// fileLock is a table's lock, as held in the locks file, which is keyed by job
+// and then by table.
+type fileLock struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileStore returns a FileStore that stores offsets for the given job in
+// the file at path, which is created if it doesn't exist.
+func NewFileStore(path, job string) *FileStore {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+
+	return &FileStore{
+		path:      path,
+		runsPath:  base + "_runs.jsonl",
+		locksPath: base + "_locks.json",
+		lockPath:  base + ".lock",
+		job:       job,
+	}
+}
+
+// Ensure initialises state for each of the migration tables.
+//
+// If reset is true, the offsets of tables that completed on their previous run
+// are reset, so they're shifted again from the start. Tables that were
+// interrupted resume from their last offset.
+func (s *FileStore) Ensure(ctx context.Context, d model.Database, reset bool) error {
+	return s.update(func(tables map[string]TableState) error {
+		for _, table := range d.Tables {
+			ts, ok := tables[table.Name]
+			if !ok {
+				tables[table.Name] = TableState{Status: StatusPending, UpdatedAt: time.Now()}
+				continue
+			}
+
+			if reset && ts.Status == StatusComplete {
+				tables[table.Name] = TableState{Status: StatusPending, UpdatedAt: time.Now()}
+			}
+		}
+		return nil
+	})
+}
+
+// List returns the state of the given tables, or of every table if none are
+// provided.
+func (s *FileStore) List(ctx context.Context, tables ...string) ([]TableState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []TableState
+	for name, ts := range state[s.job] {
+		if len(tables) > 0 && !lo.Contains(tables, name) {
+			continue
+		}
+
+		ts.Table = name
+		states = append(states, ts)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Table < states[j].Table
+	})
+
+	return states, nil
+}
+
+// Reset resets the offsets of the given tables to zero, or of every table if
+// none are provided.
+func (s *FileStore) Reset(ctx context.Context, tables ...string) error {
+	return s.update(func(state map[string]TableState) error {
+		for name := range state {
+			if len(tables) > 0 && !lo.Contains(tables, name) {
+				continue
+			}
+			state[name] = TableState{Status: StatusPending, UpdatedAt: time.Now()}
+		}
+		return nil
+	})
+}
+
+// Set sets the offset of a table, so the next run resumes from there.
+func (s *FileStore) Set(ctx context.Context, table string, offset int) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid offset: %d", offset)
+	}
+
+	return s.update(func(state map[string]TableState) error {
+		if _, ok := state[table]; !ok {
+			return fmt.Errorf("missing state for %s", table)
+		}
+
+		state[table] = TableState{Offset: offset, Status: StatusPending, UpdatedAt: time.Now()}
+		return nil
+	})
+}
+
+// Offset returns the current offset for a given table.
+func (s *FileStore) Offset(ctx context.Context, table string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+
+	ts, ok := state[s.job][table]
+	if !ok {
+		return 0, fmt.Errorf("missing state for %s", table)
+	}
+
+	return ts.Offset, nil
+}
+
+// Position returns the source file position for a given table.
+func (s *FileStore) Position(ctx context.Context, table string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	ts, ok := state[s.job][table]
+	if !ok {
+		return "", fmt.Errorf("missing state for %s", table)
+	}
+
+	return ts.Position, nil
+}
+
+// Checkpoint sets the current offset for a given table.
+func (s *FileStore) Checkpoint(ctx context.Context, table string, offset int) error {
+	return s.CheckpointPosition(ctx, table, offset, "")
+}
+
+// CheckpointPosition sets the current offset and source file position for a
+// given table.
+func (s *FileStore) CheckpointPosition(ctx context.Context, table string, offset int, position string) error {
+	return s.update(func(state map[string]TableState) error {
+		ts := state[table]
+		ts.Offset = offset
+		ts.Position = position
+		ts.UpdatedAt = time.Now()
+		state[table] = ts
+		return nil
+	})
+}
+
+// SetStatus sets the status for a given table.
+func (s *FileStore) SetStatus(ctx context.Context, table, status string) error {
+	return s.update(func(state map[string]TableState) error {
+		ts := state[table]
+		ts.Status = status
+		ts.UpdatedAt = time.Now()
+		state[table] = ts
+		return nil
+	})
+}
+
+// RecordRun appends the run to the runs file. Later records of a run supersede
+// earlier ones, so the file is only ever appended to.
+func (s *FileStore) RecordRun(ctx context.Context, r Run) error {
+	r.Job = s.job
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding run: %w", err)
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(s.runsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening runs file: %w", err)
+	}
+
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing runs file: %w", err)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing runs file: %w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("closing runs file: %w", err)
+	}
+
+	return nil
+}
+
+// Runs returns up to limit of the job's most recent runs, newest first.
+func (s *FileStore) Runs(ctx context.Context, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs, err := s.readRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
+
+// Run returns the run with the given id.
+func (s *FileStore) Run(ctx context.Context, id string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs, err := s.readRuns()
+	if err != nil {
+		return Run{}, err
+	}
+
+	r, ok := lo.Find(runs, func(r Run) bool { return r.ID == id })
+	if !ok {
+		return Run{}, fmt.Errorf("missing run %s", id)
+	}
+
+	return r, nil
+}
+
+// Lock acquires, or renews, owner's locks on the given tables. Either every
+// table is locked or none are.
+func (s *FileStore) Lock(ctx context.Context, owner string, ttl time.Duration, tables ...string) error {
+	return s.updateLocks(func(locks map[string]fileLock) error {
+		now := time.Now()
+		for _, table := range tables {
+			lock, ok := locks[table]
+			if ok && lock.Owner != owner && lock.ExpiresAt.After(now) {
+				return &LockError{Table: table, Owner: lock.Owner, ExpiresAt: lock.ExpiresAt}
+			}
+		}
+
+		for _, table := range tables {
+			locks[table] = fileLock{Owner: owner, ExpiresAt: now.Add(ttl)}
+		}
+		return nil
+	})
+}
+
+// Unlock releases owner's locks on the given tables.
+func (s *FileStore) Unlock(ctx context.Context, owner string, tables ...string) error {
+	return s.updateLocks(func(locks map[string]fileLock) error {
+		for _, table := range tables {
+			if locks[table].Owner == owner {
+				delete(locks, table)
+			}
+		}
+		return nil
+	})
+}
+
+// ForceUnlock releases the locks on the given tables, or on every table if
+// none are provided, regardless of who holds them.
+func (s *FileStore) ForceUnlock(ctx context.Context, tables ...string) error {
+	return s.updateLocks(func(locks map[string]fileLock) error {
+		for table := range locks {
+			if len(tables) == 0 || lo.Contains(tables, table) {
+				delete(locks, table)
+			}
+		}
+		return nil
+	})
+}
+
+// Close is a no-op, as the file is only open whilst it's being read or written.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// update reads the file, applies fn to the job's tables and writes the file
+// back if fn succeeds.
+func (s *FileStore) update(fn func(map[string]TableState) error) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	tables, ok := state[s.job]
+	if !ok {
+		tables = map[string]TableState{}
+		state[s.job] = tables
+	}
+
+	if err = fn(tables); err != nil {
+		return err
+	}
+
+	return writeFile(s.path, state)
+}
+
+// updateLocks reads the locks file, applies fn to the job's locks and writes
+// the file back if fn succeeds.
+//
+// The file is read and written under the store's lock, so checking who holds a
+// table's lock and taking it can't be interleaved with another process doing
+// the same.
+func (s *FileStore) updateLocks(fn func(map[string]fileLock) error) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	all := map[string]map[string]fileLock{}
+	b, err := os.ReadFile(s.locksPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("reading locks file: %w", err)
+	default:
+		if err = json.Unmarshal(b, &all); err != nil {
+			return fmt.Errorf("parsing locks file: %w", err)
+		}
+	}
+
+	locks, ok := all[s.job]
+	if !ok {
+		locks = map[string]fileLock{}
+		all[s.job] = locks
+	}
+
+	if err = fn(locks); err != nil {
+		return err
+	}
+
+	return writeFile(s.locksPath, all)
+}
+
+// lock locks the store against other goroutines and, through its lock file,
+// other processes, returning a function that unlocks it again.
+func (s *FileStore) lock() (func(), error) {
+	s.mu.Lock()
+
+	f, err := lockFile(s.lockPath)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("locking state file: %w", err)
+	}
+
+	return func() {
+		f.Close()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *FileStore) read() (fileState, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	state := fileState{}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("parsing state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// readRuns returns the job's runs, newest first, keeping only the latest
+// record of each.
+func (s *FileStore) readRuns() ([]Run, error) {
+	f, err := os.Open(s.runsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening runs file: %w", err)
+	}
+	defer f.Close()
+
+	var runs []Run
+	indexes := map[string]int{}
+
+	dec := json.NewDecoder(f)
+	for {
+		var r Run
+		err := dec.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing runs file: %w", err)
+		}
+
+		if r.Job != s.job {
+			continue
+		}
+
+		if i, ok := indexes[r.ID]; ok {
+			runs[i] = r
+			continue
+		}
+
+		indexes[r.ID] = len(runs)
+		runs = append(runs, r)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
+
+// writeFile replaces the file at path atomically, so an interrupted write
+// never leaves it half-written.
+func writeFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing state file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("closing state file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing state file: %w", err)
+	}
+
+	return nil
+}
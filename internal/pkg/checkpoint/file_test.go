@@ -0,0 +1,240 @@
+package checkpoint
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	d := model.Database{
+		Tables: []model.Table{
+			{Name: "a"},
+			{Name: "b"},
+		},
+	}
+
+	s := NewFileStore(path, "job")
+	assert.Nil(t, s.Ensure(ctx, d, false))
+
+	assert.Nil(t, s.Checkpoint(ctx, "a", 10))
+	assert.Nil(t, s.SetStatus(ctx, "a", StatusComplete))
+	assert.Nil(t, s.Checkpoint(ctx, "b", 5))
+	assert.Nil(t, s.SetStatus(ctx, "b", StatusFailed))
+
+	offset, err := s.Offset(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, offset)
+
+	// Resetting on ensure only affects completed tables.
+	assert.Nil(t, NewFileStore(path, "job").Ensure(ctx, d, true))
+
+	states, err := s.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "a", states[0].Table)
+	assert.Equal(t, 0, states[0].Offset)
+	assert.Equal(t, StatusPending, states[0].Status)
+	assert.Equal(t, "b", states[1].Table)
+	assert.Equal(t, 5, states[1].Offset)
+	assert.Equal(t, StatusFailed, states[1].Status)
+}
+
+func TestFileStoreJobs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	d := model.Database{Tables: []model.Table{{Name: "a"}}}
+
+	s1 := NewFileStore(path, "job1")
+	s2 := NewFileStore(path, "job2")
+	assert.Nil(t, s1.Ensure(ctx, d, false))
+	assert.Nil(t, s2.Ensure(ctx, d, false))
+
+	assert.Nil(t, s1.Checkpoint(ctx, "a", 1))
+	assert.Nil(t, s2.Checkpoint(ctx, "a", 2))
+
+	offset, err := s1.Offset(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, offset)
+
+	offset, err = s2.Offset(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, offset)
+}
+
+func TestFileStoreConcurrentJobs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	d := model.Database{Tables: []model.Table{{Name: "a"}}}
+
+	// Separate stores stand in for separate processes sharing the file, so
+	// none of their changes should be lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		s := NewFileStore(path, fmt.Sprintf("job%d", i))
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, s.Ensure(ctx, d, false))
+			assert.Nil(t, s.Checkpoint(ctx, "a", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		offset, err := NewFileStore(path, fmt.Sprintf("job%d", i)).Offset(ctx, "a")
+		assert.Nil(t, err)
+		assert.Equal(t, i, offset)
+	}
+}
+
+func TestFileStoreSetAndReset(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+	assert.Nil(t, s.Ensure(ctx, model.Database{Tables: []model.Table{{Name: "a"}, {Name: "b"}}}, false))
+
+	assert.Nil(t, s.Set(ctx, "a", 100))
+	assert.Nil(t, s.Set(ctx, "b", 200))
+	assert.Equal(t, fmt.Errorf("missing state for c"), s.Set(ctx, "c", 1))
+	assert.Equal(t, fmt.Errorf("invalid offset: -1"), s.Set(ctx, "a", -1))
+
+	assert.Nil(t, s.Reset(ctx, "a"))
+
+	states, err := s.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, states[0].Offset)
+	assert.Equal(t, 200, states[1].Offset)
+
+	_, err = s.Offset(ctx, "c")
+	assert.Equal(t, fmt.Errorf("missing state for c"), err)
+}
+
+func TestFileStorePosition(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+	assert.Nil(t, s.Ensure(ctx, model.Database{Tables: []model.Table{{Name: "a"}}}, false))
+
+	cases := []struct {
+		name   string
+		change func() error
+		exp    string
+	}{
+		{name: "checkpointed", change: func() error { return s.CheckpointPosition(ctx, "a", 10, "p10") }, exp: "p10"},
+		{name: "offset checkpointed", change: func() error { return s.Checkpoint(ctx, "a", 20) }},
+		{name: "checkpointed again", change: func() error { return s.CheckpointPosition(ctx, "a", 30, "p30") }, exp: "p30"},
+		{name: "set", change: func() error { return s.Set(ctx, "a", 5) }},
+		{name: "reset", change: func() error {
+			if err := s.CheckpointPosition(ctx, "a", 40, "p40"); err != nil {
+				return err
+			}
+			return s.Reset(ctx, "a")
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Nil(t, c.change())
+
+			position, err := s.Position(ctx, "a")
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, position)
+		})
+	}
+
+	_, err := s.Position(ctx, "b")
+	assert.Equal(t, fmt.Errorf("missing state for b"), err)
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name   string
+		state  model.State
+		expErr error
+	}{
+		{name: "target without database", state: model.State{}, expErr: fmt.Errorf("target state store requires a target database")},
+		{name: "database without url", state: model.State{Store: StoreDatabase}, expErr: fmt.Errorf("missing url for database state store")},
+		{name: "file without path", state: model.State{Store: StoreFile}, expErr: fmt.Errorf("missing path for file state store")},
+		{name: "file", state: model.State{Store: StoreFile, Path: "state.json"}},
+		{name: "invalid", state: model.State{Store: "redis"}, expErr: fmt.Errorf(`invalid state store: "redis"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := New(context.Background(), model.Config{State: c.state}, nil)
+			assert.Equal(t, c.expErr, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		config model.Config
+		expErr error
+	}{
+		{name: "target", config: model.Config{Target: model.Database{Driver: "pgx"}}},
+		{name: "target with file target", config: model.Config{Target: model.Database{Driver: model.DriverCSV}}, expErr: fmt.Errorf("target state store requires a target database")},
+		{name: "file with file target", config: model.Config{State: model.State{Store: StoreFile, Path: "state.json"}, Target: model.Database{Driver: model.DriverCSV}}},
+		{name: "database without url", config: model.Config{State: model.State{Store: StoreDatabase}}, expErr: fmt.Errorf("missing url for database state store")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expErr, Validate(c.config))
+		})
+	}
+}
+
+func TestFileStoreRuns(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s := NewFileStore(path, "job")
+	other := NewFileStore(path, "other")
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	assert.Nil(t, s.RecordRun(ctx, Run{ID: "1", Command: "insert", StartedAt: start, Status: StatusRunning}))
+	assert.Nil(t, s.RecordRun(ctx, Run{ID: "1", Command: "insert", StartedAt: start, EndedAt: &end, Status: StatusComplete, Tables: []TableRun{
+		{Table: "a", RowsRead: 10, RowsWritten: 10},
+		{Table: "b", RowsRead: 5, RowsWritten: 3, RowsRejected: 2},
+	}}))
+	assert.Nil(t, s.RecordRun(ctx, Run{ID: "2", Command: "update", StartedAt: end, Status: StatusFailed, Error: "oh no"}))
+	assert.Nil(t, other.RecordRun(ctx, Run{ID: "3", Command: "insert", StartedAt: end, Status: StatusRunning}))
+
+	runs, err := s.Runs(ctx, 10)
+	assert.Nil(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, "2", runs[0].ID)
+	assert.Equal(t, "1", runs[1].ID)
+	assert.Equal(t, StatusComplete, runs[1].Status)
+	assert.Equal(t, time.Minute, runs[1].Duration())
+	assert.Equal(t, TableRun{RowsRead: 15, RowsWritten: 13, RowsRejected: 2}, runs[1].Totals())
+
+	runs, err = s.Runs(ctx, 1)
+	assert.Nil(t, err)
+	assert.Len(t, runs, 1)
+
+	r, err := s.Run(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "job", r.Job)
+	assert.Len(t, r.Tables, 2)
+
+	_, err = s.Run(ctx, "3")
+	assert.Equal(t, fmt.Errorf("missing run 3"), err)
+}
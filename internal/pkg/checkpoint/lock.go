@@ -0,0 +1,110 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// LockError is returned when a table is locked by another run.
+type LockError struct {
+	Table     string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("%s is locked by run %s until %s; if that run is no longer running, rerun with --force-unlock",
+		e.Table, e.Owner, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// Lease holds the locks on a run's tables, renewing them in the background
+// until it's released.
+type Lease struct {
+	store  Store
+	owner  string
+	ttl    time.Duration
+	tables []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Acquire locks the given tables for owner and keeps renewing the locks every
+// third of ttl until the lease is released.
+//
+// The returned context is cancelled if the lease is lost, either because it
+// couldn't be renewed before it expired or because another run has taken it
+// over, so that work stops before offsets can be clobbered.
+func Acquire(ctx context.Context, store Store, owner string, ttl time.Duration, tables ...string) (context.Context, *Lease, error) {
+	if err := store.Lock(ctx, owner, ttl, tables...); err != nil {
+		return nil, nil, err
+	}
+
+	l := &Lease{
+		store:  store,
+		owner:  owner,
+		ttl:    ttl,
+		tables: tables,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		defer close(l.done)
+		if err := l.heartbeat(ctx); err != nil {
+			cancel(err)
+		}
+	}()
+
+	return ctx, l, nil
+}
+
+// heartbeat renews the lease until it's stopped, returning an error if the
+// lease is lost.
+func (l *Lease) heartbeat(ctx context.Context) error {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		err := l.store.Lock(ctx, l.owner, l.ttl, l.tables...)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+
+		var lockErr *LockError
+		if errors.As(err, &lockErr) {
+			return fmt.Errorf("lost lock: %w", err)
+		}
+
+		if time.Since(renewed) >= l.ttl {
+			return fmt.Errorf("lock expired: %w", err)
+		}
+		slog.Warn("error renewing lock", "owner", l.owner, "error", err)
+	}
+}
+
+// Release stops renewing the lease and unlocks its tables.
+func (l *Lease) Release(ctx context.Context) error {
+	close(l.stop)
+	<-l.done
+
+	if err := l.store.Unlock(ctx, l.owner, l.tables...); err != nil {
+		return fmt.Errorf("releasing lock: %w", err)
+	}
+
+	return nil
+}
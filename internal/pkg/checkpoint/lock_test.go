@@ -0,0 +1,131 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStoreLocks(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+
+	assert.Nil(t, s.Lock(ctx, "run1", time.Minute, "a", "b"))
+
+	// Renewing our own lock succeeds.
+	assert.Nil(t, s.Lock(ctx, "run1", time.Minute, "a", "b"))
+
+	// Another run can't take any of the tables, so takes none of them.
+	var lockErr *LockError
+	assert.True(t, errors.As(s.Lock(ctx, "run2", time.Minute, "c", "b"), &lockErr))
+	assert.Equal(t, "b", lockErr.Table)
+	assert.Equal(t, "run1", lockErr.Owner)
+	assert.Nil(t, s.Lock(ctx, "run3", time.Minute, "c"))
+
+	// Another run's unlock leaves the lock in place.
+	assert.Nil(t, s.Unlock(ctx, "run2", "a"))
+	assert.NotNil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+
+	assert.Nil(t, s.Unlock(ctx, "run1", "a"))
+	assert.Nil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+
+	assert.Nil(t, s.ForceUnlock(ctx, "b"))
+	assert.Nil(t, s.Lock(ctx, "run2", time.Minute, "b"))
+
+	assert.Nil(t, s.ForceUnlock(ctx))
+	assert.Nil(t, s.Lock(ctx, "run1", time.Minute, "a", "b", "c"))
+}
+
+func TestFileStoreLockContention(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// Separate stores stand in for separate processes sharing the locks
+	// file, so only one of them can take the lock.
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	for i := 0; i < 10; i++ {
+		s := NewFileStore(path, "job")
+		owner := fmt.Sprintf("run%d", i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var lockErr *LockError
+			switch err := s.Lock(ctx, owner, time.Minute, "a"); {
+			case err == nil:
+				won.Add(1)
+			case !errors.As(err, &lockErr):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), won.Load())
+}
+
+func TestFileStoreLockExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+
+	assert.Nil(t, s.Lock(ctx, "run1", -time.Second, "a"))
+	assert.Nil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+}
+
+func TestFileStoreLockJobs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	assert.Nil(t, NewFileStore(path, "job1").Lock(ctx, "run1", time.Minute, "a"))
+	assert.Nil(t, NewFileStore(path, "job2").Lock(ctx, "run2", time.Minute, "a"))
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+
+	leaseCtx, lease, err := Acquire(ctx, s, "run1", 30*time.Millisecond, "a")
+	assert.Nil(t, err)
+
+	// The heartbeat keeps the lock alive well beyond its TTL.
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, leaseCtx.Err())
+	assert.NotNil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+
+	assert.Nil(t, lease.Release(ctx))
+	assert.Nil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+
+	leaseCtx, lease, err := Acquire(ctx, s, "run1", 30*time.Millisecond, "a")
+	assert.Nil(t, err)
+
+	// Another run forcibly takes the lock.
+	assert.Nil(t, s.ForceUnlock(ctx))
+	assert.Nil(t, s.Lock(ctx, "run2", time.Minute, "a"))
+
+	select {
+	case <-leaseCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease wasn't lost")
+	}
+
+	var lockErr *LockError
+	assert.True(t, errors.As(context.Cause(leaseCtx), &lockErr))
+	assert.Equal(t, "run2", lockErr.Owner)
+
+	assert.Nil(t, lease.Release(ctx))
+	assert.NotNil(t, s.Lock(ctx, "run1", time.Minute, "a"))
+}
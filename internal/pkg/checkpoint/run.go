@@ -0,0 +1,46 @@
+package checkpoint
+
+import "time"
+
+// Run records a single invocation of ds against a job, so that what was
+// shifted, and when, can be audited later.
+type Run struct {
+	ID         string     `json:"id"`
+	Job        string     `json:"job"`
+	Command    string     `json:"command"`
+	ConfigHash string     `json:"config_hash"`
+	Version    string     `json:"version"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Tables     []TableRun `json:"tables"`
+}
+
+// TableRun records the rows processed for a single table during a run.
+type TableRun struct {
+	Table        string `json:"table"`
+	RowsRead     int64  `json:"rows_read"`
+	RowsWritten  int64  `json:"rows_written"`
+	RowsRejected int64  `json:"rows_rejected"`
+}
+
+// Duration returns how long the run took, or has taken so far if it's still
+// running.
+func (r Run) Duration() time.Duration {
+	if r.EndedAt == nil {
+		return time.Since(r.StartedAt)
+	}
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// Totals returns the rows processed across all of the run's tables.
+func (r Run) Totals() TableRun {
+	var total TableRun
+	for _, t := range r.Tables {
+		total.RowsRead += t.RowsRead
+		total.RowsWritten += t.RowsWritten
+		total.RowsRejected += t.RowsRejected
+	}
+	return total
+}
@@ -0,0 +1,154 @@
+package checkpoint
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Table statuses recorded by a Store.
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusComplete = "complete"
+	StatusFailed   = "failed"
+)
+
+// Stores that can be selected in the config file.
+const (
+	StoreTarget   = "target"
+	StoreDatabase = "database"
+	StoreFile     = "file"
+)
+
+// TableState describes how far through a table shift has got.
+type TableState struct {
+	Table     string    `json:"-"`
+	Offset    int       `json:"offset"`
+	Position  string    `json:"position,omitempty"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store records the offset and status of each of a job's tables, so that
+// interrupted runs can resume where they left off, along with the history of
+// the job's runs and the locks that stop runs of the job overlapping.
+type Store interface {
+	// Ensure initialises state for each of the given tables. If reset is
+	// true, the offsets of tables that completed on their previous run are
+	// reset, so they're shifted again from the start.
+	Ensure(ctx context.Context, d model.Database, reset bool) error
+
+	// List returns the state of the given tables, or of every table if none
+	// are provided.
+	List(ctx context.Context, tables ...string) ([]TableState, error)
+
+	// Reset resets the offsets of the given tables to zero, or of every table
+	// if none are provided.
+	Reset(ctx context.Context, tables ...string) error
+
+	// Set sets the offset of a table, so the next run resumes from there.
+	Set(ctx context.Context, table string, offset int) error
+
+	// Offset returns the current offset of a table.
+	Offset(ctx context.Context, table string) (int, error)
+
+	// Checkpoint records the current offset of a table during a run.
+	Checkpoint(ctx context.Context, table string, offset int) error
+
+	// Position returns the position in a table's source files that was
+	// recorded along with its current offset, or an empty string if there
+	// isn't one. Positions are opaque to the store and are cleared whenever
+	// the offset is changed without one.
+	Position(ctx context.Context, table string) (string, error)
+
+	// CheckpointPosition records the current offset of a table during a run,
+	// along with the position in its source files that it was read up to.
+	CheckpointPosition(ctx context.Context, table string, offset int, position string) error
+
+	// SetStatus records the status of a table.
+	SetStatus(ctx context.Context, table, status string) error
+
+	// RecordRun records a run in the job's history, replacing any previous
+	// record of the same run.
+	RecordRun(ctx context.Context, r Run) error
+
+	// Runs returns up to limit of the job's most recent runs, newest first.
+	Runs(ctx context.Context, limit int) ([]Run, error)
+
+	// Run returns the run with the given id.
+	Run(ctx context.Context, id string) (Run, error)
+
+	// Lock acquires, or renews, owner's locks on the given tables, which
+	// expire after ttl unless renewed. Either every table is locked or none
+	// are; a LockError is returned if another owner holds an unexpired lock on
+	// any of them.
+	Lock(ctx context.Context, owner string, ttl time.Duration, tables ...string) error
+
+	// Unlock releases owner's locks on the given tables.
+	Unlock(ctx context.Context, owner string, tables ...string) error
+
+	// ForceUnlock releases the locks on the given tables, or on every table if
+	// none are provided, regardless of who holds them.
+	ForceUnlock(ctx context.Context, tables ...string) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Validate returns an error if the config doesn't select a valid store, or
+// selects the target store for a target that isn't a database.
+func Validate(c model.Config) error {
+	switch s := c.State; s.Store {
+	case "", StoreTarget:
+		if c.Target.IsFile() {
+			return fmt.Errorf("%s state store requires a target database", StoreTarget)
+		}
+		return nil
+	case StoreDatabase:
+		if s.URL == "" {
+			return fmt.Errorf("missing url for %s state store", StoreDatabase)
+		}
+		return nil
+	case StoreFile:
+		if s.Path == "" {
+			return fmt.Errorf("missing path for %s state store", StoreFile)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid state store: %q", s.Store)
+	}
+}
+
+// New returns the Store selected by the config. The target database is used
+// by the default target store and may be nil if another store is selected.
+func New(ctx context.Context, c model.Config, targetDB *pgxpool.Pool) (Store, error) {
+	if err := Validate(c); err != nil {
+		return nil, err
+	}
+
+	switch c.State.Store {
+	case "", StoreTarget:
+		if targetDB == nil {
+			return nil, fmt.Errorf("%s state store requires a target database", StoreTarget)
+		}
+		return NewDBStore(targetDB, c), nil
+
+	case StoreDatabase:
+		db, err := pgxpool.New(ctx, c.State.URL)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to state database: %w", err)
+		}
+
+		store := NewDBStore(db, c)
+		store.owned = true
+		return store, nil
+
+	default:
+		// Validate leaves the file store as the only other option.
+		return NewFileStore(c.State.Path, c.JobName()), nil
+	}
+}
@@ -0,0 +1,413 @@
+package control
+
+import (
+	"context"
+	"ds/internal/pkg/logging"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/progress"
+	"ds/internal/pkg/throttle"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+var (
+	// ErrCancelled is the cause of a run or table being cancelled through
+	// the control API.
+	ErrCancelled = errors.New("cancelled through the control API")
+
+	// ErrFinished is returned when changing a table that's already finished.
+	ErrFinished = errors.New("table has already finished")
+)
+
+// State is the state of a run or one of its tables.
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StatePaused    State = "paused"
+	StateWaiting   State = "waiting"
+	StateComplete  State = "complete"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Run tracks the state of a run's tables, so they can be reported on and
+// paused, resumed, cancelled and re-throttled while the run is in progress.
+type Run struct {
+	id      string
+	command string
+	started time.Time
+	cancel  context.CancelCauseFunc
+
+	mu        sync.Mutex
+	tables    []*Table
+	cancelled bool
+}
+
+// NewRun returns a Run, which cancels the run's context with the given
+// function if it's cancelled.
+func NewRun(id, command string, cancel context.CancelCauseFunc) *Run {
+	return &Run{
+		id:      id,
+		command: command,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+}
+
+// Add adds a table to the run, in the order it'll be shifted, along with the
+// pacer that paces its batches.
+func (r *Run) Add(t model.Table, pacer *throttle.Pacer) *Table {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	table := &Table{
+		name:      t.Name,
+		readLimit: t.ReadLimit,
+		pacer:     pacer,
+		state:     StatePending,
+	}
+	r.tables = append(r.tables, table)
+
+	return table
+}
+
+// Table returns the run's table with the given name, or nil if it doesn't
+// have one.
+func (r *Run) Table(name string) *Table {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tables {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Pause pauses every table that hasn't finished yet.
+func (r *Run) Pause() {
+	for _, t := range r.unfinished() {
+		t.pacer.Pause()
+	}
+}
+
+// Resume resumes every table that hasn't finished yet.
+func (r *Run) Resume() {
+	for _, t := range r.unfinished() {
+		t.pacer.Resume()
+	}
+}
+
+// Cancel cancels the run, stopping the table that's being shifted and
+// skipping the rest.
+func (r *Run) Cancel() {
+	r.mu.Lock()
+	r.cancelled = true
+	r.mu.Unlock()
+
+	for _, t := range r.unfinished() {
+		t.mu.Lock()
+		t.cancelled = true
+		t.mu.Unlock()
+	}
+
+	r.cancel(ErrCancelled)
+}
+
+// Set changes the read_limit and read_delay of every table that hasn't
+// finished yet. Nil settings are left unchanged.
+func (r *Run) Set(readLimit *int, readDelay *time.Duration) error {
+	if err := validateSettings(readLimit, readDelay); err != nil {
+		return err
+	}
+
+	for _, t := range r.unfinished() {
+		t.set(readLimit, readDelay)
+	}
+	return nil
+}
+
+// RunStatus is a snapshot of a run's state.
+type RunStatus struct {
+	ID        string        `json:"id"`
+	Command   string        `json:"command"`
+	StartedAt time.Time     `json:"started_at"`
+	State     State         `json:"state"`
+	Tables    []TableStatus `json:"tables"`
+}
+
+// Status returns a snapshot of the run's state. A run is paused once every
+// table that's yet to finish has been paused.
+func (r *Run) Status() RunStatus {
+	r.mu.Lock()
+	tables := r.tables
+	cancelled := r.cancelled
+	r.mu.Unlock()
+
+	s := RunStatus{
+		ID:        r.id,
+		Command:   r.command,
+		StartedAt: r.started,
+		State:     StateRunning,
+		Tables:    make([]TableStatus, 0, len(tables)),
+	}
+
+	for _, t := range tables {
+		s.Tables = append(s.Tables, t.Status())
+	}
+
+	unfinished := r.unfinished()
+	paused := lo.CountBy(unfinished, func(t *Table) bool {
+		return t.pacer.Paused()
+	})
+
+	switch {
+	case cancelled:
+		s.State = StateCancelled
+	case len(unfinished) > 0 && paused == len(unfinished):
+		s.State = StatePaused
+	}
+
+	return s
+}
+
+func (r *Run) unfinished() []*Table {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tables []*Table
+	for _, t := range r.tables {
+		if !t.finished() {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// Table tracks the state of a single table in a run.
+type Table struct {
+	name      string
+	readLimit int
+	pacer     *throttle.Pacer
+
+	mu        sync.Mutex
+	state     State
+	err       error
+	tracker   *progress.Tracker
+	cancel    context.CancelCauseFunc
+	cancelled bool
+}
+
+// Pacer returns the pacer that paces the table's batches.
+func (t *Table) Pacer() *throttle.Pacer {
+	return t.pacer
+}
+
+// Start marks the table as running, returning a context that's cancelled if
+// the table is. If the table was cancelled before it started, the context is
+// cancelled already.
+func (t *Table) Start(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = StateRunning
+	t.cancel = cancel
+	if t.cancelled {
+		cancel(ErrCancelled)
+	}
+
+	return ctx
+}
+
+// Track reports the table's progress from the given tracker.
+func (t *Table) Track(tracker *progress.Tracker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tracker = tracker
+}
+
+// Finish marks the table as complete, failed or cancelled, given the error
+// shifting it returned.
+func (t *Table) Finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case err == nil:
+		t.state = StateComplete
+	case t.cancelled:
+		t.state = StateCancelled
+	default:
+		t.state = StateFailed
+		t.err = err
+	}
+
+	if t.cancel != nil {
+		t.cancel(nil)
+	}
+}
+
+// Cancelled returns true if the table has been cancelled.
+func (t *Table) Cancelled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cancelled
+}
+
+// Pause stops the table from reading any more batches until it's resumed.
+func (t *Table) Pause() error {
+	if err := t.checkUnfinished(); err != nil {
+		return err
+	}
+
+	t.pacer.Pause()
+	return nil
+}
+
+// Resume lets a paused table carry on reading batches.
+func (t *Table) Resume() error {
+	if err := t.checkUnfinished(); err != nil {
+		return err
+	}
+
+	t.pacer.Resume()
+	return nil
+}
+
+// Cancel stops the table if it's being shifted, or skips it if it hasn't
+// started yet. The run carries on with its other tables.
+func (t *Table) Cancel() error {
+	if err := t.checkUnfinished(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancelled = true
+	if t.cancel != nil {
+		t.cancel(ErrCancelled)
+	}
+	return nil
+}
+
+// Set changes the table's read_limit and read_delay from its next batch. Nil
+// settings are left unchanged, and a read_limit of zero restores the one it's
+// configured with.
+func (t *Table) Set(readLimit *int, readDelay *time.Duration) error {
+	if err := validateSettings(readLimit, readDelay); err != nil {
+		return err
+	}
+	if err := t.checkUnfinished(); err != nil {
+		return err
+	}
+
+	t.set(readLimit, readDelay)
+	return nil
+}
+
+// TableStatus is a snapshot of a table's state.
+type TableStatus struct {
+	Name          string  `json:"name"`
+	State         State   `json:"state"`
+	Rows          int64   `json:"rows"`
+	Total         int64   `json:"total,omitempty"`
+	Percent       float64 `json:"percent,omitempty"`
+	Rate          float64 `json:"rate"`
+	ETA           string  `json:"eta,omitempty"`
+	ReadLimit     int     `json:"read_limit"`
+	ReadDelay     string  `json:"read_delay"`
+	ThrottleDelay string  `json:"throttle_delay"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Status returns a snapshot of the table's state. Tables that are yet to
+// finish are paused if they've been paused, and waiting while they're outside
+// of their maintenance windows.
+func (t *Table) Status() TableStatus {
+	t.mu.Lock()
+	state, err, tracker := t.state, t.err, t.tracker
+	t.mu.Unlock()
+
+	if state == StatePending || state == StateRunning {
+		switch {
+		case t.pacer.Paused():
+			state = StatePaused
+		case t.pacer.Closed():
+			state = StateWaiting
+		}
+	}
+
+	s := TableStatus{
+		Name:          t.name,
+		State:         state,
+		ReadLimit:     t.pacer.ReadLimit(t.readLimit),
+		ReadDelay:     t.pacer.ReadDelay().String(),
+		ThrottleDelay: t.pacer.Delay().String(),
+	}
+
+	if tracker != nil {
+		p := tracker.Snapshot()
+		s.Rows, s.Total, s.Rate = p.Done, p.Total, math.Round(p.Rate)
+		s.Percent = math.Round(p.Percent*10) / 10
+		if p.ETA > 0 {
+			s.ETA = p.ETA.Round(time.Second).String()
+		}
+	}
+
+	if err != nil {
+		s.Error = logging.Redact(err.Error())
+	}
+
+	return s
+}
+
+func (t *Table) set(readLimit *int, readDelay *time.Duration) {
+	if readLimit != nil {
+		t.pacer.SetReadLimit(*readLimit)
+	}
+	if readDelay != nil {
+		t.pacer.SetReadDelay(*readDelay)
+	}
+}
+
+func (t *Table) finished() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.state != StatePending && t.state != StateRunning
+}
+
+// checkUnfinished returns an error if the table has already finished, so it
+// can't be changed.
+func (t *Table) checkUnfinished() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state != StatePending && t.state != StateRunning {
+		return fmt.Errorf("%w: %s is %s", ErrFinished, t.name, t.state)
+	}
+	return nil
+}
+
+func validateSettings(readLimit *int, readDelay *time.Duration) error {
+	if readLimit != nil && *readLimit < 0 {
+		return fmt.Errorf("invalid read_limit: %d", *readLimit)
+	}
+	if readDelay != nil && *readDelay < 0 {
+		return fmt.Errorf("invalid read_delay: %s", *readDelay)
+	}
+	return nil
+}
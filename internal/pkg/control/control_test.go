@@ -0,0 +1,177 @@
+package control
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/throttle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRun(t *testing.T) (*Run, context.Context) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+
+	controller := throttle.New(model.Throttle{}, model.BatchSize{}, nil)
+	run := NewRun("abc123", "insert", cancel)
+	for _, table := range []model.Table{
+		{Name: "person", ReadLimit: 100, ReadDelay: time.Second},
+		{Name: "pet"},
+	} {
+		run.Add(table, controller.Pacer(table, nil))
+	}
+
+	return run, ctx
+}
+
+func request(t *testing.T, run *Run, method, path, body string) (int, map[string]any) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Handler(run).ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	var resp map[string]any
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	return rec.Code, resp
+}
+
+func TestStatus(t *testing.T) {
+	run, ctx := newTestRun(t)
+	run.Table("person").Start(ctx)
+	run.Table("pet").Start(ctx)
+	run.Table("pet").Finish(fmt.Errorf("oh no"))
+
+	status, resp := request(t, run, http.MethodGet, "/status", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "abc123", resp["id"])
+	assert.Equal(t, "insert", resp["command"])
+	assert.Equal(t, "running", resp["state"])
+
+	tables := resp["tables"].([]any)
+	assert.Equal(t, map[string]any{
+		"name":           "person",
+		"state":          "running",
+		"rows":           float64(0),
+		"rate":           float64(0),
+		"read_limit":     float64(100),
+		"read_delay":     "1s",
+		"throttle_delay": "0s",
+	}, tables[0])
+	assert.Equal(t, "failed", tables[1].(map[string]any)["state"])
+	assert.Equal(t, "oh no", tables[1].(map[string]any)["error"])
+}
+
+func TestTableRequests(t *testing.T) {
+	cases := []struct {
+		name      string
+		setup     func(*Run)
+		method    string
+		path      string
+		body      string
+		expStatus int
+		expState  string
+		expError  string
+	}{
+		{name: "status", method: http.MethodGet, path: "/tables/person", expStatus: http.StatusOK, expState: "running"},
+		{name: "pause", method: http.MethodPost, path: "/tables/person/pause", expStatus: http.StatusOK, expState: "paused"},
+		{name: "resume", setup: func(r *Run) { r.Table("person").Pacer().Pause() }, method: http.MethodPost, path: "/tables/person/resume", expStatus: http.StatusOK, expState: "running"},
+		{name: "pause pending", method: http.MethodPost, path: "/tables/pet/pause", expStatus: http.StatusOK, expState: "paused"},
+		{name: "settings", method: http.MethodPost, path: "/tables/person/settings", body: `{"read_limit": 500, "read_delay": "2s"}`, expStatus: http.StatusOK, expState: "running"},
+		{name: "invalid read_limit", method: http.MethodPost, path: "/tables/person/settings", body: `{"read_limit": -1}`, expStatus: http.StatusBadRequest, expError: "invalid read_limit: -1"},
+		{name: "invalid read_delay", method: http.MethodPost, path: "/tables/person/settings", body: `{"read_delay": "soon"}`, expStatus: http.StatusBadRequest, expError: `invalid read_delay: time: invalid duration "soon"`},
+		{name: "unknown setting", method: http.MethodPost, path: "/tables/person/settings", body: `{"read_rate": 1}`, expStatus: http.StatusBadRequest, expError: `decoding settings: json: unknown field "read_rate"`},
+		{name: "unknown table", method: http.MethodPost, path: "/tables/owner/pause", expStatus: http.StatusNotFound, expError: "table not found: owner"},
+		{name: "unknown action", method: http.MethodPost, path: "/tables/person/stop", expStatus: http.StatusNotFound, expError: "invalid action: stop"},
+		{name: "wrong method", method: http.MethodGet, path: "/tables/person/pause", expStatus: http.StatusMethodNotAllowed, expError: "method not allowed: GET"},
+		{name: "finished table", setup: func(r *Run) { r.Table("pet").Finish(nil) }, method: http.MethodPost, path: "/tables/pet/pause", expStatus: http.StatusConflict, expError: "table has already finished: pet is complete"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			run, ctx := newTestRun(t)
+			run.Table("person").Start(ctx)
+			if c.setup != nil {
+				c.setup(run)
+			}
+
+			status, resp := request(t, run, c.method, c.path, c.body)
+			assert.Equal(t, c.expStatus, status)
+
+			if c.expError != "" {
+				assert.Equal(t, c.expError, resp["error"])
+				return
+			}
+			assert.Equal(t, c.expState, resp["state"])
+		})
+	}
+}
+
+func TestTableSettings(t *testing.T) {
+	run, ctx := newTestRun(t)
+	run.Table("person").Start(ctx)
+
+	_, resp := request(t, run, http.MethodPost, "/tables/person/settings", `{"read_limit": 500}`)
+	assert.Equal(t, float64(500), resp["read_limit"])
+	assert.Equal(t, "1s", resp["read_delay"])
+
+	_, resp = request(t, run, http.MethodPost, "/settings", `{"read_delay": "250ms"}`)
+	for _, table := range resp["tables"].([]any) {
+		assert.Equal(t, "250ms", table.(map[string]any)["read_delay"])
+	}
+}
+
+func TestTableCancel(t *testing.T) {
+	run, ctx := newTestRun(t)
+	person := run.Table("person")
+	tableCtx := person.Start(ctx)
+
+	status, _ := request(t, run, http.MethodPost, "/tables/person/cancel", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Only the table is cancelled, not the run.
+	assert.Equal(t, ErrCancelled, context.Cause(tableCtx))
+	assert.Nil(t, ctx.Err())
+
+	person.Finish(tableCtx.Err())
+	assert.Equal(t, StateCancelled, person.Status().State)
+	assert.Empty(t, person.Status().Error)
+
+	// Tables cancelled before they start are cancelled as soon as they do.
+	pet := run.Table("pet")
+	assert.Nil(t, pet.Cancel())
+	assert.Equal(t, ErrCancelled, context.Cause(pet.Start(ctx)))
+}
+
+func TestRunRequests(t *testing.T) {
+	run, ctx := newTestRun(t)
+	run.Table("person").Start(ctx)
+
+	_, resp := request(t, run, http.MethodPost, "/pause", "")
+	assert.Equal(t, "paused", resp["state"])
+	for _, table := range resp["tables"].([]any) {
+		assert.Equal(t, "paused", table.(map[string]any)["state"])
+	}
+
+	_, resp = request(t, run, http.MethodPost, "/resume", "")
+	assert.Equal(t, "running", resp["state"])
+
+	status, resp := request(t, run, http.MethodGet, "/cancel", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+	assert.Equal(t, "method not allowed: GET", resp["error"])
+
+	_, resp = request(t, run, http.MethodPost, "/cancel", "")
+	assert.Equal(t, "cancelled", resp["state"])
+	assert.Equal(t, ErrCancelled, context.Cause(ctx))
+	assert.True(t, run.Table("person").Cancelled())
+	assert.True(t, run.Table("pet").Cancelled())
+}
@@ -0,0 +1,195 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Serve starts serving the control API for a run on the given address in the
+// background.
+func Serve(addr string, run *Run) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	go func() {
+		if err := http.Serve(lis, Handler(run)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("error serving control API", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Handler returns the control API's handler for a run:
+//
+//	GET  /status                   the run's status, and that of its tables
+//	POST /pause                    pause every table
+//	POST /resume                   resume every table
+//	POST /cancel                   cancel the run
+//	POST /settings                 change every table's read_limit and read_delay
+//	GET  /tables/{table}           a table's status
+//	POST /tables/{table}/pause     pause a table
+//	POST /tables/{table}/resume    resume a table
+//	POST /tables/{table}/cancel    cancel a table, carrying on with the rest
+//	POST /tables/{table}/settings  change a table's read_limit and read_delay
+//
+// Settings are given as a JSON object, such as {"read_limit": 500,
+// "read_delay": "1s"}, either of which can be omitted.
+func Handler(run *Run) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+		respond(w, http.StatusOK, run.Status())
+	})
+
+	for path, action := range map[string]func(){
+		"/pause":  run.Pause,
+		"/resume": run.Resume,
+		"/cancel": run.Cancel,
+	} {
+		action := action
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if !allow(w, r, http.MethodPost) {
+				return
+			}
+			action()
+			slog.Info("run changed through control API", "action", strings.TrimPrefix(r.URL.Path, "/"))
+			respond(w, http.StatusOK, run.Status())
+		})
+	}
+
+	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		readLimit, readDelay, err := decodeSettings(r)
+		if err == nil {
+			err = run.Set(readLimit, readDelay)
+		}
+		if err != nil {
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+
+		slog.Info("run changed through control API", "action", "settings")
+		respond(w, http.StatusOK, run.Status())
+	})
+
+	mux.HandleFunc("/tables/", func(w http.ResponseWriter, r *http.Request) {
+		name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/tables/"), "/")
+
+		table := run.Table(name)
+		if table == nil {
+			fail(w, http.StatusNotFound, fmt.Errorf("table not found: %s", name))
+			return
+		}
+
+		if action == "" {
+			if allow(w, r, http.MethodGet) {
+				respond(w, http.StatusOK, table.Status())
+			}
+			return
+		}
+
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		var err error
+		switch action {
+		case "pause":
+			err = table.Pause()
+		case "resume":
+			err = table.Resume()
+		case "cancel":
+			err = table.Cancel()
+		case "settings":
+			var readLimit *int
+			var readDelay *time.Duration
+			if readLimit, readDelay, err = decodeSettings(r); err != nil {
+				fail(w, http.StatusBadRequest, err)
+				return
+			}
+			err = table.Set(readLimit, readDelay)
+		default:
+			fail(w, http.StatusNotFound, fmt.Errorf("invalid action: %s", action))
+			return
+		}
+
+		switch {
+		case errors.Is(err, ErrFinished):
+			fail(w, http.StatusConflict, err)
+			return
+		case err != nil:
+			fail(w, http.StatusBadRequest, err)
+			return
+		}
+
+		slog.Info("table changed through control API", "table", name, "action", action)
+		respond(w, http.StatusOK, table.Status())
+	})
+
+	return mux
+}
+
+// decodeSettings reads the read_limit and read_delay to change from a
+// request's body, returning nil for those that aren't given.
+func decodeSettings(r *http.Request) (*int, *time.Duration, error) {
+	var body struct {
+		ReadLimit *int    `json:"read_limit"`
+		ReadDelay *string `json:"read_delay"`
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("decoding settings: %w", err)
+	}
+
+	if body.ReadDelay == nil {
+		return body.ReadLimit, nil, nil
+	}
+
+	delay, err := time.ParseDuration(*body.ReadDelay)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid read_delay: %w", err)
+	}
+	return body.ReadLimit, &delay, nil
+}
+
+// allow returns true if the request uses the given method, responding with an
+// error if it doesn't.
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	fail(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+	return false
+}
+
+func respond(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("error writing control API response", "error", err)
+	}
+}
+
+func fail(w http.ResponseWriter, status int, err error) {
+	respond(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,195 @@
+package file
+
+import (
+	"bufio"
+	"ds/internal/pkg/model"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decoder reads rows from a file, returning each row's values in the order of
+// the table's columns, with a nil for NULLs. Values from text formats are
+// returned as the strings that appear in the file; values from typed formats
+// are returned as Go values of their type. SQL files are read a Statement at a
+// time instead.
+//
+// Offset returns the position in the file of the next row, which is a byte
+// offset into the decompressed contents of text files and the number of rows
+// read from Parquet files.
+type decoder interface {
+	Decode() ([]any, error)
+	Offset() int64
+}
+
+// resumer is implemented by the decoders of text files, which resume reading
+// from a stream that has been moved to an offset returned by Offset, once the
+// header has been read from the start of the file.
+type resumer interface {
+	resume(r io.Reader, offset int64)
+}
+
+// newDecoder returns a decoder for the given file driver, which maps the
+// values in the file onto the given columns by name. Columns whose type holds
+// JSON are given the raw JSON of JSONL values, CSV fields matching the null
+// string are read as NULLs, and CSV text is read as bytes into columns whose
+// type holds binary values.
+func newDecoder(driver string, r io.Reader, columns, types []string, null string) (decoder, error) {
+	switch driver {
+	case model.DriverCSV:
+		binary := make([]bool, len(columns))
+		for i := range types {
+			binary[i] = isBinary(types[i])
+		}
+		return newCSVDecoder(r, columns, binary, null)
+	case model.DriverJSONL:
+		raw := make([]bool, len(columns))
+		for i := range types {
+			raw[i] = isJSON(types[i])
+		}
+		return &jsonlDecoder{dec: json.NewDecoder(r), columns: columns, raw: raw}, nil
+	case model.DriverSQL:
+		return &sqlDecoder{r: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("invalid file driver: %q", driver)
+	}
+}
+
+type csvDecoder struct {
+	r         *csv.Reader
+	base      int64
+	positions []int
+	binary    []bool
+	null      string
+}
+
+// newCSVDecoder reads the file's header and maps each column to its position
+// in the file's records.
+func newCSVDecoder(r io.Reader, columns []string, binary []bool, null string) (*csvDecoder, error) {
+	d := &csvDecoder{
+		positions: make([]int, len(columns)),
+		binary:    binary,
+		null:      null,
+	}
+	d.resume(r, 0)
+
+	header, err := d.r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	for i, col := range columns {
+		d.positions[i] = -1
+		for j, field := range header {
+			if field == col {
+				d.positions[i] = j
+				break
+			}
+		}
+
+		if d.positions[i] < 0 {
+			return nil, fmt.Errorf("missing column in header: %s", col)
+		}
+	}
+
+	return d, nil
+}
+
+// Decode reads a CSV record. Fields matching the null string are read as
+// NULLs and those in Postgres' bytea hex format as the bytes they encode,
+// while escaped backslashes in text are unescaped. Other backslashes are left
+// as they are, so files that weren't written by ds can be read as they are.
+func (d *csvDecoder) Decode() ([]any, error) {
+	record, err := d.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(d.positions))
+	for i, p := range d.positions {
+		field := record[p]
+		if field == d.null {
+			continue
+		}
+
+		if h, ok := strings.CutPrefix(field, `\x`); ok {
+			b, err := hex.DecodeString(h)
+			if err != nil {
+				return nil, fmt.Errorf("decoding binary value: %w", err)
+			}
+			values[i] = b
+			continue
+		}
+
+		text := strings.ReplaceAll(field, `\\`, `\`)
+		if d.binary[i] {
+			values[i] = []byte(text)
+			continue
+		}
+		values[i] = text
+	}
+
+	return values, nil
+}
+
+// Offset returns the byte offset of the end of the last record read.
+func (d *csvDecoder) Offset() int64 {
+	return d.base + d.r.InputOffset()
+}
+
+func (d *csvDecoder) resume(r io.Reader, offset int64) {
+	d.r = csv.NewReader(r)
+	d.r.ReuseRecord = true
+	d.base = offset
+}
+
+type jsonlDecoder struct {
+	dec     *json.Decoder
+	base    int64
+	columns []string
+	raw     []bool
+}
+
+// Offset returns the byte offset of the end of the last object read.
+func (d *jsonlDecoder) Offset() int64 {
+	return d.base + d.dec.InputOffset()
+}
+
+func (d *jsonlDecoder) resume(r io.Reader, offset int64) {
+	d.dec = json.NewDecoder(r)
+	d.base = offset
+}
+
+// Decode reads a JSON object. Missing keys and nulls are read as NULLs, and
+// strings are unquoted unless their column holds JSON.
+func (d *jsonlDecoder) Decode() ([]any, error) {
+	var obj map[string]json.RawMessage
+	if err := d.dec.Decode(&obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("decoding object: %w", err)
+	}
+
+	values := make([]any, len(d.columns))
+	for i, col := range d.columns {
+		raw, ok := obj[col]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		v := string(raw)
+		if raw[0] == '"' && !d.raw[i] {
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", col, err)
+			}
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
@@ -0,0 +1,155 @@
+package file
+
+import (
+	"ds/internal/pkg/model"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// encoder writes rows to a file in a particular format.
+type encoder interface {
+	// Encode writes a single row.
+	Encode(row []any) error
+
+	// Flush writes any buffered rows to the underlying writer.
+	Flush() error
+}
+
+// newEncoder returns an encoder for the database's file driver, which writes
+// the given table's columns. CSV files begin with a header naming each column,
+// and Parquet files are typed using the source's column types, if they're
+// given. The types also tell binary values, which are written to CSV and JSONL
+// files in hex, from text that's returned as bytes.
+func newEncoder(d model.Database, w io.Writer, t model.Table, types []string, upsert bool) (encoder, error) {
+	columns := t.ColumnNames()
+	columnTypes := make([]string, len(columns))
+	copy(columnTypes, types)
+
+	switch d.Driver {
+	case model.DriverCSV:
+		return newCSVEncoder(w, columns, columnTypes, d.Null())
+	case model.DriverJSONL:
+		return &jsonlEncoder{enc: json.NewEncoder(w), columns: columns, types: columnTypes}, nil
+	case model.DriverParquet:
+		return newParquetEncoder(w, columns, types, d.Compression, d.RowGroupSize)
+	case model.DriverSQL:
+		return newSQLEncoder(w, t, d.SQLFormat, upsert)
+	default:
+		return nil, fmt.Errorf("invalid file driver: %q", d.Driver)
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+	types  []string
+	null   string
+}
+
+func newCSVEncoder(w io.Writer, columns, types []string, null string) (*csvEncoder, error) {
+	e := &csvEncoder{
+		w:      csv.NewWriter(w),
+		record: make([]string, len(columns)),
+		types:  types,
+		null:   null,
+	}
+
+	if err := e.w.Write(columns); err != nil {
+		return nil, fmt.Errorf("writing header: %w", err)
+	}
+
+	return e, nil
+}
+
+// Encode writes a row as a CSV record. NULLs are written as the encoder's
+// null string and binary values in Postgres' bytea hex format, while text has
+// its backslashes escaped, as in Postgres' COPY text format, so that NULLs,
+// binary values and text can always be told apart.
+func (e *csvEncoder) Encode(row []any) error {
+	for i, v := range row {
+		switch b, ok := v.([]byte); {
+		case v == nil:
+			e.record[i] = e.null
+		case ok && binaryValue(e.types[i], b):
+			e.record[i] = formatBytes(b)
+		default:
+			e.record[i] = textEscaper.Replace(formatCSV(v))
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// textEscaper escapes the backslashes in text written to CSV files, so it
+// can't be mistaken for a NULL or a binary value.
+var textEscaper = strings.NewReplacer(`\`, `\\`)
+
+// formatCSV returns a value as text. Bytes are returned as the text they hold.
+func formatCSV(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type jsonlEncoder struct {
+	enc     *json.Encoder
+	columns []string
+	types   []string
+}
+
+// Encode writes a row as a JSON object keyed by column name, on its own line.
+func (e *jsonlEncoder) Encode(row []any) error {
+	obj := make(map[string]any, len(row))
+	for i, v := range row {
+		// Drivers return text as bytes, which would otherwise be base64
+		// encoded, so only binary values are written in hex.
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+			if binaryValue(e.types[i], b) {
+				v = formatBytes(b)
+			}
+		}
+		obj[e.columns[i]] = v
+	}
+	return e.enc.Encode(obj)
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return nil
+}
+
+// formatBytes returns binary values in Postgres' bytea hex format, so they
+// survive being written to a text format.
+func formatBytes(b []byte) string {
+	return `\x` + hex.EncodeToString(b)
+}
+
+// binaryValue returns true if bytes read from a column of the given type are
+// a binary value, rather than text, which some drivers also return as bytes.
+// If the column's type isn't known, only bytes that aren't valid text are
+// taken to be binary.
+func binaryValue(typ string, b []byte) bool {
+	if typ == "" {
+		return !utf8.Valid(b)
+	}
+	return isBinary(typ)
+}
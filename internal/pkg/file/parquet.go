@@ -0,0 +1,624 @@
+package file
+
+import (
+	"ds/internal/pkg/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquet"
+	"github.com/fraugster/parquet-go/parquetschema"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultRowGroupSize is the number of rows in each row group of a Parquet
+// file, if the database doesn't configure one.
+const defaultRowGroupSize = 100000
+
+func init() {
+	goparquet.RegisterBlockCompressor(parquet.CompressionCodec_ZSTD, zstdCompressor{})
+}
+
+// zstdCompressor compresses the pages of Parquet files with Zstandard, which
+// the Parquet package leaves to its callers.
+type zstdCompressor struct{}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (zstdCompressor) CompressBlock(b []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(b, nil), nil
+}
+
+func (zstdCompressor) DecompressBlock(b []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(b, nil)
+}
+
+// parquetType is the type of a Parquet column, derived from the database type
+// of the source column or, failing that, the Go values read from it.
+type parquetType struct {
+	kind parquetKind
+
+	// precision and scale are the number of digits in a decimal column, and
+	// the number of those after the decimal point.
+	precision, scale int
+}
+
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetInt64
+	parquetDouble
+	parquetBoolean
+	parquetTimestamp
+	parquetBytes
+	parquetDate
+	parquetDecimal
+	parquetUUID
+	parquetJSON
+)
+
+// maxDecimalPrecision is the number of digits of the largest decimal column
+// that can be held in an INT64.
+const maxDecimalPrecision = 18
+
+// parquetTypeOf returns the type of column that holds the given value. Values
+// without a Parquet equivalent, such as numerics and UUIDs, are held as text.
+func parquetTypeOf(v any) parquetType {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return parquetType{kind: parquetInt64}
+	case float32, float64:
+		return parquetType{kind: parquetDouble}
+	case bool:
+		return parquetType{kind: parquetBoolean}
+	case time.Time:
+		return parquetType{kind: parquetTimestamp}
+	case []byte:
+		return parquetType{kind: parquetBytes}
+	default:
+		return parquetType{kind: parquetString}
+	}
+}
+
+// parquetTypeFor returns the type of column that holds values of the given
+// database type, as reported by Postgres' format_type function, and false if
+// the type isn't recognised. Numerics are held as decimals if they have a
+// precision that fits in an INT64, and as text otherwise.
+func parquetTypeFor(typ string) (parquetType, bool) {
+	var modifiers string
+	if i := strings.Index(typ, "("); i >= 0 && !strings.HasSuffix(typ, "[]") {
+		j := strings.Index(typ, ")")
+		typ, modifiers = typ[:i]+typ[j+1:], typ[i+1:j]
+	}
+
+	switch typ {
+	case "smallint", "integer", "bigint":
+		return parquetType{kind: parquetInt64}, true
+	case "real", "double precision":
+		return parquetType{kind: parquetDouble}, true
+	case "boolean":
+		return parquetType{kind: parquetBoolean}, true
+	case "timestamp without time zone", "timestamp with time zone":
+		return parquetType{kind: parquetTimestamp}, true
+	case "date":
+		return parquetType{kind: parquetDate}, true
+	case "bytea":
+		return parquetType{kind: parquetBytes}, true
+	case "uuid":
+		return parquetType{kind: parquetUUID}, true
+	case "json", "jsonb":
+		return parquetType{kind: parquetJSON}, true
+	case "numeric":
+		var precision, scale int
+		if _, err := fmt.Sscanf(modifiers, "%d,%d", &precision, &scale); err == nil && precision <= maxDecimalPrecision {
+			return parquetType{kind: parquetDecimal, precision: precision, scale: scale}, true
+		}
+		return parquetType{kind: parquetString}, true
+	case "text", "character varying", "character":
+		return parquetType{kind: parquetString}, true
+	default:
+		return parquetType{}, false
+	}
+}
+
+// element returns the schema element of an optional column of this type.
+func (t parquetType) element(name string) *parquet.SchemaElement {
+	e := &parquet.SchemaElement{
+		Name:           name,
+		RepetitionType: parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL),
+	}
+
+	switch t.kind {
+	case parquetInt64:
+		e.Type = parquet.TypePtr(parquet.Type_INT64)
+	case parquetDouble:
+		e.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+	case parquetBoolean:
+		e.Type = parquet.TypePtr(parquet.Type_BOOLEAN)
+	case parquetTimestamp:
+		e.Type = parquet.TypePtr(parquet.Type_INT64)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MICROS)
+		e.LogicalType = &parquet.LogicalType{TIMESTAMP: &parquet.TimestampType{
+			IsAdjustedToUTC: true,
+			Unit:            &parquet.TimeUnit{MICROS: parquet.NewMicroSeconds()},
+		}}
+	case parquetDate:
+		e.Type = parquet.TypePtr(parquet.Type_INT32)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_DATE)
+		e.LogicalType = &parquet.LogicalType{DATE: parquet.NewDateType()}
+	case parquetDecimal:
+		e.Type = parquet.TypePtr(parquet.Type_INT64)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_DECIMAL)
+		e.Precision = int32Ptr(int32(t.precision))
+		e.Scale = int32Ptr(int32(t.scale))
+		e.LogicalType = &parquet.LogicalType{DECIMAL: &parquet.DecimalType{
+			Precision: int32(t.precision),
+			Scale:     int32(t.scale),
+		}}
+	case parquetUUID:
+		e.Type = parquet.TypePtr(parquet.Type_FIXED_LEN_BYTE_ARRAY)
+		e.TypeLength = int32Ptr(16)
+		e.LogicalType = &parquet.LogicalType{UUID: parquet.NewUUIDType()}
+	case parquetJSON:
+		e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_JSON)
+		e.LogicalType = &parquet.LogicalType{JSON: parquet.NewJsonType()}
+	case parquetBytes:
+		e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+	default:
+		e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+		e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+		e.LogicalType = &parquet.LogicalType{STRING: parquet.NewStringType()}
+	}
+
+	return e
+}
+
+// value converts a Go value into a value of the column's type.
+func (t parquetType) value(v any) (any, error) {
+	switch t.kind {
+	case parquetInt64:
+		switch v := v.(type) {
+		case int:
+			return int64(v), nil
+		case int8:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case uint8:
+			return int64(v), nil
+		case uint16:
+			return int64(v), nil
+		case uint32:
+			return int64(v), nil
+		}
+	case parquetDouble:
+		switch v := v.(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case parquetBoolean:
+		if v, ok := v.(bool); ok {
+			return v, nil
+		}
+	case parquetTimestamp:
+		if v, ok := v.(time.Time); ok {
+			return v.UnixMicro(), nil
+		}
+	case parquetDate:
+		if v, ok := v.(time.Time); ok {
+			y, m, d := v.Date()
+			return int32(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)), nil
+		}
+	case parquetDecimal:
+		switch v := v.(type) {
+		case string, []byte, int64, float64:
+			return decimalValue(formatCSV(v), t.scale)
+		}
+	case parquetUUID:
+		switch v := v.(type) {
+		case [16]byte:
+			return v[:], nil
+		case string:
+			b, err := hex.DecodeString(strings.ReplaceAll(v, "-", ""))
+			if err != nil || len(b) != 16 {
+				return nil, fmt.Errorf("invalid uuid: %q", v)
+			}
+			return b, nil
+		}
+	case parquetJSON:
+		switch v := v.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	case parquetBytes:
+		if v, ok := v.([]byte); ok {
+			return v, nil
+		}
+	default:
+		return []byte(formatCSV(v)), nil
+	}
+
+	return nil, fmt.Errorf("unexpected %T value", v)
+}
+
+// decimalValue returns a decimal's digits as an integer, scaled so the last
+// scale of them are after the decimal point.
+func decimalValue(s string, scale int) (int64, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	r.Mul(r, new(big.Rat).SetInt(pow10(scale)))
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("decimal doesn't fit its column: %q", s)
+	}
+
+	return r.Num().Int64(), nil
+}
+
+// formatDecimal returns a decimal column's value as text.
+func formatDecimal(v int64, scale int32) string {
+	return new(big.Rat).SetFrac(big.NewInt(v), pow10(int(scale))).FloatString(int(scale))
+}
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// parquetEncoder writes rows to a Parquet file. The file's schema is derived
+// from the database types of the source's columns where they're known. Other
+// columns take their type from their first non-NULL value in the first row
+// group, so rows are buffered until it's full, and are held as text if
+// they're entirely NULL.
+type parquetEncoder struct {
+	w            io.Writer
+	columns      []string
+	sourceTypes  []string
+	codec        parquet.CompressionCodec
+	rowGroupSize int
+
+	fw      *goparquet.FileWriter
+	types   []parquetType
+	pending [][]any
+	rows    int
+	empty   bool
+}
+
+// newParquetEncoder returns a parquetEncoder for the given columns, whose
+// source database types are given by types, which may be nil if they're not
+// known.
+func newParquetEncoder(w io.Writer, columns, types []string, c model.Compression, rowGroupSize int) (*parquetEncoder, error) {
+	e := &parquetEncoder{
+		w:            w,
+		columns:      columns,
+		sourceTypes:  types,
+		rowGroupSize: rowGroupSize,
+	}
+
+	if e.rowGroupSize <= 0 {
+		e.rowGroupSize = defaultRowGroupSize
+	}
+
+	switch c {
+	case "", model.CompressionSnappy:
+		e.codec = parquet.CompressionCodec_SNAPPY
+	case model.CompressionGzip:
+		e.codec = parquet.CompressionCodec_GZIP
+	case model.CompressionZstd:
+		e.codec = parquet.CompressionCodec_ZSTD
+	case model.CompressionNone:
+		e.codec = parquet.CompressionCodec_UNCOMPRESSED
+	default:
+		return nil, fmt.Errorf("invalid compression: %q", c)
+	}
+
+	return e, nil
+}
+
+// Encode writes a row, or buffers it if the file's schema isn't known yet.
+func (e *parquetEncoder) Encode(row []any) error {
+	if e.fw != nil {
+		return e.write(row)
+	}
+
+	e.pending = append(e.pending, row)
+	if len(e.pending) < e.rowGroupSize {
+		return nil
+	}
+
+	return e.flushPending()
+}
+
+// Flush writes any buffered rows and the file's footer. The encoder can't be
+// used after it's flushed.
+func (e *parquetEncoder) Flush() error {
+	if err := e.flushPending(); err != nil {
+		return err
+	}
+
+	// The Parquet package only writes the file's leading magic number with its
+	// first row group, so it's written here for files without any rows.
+	if e.empty {
+		if _, err := io.WriteString(e.w, "PAR1"); err != nil {
+			return err
+		}
+	}
+
+	return e.fw.Close()
+}
+
+// flushPending creates the file's writer, if it hasn't been created yet, and
+// writes the buffered rows.
+func (e *parquetEncoder) flushPending() error {
+	if e.fw == nil {
+		e.empty = len(e.pending) == 0
+		e.open()
+	}
+
+	for _, row := range e.pending {
+		if err := e.write(row); err != nil {
+			return err
+		}
+	}
+	e.pending = nil
+
+	return nil
+}
+
+// open derives the file's schema from the source's column types and the
+// buffered rows, and creates its writer.
+func (e *parquetEncoder) open() {
+	root := &parquetschema.ColumnDefinition{
+		SchemaElement: &parquet.SchemaElement{Name: "row"},
+	}
+
+	e.types = make([]parquetType, len(e.columns))
+	for i, col := range e.columns {
+		var known bool
+		if i < len(e.sourceTypes) {
+			e.types[i], known = parquetTypeFor(e.sourceTypes[i])
+		}
+
+		for _, row := range e.pending {
+			if !known && row[i] != nil {
+				e.types[i] = parquetTypeOf(row[i])
+				break
+			}
+		}
+
+		root.Children = append(root.Children, &parquetschema.ColumnDefinition{
+			SchemaElement: e.types[i].element(col),
+		})
+	}
+
+	e.fw = goparquet.NewFileWriter(e.w,
+		goparquet.WithSchemaDefinition(parquetschema.SchemaDefinitionFromColumnDefinition(root)),
+		goparquet.WithCompressionCodec(e.codec),
+	)
+}
+
+// write adds a row to the current row group, completing the row group once
+// it's full.
+func (e *parquetEncoder) write(row []any) error {
+	data := make(map[string]any, len(row))
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+
+		value, err := e.types[i].value(v)
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", e.columns[i], err)
+		}
+		data[e.columns[i]] = value
+	}
+
+	if err := e.fw.AddData(data); err != nil {
+		return err
+	}
+
+	if e.rows++; e.rows >= e.rowGroupSize {
+		e.rows = 0
+		return e.fw.FlushRowGroup()
+	}
+
+	return nil
+}
+
+// parquetDecoder reads rows from a Parquet file, mapping its columns onto the
+// table's columns by name.
+type parquetDecoder struct {
+	r       *goparquet.FileReader
+	columns []*goparquet.Column
+
+	// groups holds the number of rows in each of the file's row groups, and
+	// row the number of rows read from the file.
+	groups []int64
+	row    int64
+	done   bool
+}
+
+func newParquetDecoder(r io.ReadSeeker, columns []string) (*parquetDecoder, error) {
+	meta, err := goparquet.ReadFileMetaData(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("reading parquet metadata: %w", err)
+	}
+
+	fr, err := goparquet.NewFileReader(r, columns...)
+	if err != nil {
+		return nil, fmt.Errorf("opening parquet file: %w", err)
+	}
+
+	d := &parquetDecoder{
+		r:       fr,
+		columns: make([]*goparquet.Column, len(columns)),
+		groups:  make([]int64, len(meta.RowGroups)),
+	}
+
+	for i, col := range columns {
+		if d.columns[i] = fr.GetColumnByName(col); d.columns[i] == nil {
+			return nil, fmt.Errorf("missing column in schema: %s", col)
+		}
+	}
+
+	for i, g := range meta.RowGroups {
+		d.groups[i] = g.NumRows
+	}
+
+	return d, nil
+}
+
+// Decode reads a row, converting each value into a Go value of its column's
+// type. Text columns are returned as strings, so they can be parsed by the
+// target column's type.
+func (d *parquetDecoder) Decode() ([]any, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	data, err := d.r.NextRow()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	d.row++
+
+	values := make([]any, len(d.columns))
+	for i, col := range d.columns {
+		v, ok := data[col.Name()]
+		if !ok || v == nil {
+			continue
+		}
+
+		if values[i], err = parquetValue(col.Element(), v); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", col.Name(), err)
+		}
+	}
+
+	return values, nil
+}
+
+// Offset returns the number of rows read from the file.
+func (d *parquetDecoder) Offset() int64 {
+	return d.row
+}
+
+// seek skips past the given number of rows. Row groups before the one holding
+// the next row are skipped without being read, so only the rows before it in
+// its own row group are decoded.
+func (d *parquetDecoder) seek(rows int64) error {
+	group, skip := 0, rows
+	for group < len(d.groups) && skip >= d.groups[group] {
+		skip -= d.groups[group]
+		group++
+	}
+
+	d.row = rows
+	if group == len(d.groups) {
+		d.done = skip == 0
+		if !d.done {
+			return fmt.Errorf("file has fewer than %d rows", rows)
+		}
+		return nil
+	}
+
+	// The reader numbers row groups from one.
+	if err := d.r.SeekToRowGroup(group + 1); err != nil {
+		return fmt.Errorf("seeking to row group %d: %w", group, err)
+	}
+
+	for ; skip > 0; skip-- {
+		if _, err := d.r.NextRow(); err != nil {
+			return fmt.Errorf("skipping rows: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// parquetValue converts a Parquet value into a Go value, based on its
+// column's logical type.
+func parquetValue(e *parquet.SchemaElement, v any) (any, error) {
+	logical := e.GetLogicalType()
+	converted := func(t parquet.ConvertedType) bool {
+		return e.ConvertedType != nil && *e.ConvertedType == t
+	}
+
+	// Decimals are returned as text, so they can be parsed by the target
+	// column's type.
+	decimal := (logical != nil && logical.DECIMAL != nil) || converted(parquet.ConvertedType_DECIMAL)
+
+	switch v := v.(type) {
+	case bool, float64, string:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int32:
+		if decimal {
+			return formatDecimal(int64(v), e.GetScale()), nil
+		}
+		if (logical != nil && logical.DATE != nil) || converted(parquet.ConvertedType_DATE) {
+			return time.Unix(int64(v)*24*60*60, 0).UTC(), nil
+		}
+		return int64(v), nil
+	case int64:
+		if decimal {
+			return formatDecimal(v, e.GetScale()), nil
+		}
+		if logical != nil && logical.TIMESTAMP != nil {
+			switch unit := logical.TIMESTAMP.Unit; {
+			case unit.IsSetMILLIS():
+				return time.UnixMilli(v).UTC(), nil
+			case unit.IsSetNANOS():
+				return time.Unix(0, v).UTC(), nil
+			default:
+				return time.UnixMicro(v).UTC(), nil
+			}
+		}
+		if converted(parquet.ConvertedType_TIMESTAMP_MILLIS) {
+			return time.UnixMilli(v).UTC(), nil
+		}
+		if converted(parquet.ConvertedType_TIMESTAMP_MICROS) {
+			return time.UnixMicro(v).UTC(), nil
+		}
+		return v, nil
+	case [12]byte:
+		return goparquet.Int96ToTime(v).UTC(), nil
+	case []byte:
+		if logical != nil && logical.UUID != nil && len(v) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16]), nil
+		}
+		if (logical != nil && (logical.STRING != nil || logical.JSON != nil || logical.ENUM != nil)) ||
+			converted(parquet.ConvertedType_UTF8) || converted(parquet.ConvertedType_JSON) || converted(parquet.ConvertedType_ENUM) {
+			return string(v), nil
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported parquet value: %T", v)
+	}
+}
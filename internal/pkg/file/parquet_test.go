@@ -0,0 +1,171 @@
+package file
+
+import (
+	"ds/internal/pkg/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	at := time.Date(2023, 1, 2, 3, 4, 5, 678000, time.UTC)
+	rows := [][]any{
+		{int64(1), "alice", nil, at, true, 1.5, []byte{0, 1}, "12.50"},
+		{int32(2), nil, nil, nil, false, nil, nil, "3"},
+		{int64(3), "carol", nil, at.Add(time.Hour), nil, float64(-2), []byte{}, nil},
+	}
+	columns := []string{"id", "name", "nickname", "created_at", "active", "score", "data", "balance"}
+	table := model.Table{Name: "person", Columns: []model.Column{
+		{Name: "balance"}, {Name: "id"}, {Name: "name"}, {Name: "nickname"},
+		{Name: "created_at"}, {Name: "active"}, {Name: "score"}, {Name: "data"},
+	}}
+
+	compressions := []model.Compression{"", model.CompressionNone, model.CompressionGzip, model.CompressionZstd}
+
+	for _, compression := range compressions {
+		t.Run(string(compression), func(t *testing.T) {
+			dir := t.TempDir()
+			d := model.Database{Driver: model.DriverParquet, Path: dir, Compression: compression, RowGroupSize: 2, RowsPerFile: 2}
+
+			w, err := NewWriter(d, personTable(columns...), false, 0, nil)
+			assert.Nil(t, err)
+			for _, row := range rows {
+				assert.Nil(t, w.Write(row))
+			}
+			assert.Nil(t, w.Close())
+			assertNoTempFiles(t, dir)
+
+			// Parquet files are never given a compression extension.
+			_, err = os.Stat(filepath.Join(dir, "person-0000000002.parquet"))
+			assert.Nil(t, err)
+
+			// Columns are read by name, in the table's order, and text is
+			// parsed by the target column's type.
+			r, err := NewReader(d, table, []string{"numeric", "bigint", "text", "text", "timestamp", "boolean", "double precision", "bytea"})
+			assert.Nil(t, err)
+			defer r.Close()
+
+			act := readAll(t, r)
+			assert.Len(t, act, 3)
+			assert.Equal(t, []any{int64(1), "alice", nil, at, true, 1.5, []byte{0, 1}}, act[0][1:])
+			assert.Equal(t, []any{int64(2), nil, nil, nil, false, nil, nil}, act[1][1:])
+			assert.Equal(t, []any{int64(3), "carol", nil, at.Add(time.Hour), nil, float64(-2), []byte{}}, act[2][1:])
+			assert.Nil(t, act[2][0])
+			assert.Nil(t, r.Close())
+
+			r, err = NewReader(d, table, nil)
+			assert.Nil(t, err)
+			defer r.Close()
+			assert.Nil(t, r.Skip(1))
+			assert.Equal(t, "3", readAll(t, r)[0][0])
+		})
+	}
+}
+
+func TestParquetSourceTypes(t *testing.T) {
+	on := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	rows := [][]any{
+		{nil, "12.50", "bc229cee-5387-4c36-b83e-7a46613071de", on, []byte(`{"a":1}`), "alice"},
+		{nil, "-3", nil, nil, nil, nil},
+	}
+	columns := []string{"parent_id", "balance", "uuid", "born_on", "data", "name"}
+	types := []string{"bigint", "numeric(10,2)", "uuid", "date", "jsonb", "character varying(255)"}
+
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverParquet, Path: dir, RowsPerFile: model.SingleFile}
+
+	w, err := NewWriter(d, personTable(columns...), false, 0, types)
+	assert.Nil(t, err)
+	for _, row := range rows {
+		assert.Nil(t, w.Write(row))
+	}
+	assert.Nil(t, w.Close())
+
+	f, err := os.Open(filepath.Join(dir, "person.parquet"))
+	assert.Nil(t, err)
+	defer f.Close()
+
+	fr, err := goparquet.NewFileReader(f)
+	assert.Nil(t, err)
+
+	// Columns take their types from the source, even if they're entirely
+	// NULL.
+	element := func(col string) *parquet.SchemaElement {
+		return fr.GetColumnByName(col).Element()
+	}
+	assert.Equal(t, parquet.Type_INT64, element("parent_id").GetType())
+	assert.Equal(t, parquet.Type_INT64, element("balance").GetType())
+	assert.Equal(t, int32(10), element("balance").GetLogicalType().DECIMAL.Precision)
+	assert.Equal(t, int32(2), element("balance").GetLogicalType().DECIMAL.Scale)
+	assert.Equal(t, parquet.Type_FIXED_LEN_BYTE_ARRAY, element("uuid").GetType())
+	assert.NotNil(t, element("uuid").GetLogicalType().UUID)
+	assert.NotNil(t, element("born_on").GetLogicalType().DATE)
+	assert.NotNil(t, element("data").GetLogicalType().JSON)
+	assert.NotNil(t, element("name").GetLogicalType().STRING)
+
+	r, err := NewReader(d, personTable(columns...), nil)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, [][]any{
+		{nil, "12.50", "bc229cee-5387-4c36-b83e-7a46613071de", on, `{"a":1}`, "alice"},
+		{nil, "-3.00", nil, nil, nil, nil},
+	}, readAll(t, r))
+}
+
+func TestParquetInvalidDecimal(t *testing.T) {
+	d := model.Database{Driver: model.DriverParquet, Path: t.TempDir()}
+
+	w, err := NewWriter(d, personTable("balance"), false, 0, []string{"numeric(4,2)"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write([]any{"1.234"}))
+	assert.EqualError(t, w.Close(), `flushing file: encoding balance: decimal doesn't fit its column: "1.234"`)
+}
+
+func TestParquetMixedTypes(t *testing.T) {
+	d := model.Database{Driver: model.DriverParquet, Path: t.TempDir()}
+
+	w, err := NewWriter(d, personTable("id"), false, 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write([]any{int64(1)}))
+	assert.Nil(t, w.Write([]any{"2"}))
+	assert.EqualError(t, w.Close(), "flushing file: encoding id: unexpected string value")
+	assertNoTempFiles(t, d.Path)
+}
+
+func TestParquetMissingColumn(t *testing.T) {
+	d := model.Database{Driver: model.DriverParquet, Path: t.TempDir()}
+
+	w, err := NewWriter(d, personTable("id"), false, 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write([]any{int64(1)}))
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(d, model.Table{Name: "person", Columns: []model.Column{{Name: "id"}, {Name: "name"}}}, nil)
+	assert.Nil(t, err)
+	_, err = r.Read()
+	assert.ErrorContains(t, err, "missing column in schema: name")
+}
+
+func TestNewWriterSnappyCompression(t *testing.T) {
+	_, err := NewWriter(model.Database{Driver: model.DriverCSV, Path: t.TempDir(), Compression: model.CompressionSnappy}, personTable(), false, 0, nil)
+	assert.EqualError(t, err, "snappy compression is only supported for parquet files")
+}
+
+func TestParquetEmptyTable(t *testing.T) {
+	d := model.Database{Driver: model.DriverParquet, Path: t.TempDir()}
+
+	w, err := NewWriter(d, personTable("id", "name"), false, 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(d, model.Table{Name: "person", Columns: []model.Column{{Name: "id"}, {Name: "name"}}}, nil)
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Empty(t, readAll(t, r))
+}
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// timeLayouts are the layouts accepted for date and timestamp values, in the
+// order they're tried.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseValue parses a value read from a file into a Go value that can be
+// written to a column of the given type, as reported by Postgres' format_type
+// function (e.g. "bigint" or "timestamp with time zone"). Values for types
+// that aren't recognised are left as strings, for the database to parse.
+func parseValue(typ, s string) (any, error) {
+	// Strip modifiers, such as the precision in "numeric(10,2)".
+	if i := strings.Index(typ, "("); i >= 0 && !strings.HasSuffix(typ, "[]") {
+		typ = typ[:i] + typ[strings.Index(typ, ")")+1:]
+	}
+
+	switch typ {
+	case "smallint", "integer", "bigint":
+		return strconv.ParseInt(s, 10, 64)
+
+	case "real", "double precision":
+		return strconv.ParseFloat(s, 64)
+
+	case "numeric":
+		var n pgtype.Numeric
+		if err := n.Scan(s); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case "boolean":
+		return strconv.ParseBool(s)
+
+	case "uuid":
+		var u pgtype.UUID
+		if err := u.Scan(s); err != nil {
+			return nil, err
+		}
+		return u, nil
+
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		return parseTime(s)
+
+	case "bytea":
+		return parseBytes(s)
+
+	default:
+		return s, nil
+	}
+}
+
+// parseBytes parses a bytea value, which is either in Postgres' hex format, as
+// binary values are written to JSONL files, or the bytes themselves.
+func parseBytes(s string) ([]byte, error) {
+	if h, ok := strings.CutPrefix(s, `\x`); ok {
+		return hex.DecodeString(h)
+	}
+	return []byte(s), nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", s)
+}
+
+// isJSON returns true if a column of the given type holds JSON, in which case
+// JSON values are passed through as they appear in JSONL files.
+func isJSON(typ string) bool {
+	return typ == "json" || typ == "jsonb"
+}
+
+// isBinary returns true if a column of the given type holds binary values,
+// rather than text.
+func isBinary(typ string) bool {
+	return typ == "bytea" || strings.Contains(typ, "blob") || strings.Contains(typ, "binary")
+}
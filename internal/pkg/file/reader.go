@@ -0,0 +1,326 @@
+package file
+
+import (
+	"compress/gzip"
+	"ds/internal/pkg/model"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samber/lo"
+)
+
+// Reader reads a table's rows from one or more files in turn, returning each
+// row's values in the order of the table's columns.
+type Reader struct {
+	driver  string
+	null    string
+	files   []string
+	columns []string
+	types   []string
+
+	f   *os.File
+	r   io.ReadCloser
+	dec decoder
+	pos Position
+}
+
+// Position is a point in a table's files that a Reader can resume from.
+type Position struct {
+	// File is the file holding the last row read.
+	File string `json:"file"`
+
+	// Offset is the position of the next row in the file: its byte offset in
+	// the decompressed contents of text files, or the number of rows before it
+	// in Parquet files.
+	Offset int64 `json:"offset"`
+
+	// Row is the number of the table's rows before the position.
+	Row int `json:"row"`
+}
+
+// Files returns the files holding a table's rows, sorted by name. A table's
+// file may be a path or glob relative to the database's path; if it's not
+// configured, the files written by an export of the table are used.
+func Files(d model.Database, t model.Table) ([]string, error) {
+	patterns := []string{t.File}
+	if t.File == "" {
+		patterns = []string{
+			fmt.Sprintf("%s.%s*", t.Name, d.Driver),
+			fmt.Sprintf("%s-*.%s*", t.Name, d.Driver),
+		}
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(d.Path, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("matching files: %w", err)
+		}
+		files = append(files, matches...)
+	}
+
+	// Ignore files that were still being written when an export stopped.
+	files = lo.Filter(lo.Uniq(files), func(f string, _ int) bool {
+		return !strings.HasSuffix(f, ".tmp")
+	})
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found for %s", t.Name)
+	}
+
+	return files, nil
+}
+
+// NewReader returns a Reader for the files of the given table. If types are
+// provided, they're the database types of the table's columns, and each value
+// read as a string is parsed into a Go value of the matching type; otherwise
+// values are returned as they're read.
+func NewReader(d model.Database, t model.Table, types []string) (*Reader, error) {
+	files, err := Files(d, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		driver:  d.Driver,
+		null:    d.Null(),
+		files:   files,
+		columns: t.ColumnNames(),
+		types:   types,
+	}, nil
+}
+
+// Read returns the next row, or io.EOF once every file has been read.
+func (r *Reader) Read() ([]any, error) {
+	raw, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range raw {
+		s, ok := v.(string)
+		if !ok || r.types == nil {
+			continue
+		}
+
+		if raw[i], err = parseValue(r.types[i], s); err != nil {
+			return nil, fmt.Errorf("parsing %s in %s: %w", r.columns[i], r.f.Name(), err)
+		}
+	}
+
+	return raw, nil
+}
+
+// ReadStatement returns the next statement of a table's SQL files, or io.EOF
+// once every file has been read.
+func (r *Reader) ReadStatement() (Statement, error) {
+	row, err := r.next()
+	if err != nil {
+		return Statement{}, err
+	}
+
+	stmt, ok := row[0].(Statement)
+	if !ok {
+		return Statement{}, fmt.Errorf("%s files don't hold statements", r.driver)
+	}
+	return stmt, nil
+}
+
+// Position returns the position after the last row read, which Seek resumes
+// from.
+func (r *Reader) Position() Position {
+	return r.pos
+}
+
+// Seek moves a new reader to a position returned by Position. Files before the
+// position's file are skipped without being opened, and the zero Position is
+// the start of the first file. Uncompressed text files
+// are read from the position's byte offset and compressed ones are
+// decompressed up to it, rather than having their rows decoded, and Parquet
+// files skip the row groups before it.
+func (r *Reader) Seek(pos Position) error {
+	if pos.File == "" {
+		return nil
+	}
+
+	i := slices.Index(r.files, pos.File)
+	if i < 0 {
+		return fmt.Errorf("missing file %s", pos.File)
+	}
+
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", r.pos.File, err)
+	}
+
+	if err := r.open(pos.File); err != nil {
+		return err
+	}
+	r.files = r.files[i+1:]
+
+	if err := r.seek(pos.Offset); err != nil {
+		r.Close()
+		return fmt.Errorf("seeking in %s: %w", pos.File, err)
+	}
+
+	r.pos = pos
+	return nil
+}
+
+// seek moves the open file's decoder to the given offset.
+func (r *Reader) seek(offset int64) error {
+	if dec, ok := r.dec.(*parquetDecoder); ok {
+		return dec.seek(offset)
+	}
+
+	dec, ok := r.dec.(resumer)
+	if !ok {
+		return fmt.Errorf("%s files can't be resumed", r.driver)
+	}
+
+	if !compressed(r.f.Name()) {
+		if _, err := r.f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		dec.resume(r.f, offset)
+		return nil
+	}
+
+	// Compressed streams can't be seeked, so the file is decompressed again
+	// from the start and discarded up to the offset.
+	r.r.Close()
+	if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var err error
+	if r.r, err = decompress(r.f, r.f.Name()); err != nil {
+		r.r = io.NopCloser(r.f)
+		return fmt.Errorf("creating decompressor: %w", err)
+	}
+
+	if _, err = io.CopyN(io.Discard, r.r, offset); err != nil {
+		return err
+	}
+	dec.resume(r.r, offset)
+
+	return nil
+}
+
+// Skip skips past the given number of rows without parsing them, returning
+// io.EOF if there are fewer rows than that.
+func (r *Reader) Skip(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (r *Reader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	r.r.Close()
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// next decodes the next row, moving on to the next file when the current one
+// has been read.
+func (r *Reader) next() ([]any, error) {
+	for {
+		if r.f == nil {
+			if len(r.files) == 0 {
+				return nil, io.EOF
+			}
+
+			if err := r.open(r.files[0]); err != nil {
+				return nil, err
+			}
+			r.files = r.files[1:]
+		}
+
+		raw, err := r.dec.Decode()
+		if err == nil {
+			r.pos = Position{File: r.f.Name(), Offset: r.dec.Offset(), Row: r.pos.Row + 1}
+			return raw, nil
+		}
+
+		name := r.f.Name()
+		if closeErr := r.Close(); closeErr != nil {
+			return nil, fmt.Errorf("closing %s: %w", name, closeErr)
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+}
+
+func (r *Reader) open(path string) (err error) {
+	if r.f, err = os.Open(path); err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	// Parquet files are read by random access and decompress their own pages.
+	if r.driver == model.DriverParquet {
+		r.r = io.NopCloser(r.f)
+		if r.dec, err = newParquetDecoder(r.f, r.columns); err != nil {
+			r.Close()
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if r.r, err = decompress(r.f, path); err != nil {
+		r.f.Close()
+		r.f = nil
+		return fmt.Errorf("creating decompressor for %s: %w", path, err)
+	}
+
+	if r.dec, err = newDecoder(r.driver, r.r, r.columns, r.types, r.null); err != nil {
+		r.Close()
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// compressed reports whether a file is compressed, based on its extension.
+func compressed(path string) bool {
+	switch filepath.Ext(path) {
+	case model.CompressionGzip.Extension(), model.CompressionZstd.Extension():
+		return true
+	default:
+		return false
+	}
+}
+
+// decompress returns a reader that decompresses the file, based on its
+// extension.
+func decompress(f io.Reader, path string) (io.ReadCloser, error) {
+	switch filepath.Ext(path) {
+	case model.CompressionGzip.Extension():
+		return gzip.NewReader(f)
+	case model.CompressionZstd.Extension():
+		dec, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return io.NopCloser(f), nil
+	}
+}
@@ -0,0 +1,291 @@
+package file
+
+import (
+	"compress/gzip"
+	"ds/internal/pkg/model"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person-1.csv"), "name,id,ignored\nalice,1,x\n\\N,2,y\n")
+	writeGzipFile(t, filepath.Join(dir, "person-2.csv.gz"), "id,name\n3,carol\n")
+
+	// Files that were still being written are ignored.
+	writeFile(t, filepath.Join(dir, "person-3.csv.tmp"), "id,name\n4,dave\n")
+
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+	table := model.Table{Name: "person", Columns: []model.Column{{Name: "id"}, {Name: "name"}}}
+
+	r, err := NewReader(d, table, nil)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, [][]any{
+		{"1", "alice"},
+		{"2", nil},
+		{"3", "carol"},
+	}, readAll(t, r))
+}
+
+func TestReaderCSVNulls(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person.csv"), "id,name\n1,\n2,\\N\n")
+
+	table := model.Table{Name: "person", Columns: []model.Column{{Name: "id"}, {Name: "name"}}}
+
+	cases := []struct {
+		name       string
+		nullString *string
+		exp        [][]any
+	}{
+		{name: "default", exp: [][]any{{"1", ""}, {"2", nil}}},
+		{name: "empty null_string", nullString: lo.ToPtr(""), exp: [][]any{{"1", nil}, {"2", `\N`}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewReader(model.Database{Driver: model.DriverCSV, Path: dir, NullString: c.nullString}, table, nil)
+			assert.Nil(t, err)
+			defer r.Close()
+
+			assert.Equal(t, c.exp, readAll(t, r))
+		})
+	}
+}
+
+func TestReaderJSONL(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "events.jsonl"), `{"id":1,"at":"2023-01-02T03:04:05Z","data":{"a":1},"ok":true,"note":"hi"}
+{"id":2,"at":"2023-01-02","data":"s","ok":false}
+`)
+
+	d := model.Database{Driver: model.DriverJSONL, Path: dir}
+	table := model.Table{Name: "events", Columns: []model.Column{{Name: "id"}, {Name: "at"}, {Name: "data"}, {Name: "ok"}, {Name: "note"}}}
+	types := []string{"bigint", "timestamp with time zone", "jsonb", "boolean", "character varying(10)"}
+
+	r, err := NewReader(d, table, types)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, [][]any{
+		{int64(1), time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), `{"a":1}`, true, "hi"},
+		{int64(2), time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), `"s"`, false, nil},
+	}, readAll(t, r))
+}
+
+func TestReaderSkip(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person-1.csv"), "id\n1\n2\n")
+	writeFile(t, filepath.Join(dir, "person-2.csv"), "id\n3\n4\n")
+
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+	table := model.Table{Name: "person", Columns: []model.Column{{Name: "id"}}}
+
+	r, err := NewReader(d, table, []string{"integer"})
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Nil(t, r.Skip(3))
+	assert.Equal(t, [][]any{{int64(4)}}, readAll(t, r))
+	assert.Equal(t, io.EOF, r.Skip(1))
+}
+
+func TestReaderSeek(t *testing.T) {
+	cases := []struct {
+		name        string
+		driver      string
+		compression model.Compression
+	}{
+		{name: "csv", driver: model.DriverCSV},
+		{name: "gzip csv", driver: model.DriverCSV, compression: model.CompressionGzip},
+		{name: "jsonl", driver: model.DriverJSONL},
+		{name: "zstd jsonl", driver: model.DriverJSONL, compression: model.CompressionZstd},
+		{name: "parquet", driver: model.DriverParquet},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := model.Database{Driver: c.driver, Path: t.TempDir(), Compression: c.compression, RowsPerFile: 3, RowGroupSize: 2}
+			table := personTable("id", "name")
+
+			w, err := NewWriter(d, table, false, 0, nil)
+			assert.Nil(t, err)
+			for i := int64(1); i <= 5; i++ {
+				assert.Nil(t, w.Write([]any{i, fmt.Sprintf("person %d", i)}))
+			}
+			assert.Nil(t, w.Close())
+
+			r, err := NewReader(d, table, []string{"bigint", "text"})
+			assert.Nil(t, err)
+			defer r.Close()
+
+			// Resuming from the position after each row reads the rest.
+			rows := [][]any{}
+			positions := []Position{r.Position()}
+			for {
+				row, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				assert.Nil(t, err)
+				rows = append(rows, row)
+				positions = append(positions, r.Position())
+			}
+			assert.Len(t, rows, 5)
+
+			for i, pos := range positions {
+				assert.Equal(t, i, pos.Row)
+
+				resumed, err := NewReader(d, table, []string{"bigint", "text"})
+				assert.Nil(t, err)
+				assert.Nil(t, resumed.Seek(pos))
+
+				assert.Equal(t, rows[i:], append([][]any{}, readAll(t, resumed)...))
+				assert.Equal(t, positions[len(positions)-1], resumed.Position())
+				assert.Nil(t, resumed.Close())
+			}
+		})
+	}
+}
+
+func TestReaderSeekSkipsRows(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person-1.csv"), "id\n1\n")
+	writeFile(t, filepath.Join(dir, "person-2.csv"), "id\n\\xzz\n3\n")
+
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+	table := model.Table{Name: "person", Columns: []model.Column{{Name: "id"}}}
+
+	// Rows before the position aren't decoded, so an invalid one is never
+	// reached.
+	r, err := NewReader(d, table, nil)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Nil(t, r.Seek(Position{File: filepath.Join(dir, "person-2.csv"), Offset: 8, Row: 2}))
+	assert.Equal(t, [][]any{{"3"}}, readAll(t, r))
+
+	r, err = NewReader(d, table, nil)
+	assert.Nil(t, err)
+	assert.EqualError(t, r.Seek(Position{File: filepath.Join(dir, "person-3.csv")}), "missing file "+filepath.Join(dir, "person-3.csv"))
+}
+
+func TestReaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person.csv"), "id\nabc\n")
+	writeFile(t, filepath.Join(dir, "pet.csv"), "name\nrex\n")
+
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+
+	_, err := NewReader(d, model.Table{Name: "missing"}, nil)
+	assert.EqualError(t, err, "no files found for missing")
+
+	r, err := NewReader(d, model.Table{Name: "person", Columns: []model.Column{{Name: "id"}}}, []string{"bigint"})
+	assert.Nil(t, err)
+	_, err = r.Read()
+	assert.ErrorContains(t, err, "parsing id in "+filepath.Join(dir, "person.csv"))
+	r.Close()
+
+	r, err = NewReader(d, model.Table{Name: "pet", Columns: []model.Column{{Name: "id"}}}, nil)
+	assert.Nil(t, err)
+	_, err = r.Read()
+	assert.ErrorContains(t, err, "missing column in header: id")
+	r.Close()
+
+	writeFile(t, filepath.Join(dir, "photo.csv"), "data\n\\xzz\n")
+	r, err = NewReader(d, model.Table{Name: "photo", Columns: []model.Column{{Name: "data"}}}, nil)
+	assert.Nil(t, err)
+	_, err = r.Read()
+	assert.ErrorContains(t, err, "decoding binary value")
+	r.Close()
+}
+
+func TestParseValue(t *testing.T) {
+	var n pgtype.Numeric
+	assert.Nil(t, n.Scan("1.50"))
+
+	var u pgtype.UUID
+	assert.Nil(t, u.Scan("bc229cee-5387-4c36-b83e-7a46613071de"))
+
+	cases := []struct {
+		name   string
+		typ    string
+		value  string
+		exp    any
+		expErr bool
+	}{
+		{name: "bigint", typ: "bigint", value: "42", exp: int64(42)},
+		{name: "invalid integer", typ: "integer", value: "4.2", expErr: true},
+		{name: "double", typ: "double precision", value: "4.2", exp: 4.2},
+		{name: "numeric", typ: "numeric(10,2)", value: "1.50", exp: n},
+		{name: "boolean", typ: "boolean", value: "true", exp: true},
+		{name: "uuid", typ: "uuid", value: "bc229cee-5387-4c36-b83e-7a46613071de", exp: u},
+		{name: "date", typ: "date", value: "2023-01-02", exp: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "timestamp", typ: "timestamp(6) without time zone", value: "2023-01-02 03:04:05", exp: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "timestamptz", typ: "timestamp with time zone", value: "2023-01-02T03:04:05Z", exp: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "invalid time", typ: "date", value: "yesterday", expErr: true},
+		{name: "bytea", typ: "bytea", value: "abc", exp: []byte("abc")},
+		{name: "bytea hex", typ: "bytea", value: `\xff00`, exp: []byte{0xff, 0x00}},
+		{name: "invalid bytea hex", typ: "bytea", value: `\xzz`, expErr: true},
+		{name: "text", typ: "text", value: "abc", exp: "abc"},
+		{name: "array", typ: "integer[]", value: "{1,2}", exp: "{1,2}"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := parseValue(c.typ, c.value)
+			if c.expErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func readAll(t *testing.T, r *Reader) [][]any {
+	var rows [][]any
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("error reading row: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+}
+
+func writeGzipFile(t *testing.T, path, content string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	defer f.Close()
+
+	w := gzip.NewWriter(f)
+	if _, err = w.Write([]byte(content)); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error closing file: %v", err)
+	}
+}
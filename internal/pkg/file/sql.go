@@ -0,0 +1,293 @@
+package file
+
+import (
+	"bufio"
+	"ds/internal/pkg/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// rowsComment precedes each statement in a SQL file, recording the number of
+// rows it writes.
+const rowsComment = "-- rows: "
+
+// Statement is a single statement read from a SQL file.
+type Statement struct {
+	// SQL is the statement to execute.
+	SQL string
+
+	// Data holds the rows of a COPY FROM STDIN statement, in Postgres' text
+	// format, or is nil for other statements.
+	Data []byte
+
+	// Rows is the number of rows the statement writes, if known.
+	Rows int
+}
+
+// sqlEncoder writes rows to a SQL file, grouping each batch of rows into a
+// single statement that can be replayed by psql or ds apply. Every statement
+// is written on its own lines, with newlines in values escaped, so statements
+// can be read back a line at a time.
+type sqlEncoder struct {
+	w      *bufio.Writer
+	t      model.Table
+	format model.SQLFormat
+	upsert bool
+	rows   [][]any
+}
+
+func newSQLEncoder(w io.Writer, t model.Table, format model.SQLFormat, upsert bool) (*sqlEncoder, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	if upsert && format == model.SQLFormatCopy {
+		return nil, fmt.Errorf("%s sql format doesn't support upserts", format)
+	}
+
+	e := &sqlEncoder{
+		w:      bufio.NewWriter(w),
+		t:      t,
+		format: format,
+		upsert: upsert,
+	}
+
+	if _, err := fmt.Fprintf(e.w, "-- %s\n", t.Name); err != nil {
+		return nil, fmt.Errorf("writing header: %w", err)
+	}
+
+	return e, nil
+}
+
+// Encode adds a row to the current statement.
+func (e *sqlEncoder) Encode(row []any) error {
+	e.rows = append(e.rows, row)
+	return nil
+}
+
+// EndBatch writes the current statement.
+func (e *sqlEncoder) EndBatch() error {
+	if len(e.rows) == 0 {
+		return nil
+	}
+
+	stmt, err := e.statement()
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(e.w, "%s%d\n%s\n", rowsComment, len(e.rows), stmt); err != nil {
+		return err
+	}
+
+	e.rows = e.rows[:0]
+	return nil
+}
+
+func (e *sqlEncoder) Flush() error {
+	if err := e.EndBatch(); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *sqlEncoder) statement() (string, error) {
+	columns := strings.Join(e.t.ColumnNames(), ", ")
+
+	if e.format == model.SQLFormatCopy {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "COPY %s (%s) FROM STDIN;\n", e.t.Name, columns)
+		for _, row := range e.rows {
+			for i, v := range row {
+				if i > 0 {
+					sb.WriteByte('\t')
+				}
+				sb.WriteString(formatCopy(v))
+			}
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(`\.`)
+		return sb.String(), nil
+	}
+
+	values := make([]string, len(e.rows))
+	for i, row := range e.rows {
+		literals := make([]string, len(row))
+		for j, v := range row {
+			literals[j] = formatSQL(v)
+		}
+		values[i] = "(" + strings.Join(literals, ", ") + ")"
+	}
+	params := strings.Join(values, ", ")
+
+	if !e.upsert {
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;", e.t.Name, columns, params), nil
+	}
+
+	stmt, err := e.t.UpsertValuesStatement(params)
+	if err != nil {
+		return "", fmt.Errorf("generating upsert statement: %w", err)
+	}
+	return stmt + ";", nil
+}
+
+// formatSQL returns a value as a SQL literal. Strings containing backslashes
+// or line breaks are written as escape strings, so they fit on one line, and
+// bytes that aren't valid text are written as bytea hex literals.
+func formatSQL(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return formatFloat(float64(v))
+	case float64:
+		return formatFloat(v)
+	case []byte:
+		if !utf8.Valid(v) {
+			return `'\x` + hex.EncodeToString(v) + `'`
+		}
+		return quoteSQL(string(v))
+	default:
+		return quoteSQL(formatCSV(v))
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return quoteSQL(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var sqlEscaper = strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\r", `\r`)
+
+func quoteSQL(s string) string {
+	if strings.ContainsAny(s, "\\\n\r") {
+		return "E'" + sqlEscaper.Replace(s) + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// formatCopy returns a value in Postgres' COPY text format.
+func formatCopy(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return `\N`
+	case []byte:
+		if !utf8.Valid(v) {
+			return `\\x` + hex.EncodeToString(v)
+		}
+		return copyEscaper.Replace(string(v))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return copyEscaper.Replace(formatCSV(v))
+	}
+}
+
+// sqlDecoder reads the statements of a SQL file. Comments and blank lines
+// between statements are skipped, statements end with a line ending in a
+// semicolon, and the rows of COPY FROM STDIN statements end with a line
+// holding only "\.".
+type sqlDecoder struct {
+	r *bufio.Reader
+	n int64
+}
+
+// Offset returns the byte offset of the end of the last statement read.
+func (d *sqlDecoder) Offset() int64 {
+	return d.n
+}
+
+// Decode reads a statement, returning it as the only value in the row.
+func (d *sqlDecoder) Decode() ([]any, error) {
+	var stmt Statement
+	var lines []string
+
+	for {
+		line, err := d.readLine()
+		if errors.Is(err, io.EOF) && len(lines) > 0 {
+			return nil, fmt.Errorf("unterminated statement: %s", lines[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(lines) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if rows, ok := strings.CutPrefix(trimmed, rowsComment); ok {
+				if stmt.Rows, err = strconv.Atoi(rows); err != nil {
+					return nil, fmt.Errorf("parsing row count: %w", err)
+				}
+				continue
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			break
+		}
+	}
+
+	stmt.SQL = strings.TrimSuffix(strings.TrimSpace(strings.Join(lines, "\n")), ";")
+	if isCopy(stmt.SQL) {
+		data, err := d.readCopyData()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Data = data
+	}
+
+	return []any{stmt}, nil
+}
+
+// readCopyData reads the rows of a COPY FROM STDIN statement.
+func (d *sqlDecoder) readCopyData() ([]byte, error) {
+	data := []byte{}
+	for {
+		line, err := d.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("unterminated copy data")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == `\.` {
+			return data, nil
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+}
+
+// readLine returns the next line, without its line ending.
+func (d *sqlDecoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	d.n += int64(len(line))
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func isCopy(stmt string) bool {
+	upper := strings.ToUpper(stmt)
+	return strings.HasPrefix(upper, "COPY ") && strings.HasSuffix(upper, "FROM STDIN")
+}
@@ -0,0 +1,188 @@
+package file
+
+import (
+	"ds/internal/pkg/model"
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLWriter(t *testing.T) {
+	table := personTable("id", "name", "created_at")
+	table.PrimaryKey = "id"
+
+	at := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	batches := [][][]any{
+		{{int64(1), "o'brien", at}, {int64(2), nil, at}},
+		{{int64(3), "a\tb\\c\nd", nil}},
+	}
+
+	cases := []struct {
+		name   string
+		format model.SQLFormat
+		upsert bool
+		exp    string
+	}{
+		{
+			name: "insert",
+			exp: "-- person\n" +
+				"-- rows: 2\n" +
+				"INSERT INTO person (id, name, created_at) VALUES (1, 'o''brien', '2023-01-02T03:04:05Z'), (2, NULL, '2023-01-02T03:04:05Z');\n" +
+				"-- rows: 1\n" +
+				"INSERT INTO person (id, name, created_at) VALUES (3, E'a\tb\\\\c\\nd', NULL);\n",
+		},
+		{
+			name:   "copy",
+			format: model.SQLFormatCopy,
+			exp: "-- person\n" +
+				"-- rows: 2\n" +
+				"COPY person (id, name, created_at) FROM STDIN;\n" +
+				"1\to'brien\t2023-01-02T03:04:05Z\n" +
+				"2\t\\N\t2023-01-02T03:04:05Z\n" +
+				"\\.\n" +
+				"-- rows: 1\n" +
+				"COPY person (id, name, created_at) FROM STDIN;\n" +
+				"3\ta\\tb\\\\c\\nd\t\\N\n" +
+				"\\.\n",
+		},
+		{
+			name:   "upsert",
+			upsert: true,
+			exp: "-- person\n" +
+				"-- rows: 2\n" +
+				"INSERT INTO person AS _shift_t (id, name, created_at) VALUES (1, 'o''brien', '2023-01-02T03:04:05Z'), (2, NULL, '2023-01-02T03:04:05Z')\n" +
+				"\t\t ON CONFLICT (id) DO UPDATE\n" +
+				"\t\t SET name = EXCLUDED.name, created_at = EXCLUDED.created_at\n" +
+				"\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED;\n" +
+				"-- rows: 1\n" +
+				"INSERT INTO person AS _shift_t (id, name, created_at) VALUES (3, E'a\tb\\\\c\\nd', NULL)\n" +
+				"\t\t ON CONFLICT (id) DO UPDATE\n" +
+				"\t\t SET name = EXCLUDED.name, created_at = EXCLUDED.created_at\n" +
+				"\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED;\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := model.Database{Driver: model.DriverSQL, Path: dir, SQLFormat: c.format}
+
+			w, err := NewWriter(d, table, c.upsert, 0, nil)
+			assert.Nil(t, err)
+			for _, batch := range batches {
+				for _, row := range batch {
+					assert.Nil(t, w.Write(row))
+				}
+				assert.Nil(t, w.EndBatch())
+			}
+			assert.Nil(t, w.Close())
+
+			assert.Equal(t, c.exp, readFile(t, filepath.Join(dir, "person-0000000000.sql")))
+		})
+	}
+}
+
+func TestSQLWriterCopyUpsert(t *testing.T) {
+	d := model.Database{Driver: model.DriverSQL, Path: t.TempDir(), SQLFormat: model.SQLFormatCopy}
+
+	w, err := NewWriter(d, personTable("id"), true, 0, nil)
+	assert.Nil(t, err)
+	assert.EqualError(t, w.Write([]any{1}), "copy sql format doesn't support upserts")
+}
+
+func TestReadStatements(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "person-1.sql"), "-- person\n"+
+		"-- rows: 2\n"+
+		"INSERT INTO person (id) VALUES (1), (2);\n"+
+		"\n"+
+		"-- rows: 1\n"+
+		"COPY person (id) FROM STDIN;\n"+
+		"3\n"+
+		"\\.\n")
+	writeGzipFile(t, filepath.Join(dir, "person-2.sql.gz"), "UPDATE person\nSET name = 'a;b'\nWHERE id = 1;\n")
+
+	d := model.Database{Driver: model.DriverSQL, Path: dir}
+
+	r, err := NewReader(d, personTable("id"), nil)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	var act []Statement
+	for {
+		stmt, err := r.ReadStatement()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		act = append(act, stmt)
+	}
+
+	assert.Equal(t, []Statement{
+		{SQL: "INSERT INTO person (id) VALUES (1), (2)", Rows: 2},
+		{SQL: "COPY person (id) FROM STDIN", Data: []byte("3\n"), Rows: 1},
+		{SQL: "UPDATE person\nSET name = 'a;b'\nWHERE id = 1"},
+	}, act)
+}
+
+func TestReadStatementsUnterminated(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		expErr  string
+	}{
+		{name: "statement", content: "INSERT INTO person (id)\nVALUES (1)", expErr: "unterminated statement: INSERT INTO person (id)"},
+		{name: "copy", content: "COPY person (id) FROM STDIN;\n1\n", expErr: "unterminated copy data"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "person.sql"), c.content)
+
+			r, err := NewReader(model.Database{Driver: model.DriverSQL, Path: dir}, personTable("id"), nil)
+			assert.Nil(t, err)
+			defer r.Close()
+
+			_, err = r.ReadStatement()
+			assert.ErrorContains(t, err, c.expErr)
+		})
+	}
+}
+
+func TestFormatSQL(t *testing.T) {
+	cases := []struct {
+		name  string
+		value any
+		exp   string
+	}{
+		{name: "null", value: nil, exp: "NULL"},
+		{name: "bool", value: true, exp: "true"},
+		{name: "int", value: int32(-3), exp: "-3"},
+		{name: "float", value: 1.5, exp: "1.5"},
+		{name: "nan", value: math.NaN(), exp: "'NaN'"},
+		{name: "string", value: "it's", exp: "'it''s'"},
+		{name: "escaped string", value: "it's\r\n", exp: `E'it\'s\r\n'`},
+		{name: "text bytes", value: []byte(`{"a":1}`), exp: `'{"a":1}'`},
+		{name: "binary bytes", value: []byte{0xff, 0x00}, exp: `'\xff00'`},
+		{name: "time", value: time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC), exp: "'2023-01-02T03:04:05.000000006Z'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, formatSQL(c.value))
+		})
+	}
+}
+
+func TestFormatCopy(t *testing.T) {
+	assert.Equal(t, `\N`, formatCopy(nil))
+	assert.Equal(t, `a\tb\\c\nd\re`, formatCopy("a\tb\\c\nd\re"))
+	assert.Equal(t, `\\xff00`, formatCopy([]byte{0xff, 0x00}))
+	assert.Equal(t, "t", formatCopy("t"))
+	assert.Equal(t, "2023-01-02T03:04:05Z", formatCopy(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
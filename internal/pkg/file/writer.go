@@ -0,0 +1,234 @@
+package file
+
+import (
+	"compress/gzip"
+	"ds/internal/pkg/model"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Writer writes a table's rows to files in a directory, starting a new file
+// every RowsPerFile rows.
+//
+// Each file is written under a temporary name and renamed once it's complete,
+// so a file with its final name always holds every one of its rows. Completed
+// returns the number of rows in complete files, which is the offset to
+// checkpoint, so an interrupted export resumes at the start of the file that
+// was being written.
+type Writer struct {
+	d      model.Database
+	t      model.Table
+	types  []string
+	upsert bool
+
+	completed int
+	rows      int
+
+	f    *os.File
+	w    io.WriteCloser
+	enc  encoder
+	path string
+}
+
+// NewWriter returns a Writer for the given table, whose files begin at the
+// given offset. SQL files upsert rows into the table if upsert is set, and
+// insert them otherwise. If types are provided, they're the database types of
+// the source's columns, which Parquet files take their schema from.
+func NewWriter(d model.Database, t model.Table, upsert bool, offset int, types []string) (*Writer, error) {
+	if err := d.Compression.Validate(); err != nil {
+		return nil, err
+	}
+
+	if d.Compression == model.CompressionSnappy && d.Driver != model.DriverParquet {
+		return nil, fmt.Errorf("%s compression is only supported for %s files", d.Compression, model.DriverParquet)
+	}
+
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return nil, fmt.Errorf("creating directory: %w", err)
+	}
+
+	return &Writer{
+		d:         d,
+		t:         t,
+		types:     types,
+		upsert:    upsert,
+		completed: offset,
+	}, nil
+}
+
+// Write writes a row, completing the current file if it's full.
+func (w *Writer) Write(row []any) error {
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.enc.Encode(row); err != nil {
+		return fmt.Errorf("encoding row: %w", err)
+	}
+	w.rows++
+
+	if rows := w.d.FileRows(); rows > 0 && w.rows >= rows {
+		return w.complete()
+	}
+
+	return nil
+}
+
+// EndBatch marks the end of a batch of rows. SQL files write each batch of
+// rows as a single statement; other files ignore batches.
+func (w *Writer) EndBatch() error {
+	b, ok := w.enc.(interface{ EndBatch() error })
+	if !ok || w.f == nil {
+		return nil
+	}
+
+	if err := b.EndBatch(); err != nil {
+		return fmt.Errorf("ending batch: %w", err)
+	}
+	return nil
+}
+
+// Completed returns the number of rows written to complete files, including
+// those written by previous runs.
+func (w *Writer) Completed() int {
+	return w.completed
+}
+
+// Close completes the current file. If the table is empty, an empty file is
+// written, so every table has at least one file.
+func (w *Writer) Close() error {
+	if w.f == nil && w.completed == 0 {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if w.f == nil {
+		return nil
+	}
+
+	return w.complete()
+}
+
+// Abort discards the current file, leaving complete files in place.
+func (w *Writer) Abort() {
+	if w.f == nil {
+		return
+	}
+
+	w.w.Close()
+	w.f.Close()
+	os.Remove(w.f.Name())
+	w.f = nil
+}
+
+// Name returns the name of the file whose first row is at the given offset.
+func (w *Writer) Name(offset int) string {
+	return Name(w.d, w.t, offset)
+}
+
+// Name returns the name of a table's file whose first row is at the given
+// offset. Tables written to a single file are named after the table;
+// otherwise each file's name includes the offset of its first row. Parquet
+// files compress their own pages, so their names never include a compression
+// extension.
+func Name(d model.Database, t model.Table, offset int) string {
+	name := t.Name
+	if d.FileRows() > 0 {
+		name = fmt.Sprintf("%s-%010d", t.Name, offset)
+	}
+
+	ext := "." + d.Driver
+	if d.Driver != model.DriverParquet {
+		ext += d.Compression.Extension()
+	}
+
+	return filepath.Join(d.Path, name+ext)
+}
+
+func (w *Writer) open() (err error) {
+	w.path = w.Name(w.completed)
+
+	if w.f, err = os.Create(w.path + ".tmp"); err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+
+	if w.w, err = compress(w.f, w.d); err != nil {
+		w.f.Close()
+		w.f = nil
+		return fmt.Errorf("creating compressor: %w", err)
+	}
+
+	if w.enc, err = newEncoder(w.d, w.w, w.t, w.types, w.upsert); err != nil {
+		w.Abort()
+		return err
+	}
+
+	w.rows = 0
+	return nil
+}
+
+// complete flushes and closes the current file, then gives it its final name.
+func (w *Writer) complete() error {
+	if err := w.enc.Flush(); err != nil {
+		w.Abort()
+		return fmt.Errorf("flushing file: %w", err)
+	}
+
+	if err := w.w.Close(); err != nil {
+		w.Abort()
+		return fmt.Errorf("closing compressor: %w", err)
+	}
+
+	if err := w.f.Sync(); err != nil {
+		w.Abort()
+		return fmt.Errorf("syncing file: %w", err)
+	}
+
+	if err := w.f.Close(); err != nil {
+		w.Abort()
+		return fmt.Errorf("closing file: %w", err)
+	}
+
+	if err := os.Rename(w.f.Name(), w.path); err != nil {
+		os.Remove(w.f.Name())
+		w.f = nil
+		return fmt.Errorf("renaming file: %w", err)
+	}
+
+	w.f = nil
+	w.completed += w.rows
+	w.rows = 0
+	return nil
+}
+
+// nopCloser adds a no-op Close method to an uncompressed file, which is
+// closed separately.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// compress returns a writer that compresses the file. Parquet files are
+// compressed by their encoder instead.
+func compress(w io.Writer, d model.Database) (io.WriteCloser, error) {
+	if d.Driver == model.DriverParquet {
+		return nopCloser{w}, nil
+	}
+
+	switch d.Compression {
+	case model.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case model.CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopCloser{w}, nil
+	}
+}
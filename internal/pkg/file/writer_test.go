@@ -0,0 +1,291 @@
+package file
+
+import (
+	"compress/gzip"
+	"ds/internal/pkg/model"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterRollsFiles(t *testing.T) {
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir, RowsPerFile: 2}
+
+	w, err := NewWriter(d, personTable("id", "name"), false, 0, nil)
+	assert.Nil(t, err)
+
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		assert.Nil(t, w.Write([]any{int64(i + 1), name}))
+	}
+	assert.Equal(t, 4, w.Completed())
+
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 5, w.Completed())
+
+	assert.Equal(t, "id,name\n1,a\n2,b\n", readFile(t, filepath.Join(dir, "person-0000000000.csv")))
+	assert.Equal(t, "id,name\n3,c\n4,d\n", readFile(t, filepath.Join(dir, "person-0000000002.csv")))
+	assert.Equal(t, "id,name\n5,e\n", readFile(t, filepath.Join(dir, "person-0000000004.csv")))
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriterSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir, RowsPerFile: model.SingleFile}
+
+	w, err := NewWriter(d, personTable("id", "name"), false, 0, nil)
+	assert.Nil(t, err)
+
+	for i, name := range []string{"a", "b", "c"} {
+		assert.Nil(t, w.Write([]any{int64(i + 1), name}))
+	}
+	assert.Equal(t, 0, w.Completed())
+
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 3, w.Completed())
+
+	assert.Equal(t, "id,name\n1,a\n2,b\n3,c\n", readFile(t, filepath.Join(dir, "person.csv")))
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriterResumes(t *testing.T) {
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir, RowsPerFile: 2}
+
+	w, err := NewWriter(d, personTable("id"), false, 4, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write([]any{int64(5)}))
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, 5, w.Completed())
+	assert.Equal(t, "id\n5\n", readFile(t, filepath.Join(dir, "person-0000000004.csv")))
+}
+
+func TestWriterAbort(t *testing.T) {
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir, RowsPerFile: 2}
+
+	w, err := NewWriter(d, personTable("id"), false, 0, nil)
+	assert.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, w.Write([]any{int64(i)}))
+	}
+	w.Abort()
+
+	// Only the complete file remains.
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "person-0000000000.csv", entries[0].Name())
+	assert.Equal(t, 2, w.Completed())
+}
+
+func TestWriterEmptyTable(t *testing.T) {
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+
+	w, err := NewWriter(d, personTable("id", "name"), false, 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, "id,name\n", readFile(t, filepath.Join(dir, "person-0000000000.csv")))
+}
+
+func TestWriterFormats(t *testing.T) {
+	row := []any{int64(1), []byte("a, b"), nil, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), true}
+	columns := []string{"id", "name", "nickname", "created_at", "active"}
+
+	cases := []struct {
+		name        string
+		driver      string
+		compression model.Compression
+		nullString  *string
+		file        string
+		exp         string
+	}{
+		{
+			name:   "csv",
+			driver: model.DriverCSV,
+			file:   "person-0000000000.csv",
+			exp:    "id,name,nickname,created_at,active\n1,\"a, b\",\\N,2023-01-02T03:04:05Z,true\n",
+		},
+		{
+			name:       "csv null_string",
+			driver:     model.DriverCSV,
+			nullString: lo.ToPtr(""),
+			file:       "person-0000000000.csv",
+			exp:        "id,name,nickname,created_at,active\n1,\"a, b\",,2023-01-02T03:04:05Z,true\n",
+		},
+		{
+			name:   "jsonl",
+			driver: model.DriverJSONL,
+			file:   "person-0000000000.jsonl",
+			exp:    `{"active":true,"created_at":"2023-01-02T03:04:05Z","id":1,"name":"a, b","nickname":null}` + "\n",
+		},
+		{
+			name:        "gzip",
+			driver:      model.DriverJSONL,
+			compression: model.CompressionGzip,
+			file:        "person-0000000000.jsonl.gz",
+			exp:         `{"active":true,"created_at":"2023-01-02T03:04:05Z","id":1,"name":"a, b","nickname":null}` + "\n",
+		},
+		{
+			name:        "zstd",
+			driver:      model.DriverCSV,
+			compression: model.CompressionZstd,
+			file:        "person-0000000000.csv.zst",
+			exp:         "id,name,nickname,created_at,active\n1,\"a, b\",\\N,2023-01-02T03:04:05Z,true\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := model.Database{Driver: c.driver, Path: dir, Compression: c.compression, NullString: c.nullString}
+
+			w, err := NewWriter(d, personTable(columns...), false, 0, nil)
+			assert.Nil(t, err)
+			assert.Nil(t, w.Write(row))
+			assert.Nil(t, w.Close())
+
+			assert.Equal(t, c.exp, readFile(t, filepath.Join(dir, c.file)))
+		})
+	}
+}
+
+func TestWriterBinary(t *testing.T) {
+	row := []any{int64(1), []byte{0xff, 0x00, 0x10}, []byte("text")}
+	columns := []string{"id", "avatar", "name"}
+
+	cases := []struct {
+		name   string
+		driver string
+		file   string
+		exp    string
+	}{
+		{
+			name:   "csv",
+			driver: model.DriverCSV,
+			file:   "person-0000000000.csv",
+			exp:    "id,avatar,name\n1,\\xff0010,text\n",
+		},
+		{
+			name:   "jsonl",
+			driver: model.DriverJSONL,
+			file:   "person-0000000000.jsonl",
+			exp:    `{"avatar":"\\xff0010","id":1,"name":"text"}` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := model.Database{Driver: c.driver, Path: dir}
+
+			types := []string{"bigint", "bytea", "text"}
+			w, err := NewWriter(d, personTable(columns...), false, 0, types)
+			assert.Nil(t, err)
+			assert.Nil(t, w.Write(row))
+			assert.Nil(t, w.Close())
+
+			assert.Equal(t, c.exp, readFile(t, filepath.Join(dir, c.file)))
+
+			// Binary values read back into bytea columns are the bytes that
+			// were written.
+			r, err := NewReader(d, personTable(columns...), types)
+			assert.Nil(t, err)
+			defer r.Close()
+
+			assert.Equal(t, [][]any{{int64(1), []byte{0xff, 0x00, 0x10}, "text"}}, readAll(t, r))
+		})
+	}
+}
+
+func TestWriterCSVRoundTrip(t *testing.T) {
+	columns := []string{"id", "avatar", "name"}
+	types := []string{"bigint", "bytea", "text"}
+	rows := [][]any{
+		{int64(1), []byte("abc"), `\N`},
+		{int64(2), []byte{}, `\xff`},
+		{int64(3), nil, `C:\dir\`},
+		{int64(4), []byte(`\x00`), nil},
+		{int64(5), []byte{0xff}, ""},
+	}
+
+	dir := t.TempDir()
+	d := model.Database{Driver: model.DriverCSV, Path: dir}
+
+	w, err := NewWriter(d, personTable(columns...), false, 0, types)
+	assert.Nil(t, err)
+	for _, row := range rows {
+		assert.Nil(t, w.Write(row))
+	}
+	assert.Nil(t, w.Close())
+
+	// Binary values are always written in hex, and backslashes in text are
+	// escaped, so neither can be mistaken for a NULL.
+	exp := "id,avatar,name\n" +
+		`1,\x616263,\\N` + "\n" +
+		`2,\x,\\xff` + "\n" +
+		`3,\N,C:\\dir\\` + "\n" +
+		`4,\x5c783030,\N` + "\n" +
+		`5,\xff,` + "\n"
+	assert.Equal(t, exp, readFile(t, filepath.Join(dir, "person-0000000000.csv")))
+
+	r, err := NewReader(d, personTable(columns...), types)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, rows, readAll(t, r))
+}
+
+func TestNewWriterInvalidCompression(t *testing.T) {
+	_, err := NewWriter(model.Database{Driver: model.DriverCSV, Path: t.TempDir(), Compression: "lz4"}, personTable(), false, 0, nil)
+	assert.EqualError(t, err, `invalid compression: "lz4"`)
+}
+
+func readFile(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch filepath.Ext(path) {
+	case ".gz":
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatalf("error creating gzip reader: %v", err)
+		}
+	case ".zst":
+		if r, err = zstd.NewReader(f); err != nil {
+			t.Fatalf("error creating zstd reader: %v", err)
+		}
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	return string(b)
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
+
+func personTable(columns ...string) model.Table {
+	t := model.Table{Name: "person"}
+	for _, col := range columns {
+		t.Columns = append(t.Columns, model.Column{Name: col})
+	}
+	return t
+}
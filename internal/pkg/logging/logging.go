@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// New returns a structured logger that writes to w in the given format (text
+// or json), discarding records below the given level (debug, info, warn or
+// error).
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("parsing log level: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: l, ReplaceAttr: redactAttr}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %q", format)
+	}
+}
+
+// NewRunID returns a random identifier that correlates the log lines of a
+// single run.
+func NewRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// redacted replaces credentials in log and error output.
+const redacted = "xxxxx"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+
+	// credentials match the passwords in connection URLs and in key/value
+	// connection strings, as the second of three groups.
+	credentials = []*regexp.Regexp{
+		regexp.MustCompile(`(://[^:/@\s]*:)([^@\s]+)(@)`),
+		regexp.MustCompile(`(?i)(password=)('[^']*'|[^\s&]+)()`),
+	}
+)
+
+// AddSecrets registers values, such as the passwords read from the config,
+// that Redact removes wherever they appear.
+func AddSecrets(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// Redact removes the passwords of connection URLs and strings, and any
+// registered secrets, from s.
+func Redact(s string) string {
+	for _, re := range credentials {
+		s = re.ReplaceAllString(s, "${1}"+redacted+"${3}")
+	}
+
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactAttr redacts the credentials in string and error attributes.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Redact(err.Error()))
+		}
+	}
+	return a
+}
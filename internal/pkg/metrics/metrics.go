@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// RowsRead counts the rows read from each source table.
+	RowsRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ds_rows_read_total",
+		Help: "Number of rows read from the source table.",
+	}, []string{"table"})
+
+	// RowsWritten counts the rows written to each target table.
+	RowsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ds_rows_written_total",
+		Help: "Number of rows written to the target table.",
+	}, []string{"table"})
+
+	// RowsRejected counts the rows that couldn't be written to each target
+	// table, such as those conflicting under the error conflict strategy.
+	RowsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ds_rows_rejected_total",
+		Help: "Number of rows rejected by the target table.",
+	}, []string{"table"})
+
+	// ReadDuration observes the time taken to read each batch from the source.
+	ReadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ds_source_read_duration_seconds",
+		Help:    "Time taken to read a batch from the source table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"table"})
+
+	// WriteDuration observes the time taken to write each batch to the target,
+	// excluding any time spent waiting for rows streamed from the source.
+	WriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ds_target_write_duration_seconds",
+		Help:    "Time taken to write a batch to the target table, excluding time spent waiting for the source.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"table"})
+
+	// Retries counts the writes to each target table that were retried after
+	// failing with a transient error.
+	Retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ds_retries_total",
+		Help: "Number of writes to the target table retried after a transient error.",
+	}, []string{"table"})
+
+	// Lag reports the estimated number of rows of each source table that
+	// haven't been shifted yet.
+	Lag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ds_lag_rows",
+		Help: "Estimated number of source rows not yet shifted to the target table.",
+	}, []string{"table"})
+
+	// ThrottleDelay reports how long each table last waited between batches.
+	ThrottleDelay = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ds_throttle_delay_seconds",
+		Help: "Time waited before reading the next batch from the source table.",
+	}, []string{"table"})
+
+	// BatchSize reports the number of rows requested in each table's latest
+	// batch, which changes as batches are sized automatically.
+	BatchSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ds_batch_size_rows",
+		Help: "Number of rows requested in the latest batch from the source table.",
+	}, []string{"table"})
+
+	// BatchBytes observes the approximate size of each batch written.
+	BatchBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ds_batch_bytes",
+		Help:    "Approximate size of a batch written to the target table.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"table"})
+
+	// Paused reports whether each table is paused, waiting for a maintenance
+	// window to open.
+	Paused = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ds_table_paused",
+		Help: "Whether the table is paused outside of its maintenance windows (1) or not (0).",
+	}, []string{"table"})
+
+	// Checkpoint reports the current offset of each table.
+	Checkpoint = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ds_checkpoint_offset",
+		Help: "Current checkpointed offset of the table.",
+	}, []string{"table"})
+)
+
+// Serve exposes metrics for scraping at /metrics on the given address. The
+// listener is opened immediately, so address errors are returned to the
+// caller, and requests are then served in the background.
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		if err := http.Serve(lis, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("error serving metrics", "error", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultMinRows is the smallest batch that automatic batch sizing
+	// shrinks to if min_rows isn't configured.
+	defaultMinRows = 100
+
+	// defaultMaxRows is the largest batch that automatic batch sizing grows
+	// to if max_rows isn't configured.
+	defaultMaxRows = 100000
+)
+
+// BatchSize configures automatic batch sizing, which grows or shrinks the
+// number of rows read in each of a table's batches towards a target duration
+// or size, starting from the table's read_limit.
+type BatchSize struct {
+	// TargetDuration is how long each batch should take to read and write.
+	TargetDuration time.Duration `yaml:"target_duration"`
+
+	// TargetBytes is roughly how much data each batch should hold.
+	TargetBytes int `yaml:"target_bytes"`
+
+	// MinRows is the fewest rows read in a batch; defaults to 100.
+	MinRows int `yaml:"min_rows"`
+
+	// MaxRows is the most rows read in a batch; defaults to 100000.
+	MaxRows int `yaml:"max_rows"`
+}
+
+// Auto returns true if batch sizes are chosen automatically, rather than
+// fixed by each table's read_limit.
+func (b BatchSize) Auto() bool {
+	return b.TargetDuration > 0 || b.TargetBytes > 0
+}
+
+// Bounds returns the fewest and most rows read in a batch.
+func (b BatchSize) Bounds() (minRows, maxRows int) {
+	minRows, maxRows = b.MinRows, b.MaxRows
+	if minRows <= 0 {
+		minRows = defaultMinRows
+	}
+	if maxRows <= 0 {
+		maxRows = defaultMaxRows
+	}
+	return minRows, max(minRows, maxRows)
+}
+
+// Validate returns every problem with the batch size's settings.
+func (b BatchSize) Validate() []error {
+	var errs []error
+	if b.TargetDuration < 0 {
+		errs = append(errs, fmt.Errorf("invalid target_duration: %s", b.TargetDuration))
+	}
+	if b.TargetBytes < 0 {
+		errs = append(errs, fmt.Errorf("invalid target_bytes: %d", b.TargetBytes))
+	}
+	if b.MinRows < 0 {
+		errs = append(errs, fmt.Errorf("invalid min_rows: %d", b.MinRows))
+	}
+	if b.MaxRows < 0 {
+		errs = append(errs, fmt.Errorf("invalid max_rows: %d", b.MaxRows))
+	}
+	if b.MinRows > 0 && b.MaxRows > 0 && b.MinRows > b.MaxRows {
+		errs = append(errs, fmt.Errorf("min_rows %d is greater than max_rows %d", b.MinRows, b.MaxRows))
+	}
+	return errs
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchSizeAuto(t *testing.T) {
+	assert.False(t, BatchSize{}.Auto())
+	assert.False(t, BatchSize{MinRows: 10, MaxRows: 100}.Auto())
+	assert.True(t, BatchSize{TargetDuration: time.Second}.Auto())
+	assert.True(t, BatchSize{TargetBytes: 1 << 20}.Auto())
+}
+
+func TestBatchSizeBounds(t *testing.T) {
+	cases := []struct {
+		name      string
+		batchSize BatchSize
+		expMin    int
+		expMax    int
+	}{
+		{name: "defaults", expMin: 100, expMax: 100000},
+		{name: "configured", batchSize: BatchSize{MinRows: 10, MaxRows: 1000}, expMin: 10, expMax: 1000},
+		{name: "min above default max", batchSize: BatchSize{MinRows: 200000}, expMin: 200000, expMax: 200000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actMin, actMax := c.batchSize.Bounds()
+			assert.Equal(t, c.expMin, actMin)
+			assert.Equal(t, c.expMax, actMax)
+		})
+	}
+}
+
+func TestBatchSizeValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		batchSize BatchSize
+		exp       []error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:      "valid",
+			batchSize: BatchSize{TargetDuration: time.Second, TargetBytes: 1 << 20, MinRows: 10, MaxRows: 1000},
+		},
+		{
+			name:      "invalid",
+			batchSize: BatchSize{TargetDuration: -time.Second, TargetBytes: -1, MinRows: -1, MaxRows: -1},
+			exp: []error{
+				fmt.Errorf("invalid target_duration: -1s"),
+				fmt.Errorf("invalid target_bytes: -1"),
+				fmt.Errorf("invalid min_rows: -1"),
+				fmt.Errorf("invalid max_rows: -1"),
+			},
+		},
+		{
+			name:      "inverted bounds",
+			batchSize: BatchSize{TargetDuration: time.Second, MinRows: 1000, MaxRows: 10},
+			exp: []error{
+				fmt.Errorf("min_rows 1000 is greater than max_rows 10"),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, c.batchSize.Validate())
+		})
+	}
+}
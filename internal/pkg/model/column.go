@@ -3,4 +3,8 @@ package model
 // Column represents a column in a table.
 type Column struct {
 	Name string `yaml:"name"`
+
+	// Source names the source column a target column is loaded from, if it's
+	// matched by name rather than by position.
+	Source string `yaml:"source"`
 }
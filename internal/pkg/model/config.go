@@ -1,7 +1,37 @@
 package model
 
+// DefaultJob is the name of the job if one isn't configured.
+const DefaultJob = "default"
+
 // Config represents values in the config file.
 type Config struct {
+	// Job names the migration, so that several jobs can share a state table
+	// without overwriting each other's offsets.
+	Job string `yaml:"job"`
+
+	// State configures where table offsets are stored.
+	State State `yaml:"state"`
+
 	Source Database `yaml:"source"`
 	Target Database `yaml:"target"`
+
+	// Throttle configures how reads are slowed down to protect the source and
+	// target databases.
+	Throttle Throttle `yaml:"throttle"`
+
+	// BatchSize configures automatic batch sizing.
+	BatchSize BatchSize `yaml:"batch_size"`
+
+	// Windows are the maintenance windows during which tables may be
+	// shifted, unless a table has windows of its own. If there aren't any,
+	// tables may be shifted at any time.
+	Windows []Window `yaml:"windows"`
+}
+
+// JobName returns the name of the job, or "default" if one isn't configured.
+func (c Config) JobName() string {
+	if c.Job == "" {
+		return DefaultJob
+	}
+	return c.Job
 }
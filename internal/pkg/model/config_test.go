@@ -0,0 +1,12 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobName(t *testing.T) {
+	assert.Equal(t, "default", Config{}.JobName())
+	assert.Equal(t, "backfill", Config{Job: "backfill"}.JobName())
+}
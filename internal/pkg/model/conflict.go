@@ -0,0 +1,32 @@
+package model
+
+import "fmt"
+
+// ConflictStrategy determines what happens when a row being written to the
+// target already exists there and differs from the source.
+type ConflictStrategy string
+
+const (
+	// ConflictSourceWins overwrites the target row with the source row.
+	ConflictSourceWins ConflictStrategy = "source_wins"
+
+	// ConflictTargetWins leaves the target row untouched.
+	ConflictTargetWins ConflictStrategy = "target_wins"
+
+	// ConflictNewestWins overwrites the target row only if the source row
+	// has a greater value in the table's version column.
+	ConflictNewestWins ConflictStrategy = "newest_wins"
+
+	// ConflictError aborts the batch and reports the conflicting keys.
+	ConflictError ConflictStrategy = "error"
+)
+
+// Validate returns an error if the strategy isn't recognised.
+func (cs ConflictStrategy) Validate() error {
+	switch cs {
+	case "", ConflictSourceWins, ConflictTargetWins, ConflictNewestWins, ConflictError:
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict strategy: %q", cs)
+	}
+}
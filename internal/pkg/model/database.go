@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -11,17 +12,157 @@ type Database struct {
 	Driver string  `yaml:"driver"`
 	URL    string  `yaml:"url"`
 	Tables []Table `yaml:"tables"`
+
+	// Include selects tables from the database's catalog, in addition to its
+	// configured tables, using globs (public.*) or regular expressions between
+	// slashes (/^audit_[0-9]+$/). Patterns prefixed with ! deselect the tables
+	// matched by earlier patterns.
+	Include []string `yaml:"include"`
+
+	// Exclude removes tables matching any of its patterns, whether they're
+	// configured or selected by Include.
+	Exclude []string `yaml:"exclude"`
+
+	// ReadLimit and ReadDelay are the read_limit and read_delay of the tables
+	// selected by Include, which don't have any configuration of their own.
+	ReadLimit int           `yaml:"read_limit"`
+	ReadDelay time.Duration `yaml:"read_delay"`
+
+	// URLFile is the path of a file holding the database's URL, such as a
+	// mounted secret, used instead of URL.
+	URLFile string `yaml:"url_file"`
+
+	// PasswordFile is the path of a file holding the password of the user in
+	// the database's URL, replacing any password the URL already has.
+	PasswordFile string `yaml:"password_file"`
+
+	// Path is the directory holding each table's files, for file drivers.
+	Path string `yaml:"path"`
+
+	// RowsPerFile starts a new file every so many rows when writing files;
+	// defaults to DefaultRowsPerFile, and SingleFile writes each table to a
+	// single file.
+	RowsPerFile int `yaml:"rows_per_file"`
+
+	// Compression determines how files are compressed when writing files;
+	// defaults to none, or snappy for Parquet files.
+	Compression Compression `yaml:"compression"`
+
+	// RowGroupSize is the number of rows in each row group of a Parquet file.
+	RowGroupSize int `yaml:"row_group_size"`
+
+	// SQLFormat determines how rows are written to SQL files; defaults to
+	// insert.
+	SQLFormat SQLFormat `yaml:"sql_format"`
+
+	// NullString is the field that stands for NULL in CSV files; defaults to
+	// \N, as it does in Postgres' COPY text format.
+	NullString *string `yaml:"null_string"`
+
+	// expanded is set once the database's table patterns have been expanded
+	// into tables.
+	expanded bool
 }
 
-// GetTargetTable returns the target table for a given source table name.
-func (d Database) GetTargetTable(source string) (Table, error) {
+// IsFile returns true if the database is a directory of files, rather than a
+// database.
+func (d Database) IsFile() bool {
+	switch d.Driver {
+	case DriverCSV, DriverJSONL, DriverParquet, DriverSQL:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetTargetTable returns the target table for a given source table. Target
+// tables are derived from their source table, so a target table only needs
+// to be configured if it differs: its name, primary key and write settings
+// replace those of the source table, and its columns are merged over the
+// source table's. If no target table names the source table, in its name or
+// source_name, the source table is used as is.
+func (d Database) GetTargetTable(source Table) (Table, error) {
+	if source.Name == "" {
+		return Table{}, fmt.Errorf("missing source table name")
+	}
+
+	derived := Table{
+		Name:          source.Name,
+		PrimaryKey:    source.PrimaryKey,
+		SourceName:    source.Name,
+		Columns:       source.Columns,
+		OnConflict:    source.OnConflict,
+		VersionColumn: source.VersionColumn,
+		LoadMode:      source.LoadMode,
+		SequenceSync:  source.SequenceSync,
+	}
+
 	targetTable, ok := lo.Find(d.Tables, func(t Table) bool {
-		return t.SourceName == source || t.Name == source
+		return t.IsTargetOf(source.Name)
 	})
-
 	if !ok {
-		return Table{}, fmt.Errorf("missing target for %s; ensure table names match, target has a source_name", source)
+		return derived, nil
+	}
+
+	if targetTable.Name != "" {
+		derived.Name = targetTable.Name
+	}
+	if targetTable.PrimaryKey != "" {
+		derived.PrimaryKey = targetTable.PrimaryKey
+	}
+	if len(targetTable.Columns) > 0 {
+		columns, err := mergeColumns(source, targetTable.Columns)
+		if err != nil {
+			return Table{}, fmt.Errorf("target table %s: %w", derived.Name, err)
+		}
+		derived.Columns = columns
+	}
+	derived.ExtraColumns = targetTable.ExtraColumns
+	if targetTable.OnConflict != "" {
+		derived.OnConflict = targetTable.OnConflict
+	}
+	if targetTable.VersionColumn != "" {
+		derived.VersionColumn = targetTable.VersionColumn
+	}
+	if targetTable.LoadMode != "" {
+		derived.LoadMode = targetTable.LoadMode
+	}
+	if targetTable.SequenceSync != "" {
+		derived.SequenceSync = targetTable.SequenceSync
+	}
+
+	return derived, nil
+}
+
+// mergeColumns merges a target table's columns over those of its source table.
+// Target columns replace the source column at the same position, or the one
+// named by their source, so only the columns that are renamed, and those
+// before them, need to be given. If the source's columns aren't known yet,
+// as they're taken from its catalog, the target's are used as they are.
+func mergeColumns(source Table, target []Column) ([]Column, error) {
+	if len(source.Columns) == 0 {
+		return target, nil
+	}
+
+	columns := append([]Column(nil), source.Columns...)
+	merged := map[int]string{}
+	for i, c := range target {
+		j := i
+		if c.Source != "" {
+			var found bool
+			if _, j, found = lo.FindIndexOf(source.Columns, func(s Column) bool { return s.Name == c.Source }); !found {
+				return nil, fmt.Errorf("column %s: source table %s has no column %s", c.Name, source.Name, c.Source)
+			}
+		} else if i >= len(source.Columns) {
+			return nil, fmt.Errorf("has %d columns but source table %s has %d; use extra_columns for columns it doesn't have", len(target), source.Name, len(source.Columns))
+		}
+
+		if other, ok := merged[j]; ok {
+			return nil, fmt.Errorf("columns %s and %s are both loaded from source column %s", other, c.Name, source.Columns[j].Name)
+		}
+		merged[j] = c.Name
+		columns[j] = Column{Name: c.Name}
 	}
 
-	return targetTable, nil
+	return columns, nil
 }
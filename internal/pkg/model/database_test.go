@@ -8,63 +8,198 @@ import (
 )
 
 func TestGetTargetTable(t *testing.T) {
+	source := Table{
+		Name:       "person",
+		PrimaryKey: "id",
+		Filter:     "WHERE id > 0",
+		ReadLimit:  100,
+		Columns:    []Column{{Name: "id"}, {Name: "name"}},
+		OnConflict: ConflictTargetWins,
+	}
+
 	cases := []struct {
-		name         string
-		database     Database
-		source       string
-		expTableName string
-		expErr       error
+		name     string
+		database Database
+		source   Table
+		exp      Table
+		expErr   error
 	}{
+		{
+			name:   "target table derived from source table",
+			source: source,
+			exp: Table{
+				Name:       "person",
+				PrimaryKey: "id",
+				SourceName: "person",
+				Columns:    []Column{{Name: "id"}, {Name: "name"}},
+				OnConflict: ConflictTargetWins,
+			},
+		},
 		{
 			name: "target table found from source name",
 			database: Database{
 				Tables: []Table{
-					{
-						Name:       "a",
-						SourceName: "b",
-					},
+					{Name: "people", SourceName: "person"},
 				},
 			},
-			source:       "b",
-			expTableName: "a",
+			source: source,
+			exp: Table{
+				Name:       "people",
+				PrimaryKey: "id",
+				SourceName: "person",
+				Columns:    []Column{{Name: "id"}, {Name: "name"}},
+				OnConflict: ConflictTargetWins,
+			},
 		},
 		{
 			name: "target table found from name",
+			database: Database{
+				Tables: []Table{
+					{Name: "person", LoadMode: LoadTruncate},
+				},
+			},
+			source: source,
+			exp: Table{
+				Name:       "person",
+				PrimaryKey: "id",
+				SourceName: "person",
+				Columns:    []Column{{Name: "id"}, {Name: "name"}},
+				OnConflict: ConflictTargetWins,
+				LoadMode:   LoadTruncate,
+			},
+		},
+		{
+			name: "target table overrides sequence sync",
+			database: Database{
+				Tables: []Table{
+					{Name: "person", SequenceSync: SequenceSyncNone},
+				},
+			},
+			source: source,
+			exp: Table{
+				Name:         "person",
+				PrimaryKey:   "id",
+				SourceName:   "person",
+				Columns:      []Column{{Name: "id"}, {Name: "name"}},
+				OnConflict:   ConflictTargetWins,
+				SequenceSync: SequenceSyncNone,
+			},
+		},
+		{
+			name: "target table overrides source table",
 			database: Database{
 				Tables: []Table{
 					{
-						Name:       "a",
-						SourceName: "b",
+						Name:          "people",
+						SourceName:    "person",
+						PrimaryKey:    "person_id",
+						Columns:       []Column{{Name: "person_id"}, {Name: "full_name"}},
+						OnConflict:    ConflictNewestWins,
+						VersionColumn: "full_name",
 					},
 				},
 			},
-			source:       "a",
-			expTableName: "a",
+			source: source,
+			exp: Table{
+				Name:          "people",
+				PrimaryKey:    "person_id",
+				SourceName:    "person",
+				Columns:       []Column{{Name: "person_id"}, {Name: "full_name"}},
+				OnConflict:    ConflictNewestWins,
+				VersionColumn: "full_name",
+			},
+		},
+		{
+			name: "target columns merged by position",
+			database: Database{
+				Tables: []Table{
+					{Name: "people", SourceName: "person", Columns: []Column{{Name: "person_id"}}},
+				},
+			},
+			source: source,
+			exp: Table{
+				Name:       "people",
+				PrimaryKey: "id",
+				SourceName: "person",
+				Columns:    []Column{{Name: "person_id"}, {Name: "name"}},
+				OnConflict: ConflictTargetWins,
+			},
 		},
 		{
-			name: "target table not found",
+			name: "target columns merged by name",
 			database: Database{
 				Tables: []Table{
 					{
-						Name:       "a",
-						SourceName: "b",
+						Name:         "people",
+						SourceName:   "person",
+						Columns:      []Column{{Name: "full_name", Source: "name"}},
+						ExtraColumns: []Column{{Name: "created_at"}},
 					},
 				},
 			},
-			source: "c",
-			expErr: fmt.Errorf("missing target for c; ensure table names match, target has a source_name"),
+			source: source,
+			exp: Table{
+				Name:         "people",
+				PrimaryKey:   "id",
+				SourceName:   "person",
+				Columns:      []Column{{Name: "id"}, {Name: "full_name"}},
+				ExtraColumns: []Column{{Name: "created_at"}},
+				OnConflict:   ConflictTargetWins,
+			},
+		},
+		{
+			name: "unknown source column",
+			database: Database{
+				Tables: []Table{
+					{Name: "people", SourceName: "person", Columns: []Column{{Name: "full_name", Source: "surname"}}},
+				},
+			},
+			source: source,
+			expErr: fmt.Errorf("target table people: column full_name: source table person has no column surname"),
+		},
+		{
+			name: "source column loaded twice",
+			database: Database{
+				Tables: []Table{
+					{Name: "people", SourceName: "person", Columns: []Column{{Name: "person_id"}, {Name: "key", Source: "id"}}},
+				},
+			},
+			source: source,
+			expErr: fmt.Errorf("target table people: columns person_id and key are both loaded from source column id"),
+		},
+		{
+			name: "other target tables ignored",
+			database: Database{
+				Tables: []Table{
+					{Name: "a", SourceName: "b"},
+				},
+			},
+			source: source,
+			exp: Table{
+				Name:       "person",
+				PrimaryKey: "id",
+				SourceName: "person",
+				Columns:    []Column{{Name: "id"}, {Name: "name"}},
+				OnConflict: ConflictTargetWins,
+			},
+		},
+		{
+			name:   "missing source table name",
+			source: Table{},
+			expErr: fmt.Errorf("missing source table name"),
 		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			act, err := c.database.GetTargetTable(c.source)
-			assert.Equal(t, c.expErr, err)
-			if err != nil {
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
 				return
 			}
+			assert.Nil(t, err)
 
-			assert.Equal(t, c.expTableName, act.Name)
+			assert.Equal(t, c.exp, act)
 		})
 	}
 }
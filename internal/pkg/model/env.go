@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference matches references to environment variables in config values:
+// ${NAME}, or ${NAME:-default} to fall back to a default if NAME is unset or
+// empty. References are escaped by doubling the dollar sign, as in $${NAME}.
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// ExpandEnv replaces references to environment variables in every value of a
+// config document, looking each one up with the given function. Values are
+// expanded after the document is parsed, so the variables can hold characters
+// that are special to YAML.
+func ExpandEnv(node *yaml.Node, lookup func(string) (string, bool)) error {
+	if node.Kind == yaml.ScalarNode {
+		value, err := expandEnv(node.Value, lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := ExpandEnv(child, lookup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+
+		match := envReference.FindStringSubmatch(ref)
+		name, fallback := match[1], match[2]
+
+		if value, ok := lookup(name); ok && (value != "" || fallback == "") {
+			return value
+		}
+		if fallback != "" {
+			return strings.TrimPrefix(fallback, ":-")
+		}
+
+		missing = append(missing, name)
+		return ref
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing environment variable: %s", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
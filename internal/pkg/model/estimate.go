@@ -0,0 +1,30 @@
+package model
+
+import "fmt"
+
+// RowEstimate determines how the number of rows in a source table is
+// estimated for progress reporting.
+type RowEstimate string
+
+const (
+	// EstimateCount counts the rows matching the table's filter, which is
+	// exact but can be slow for very large tables.
+	EstimateCount RowEstimate = "count"
+
+	// EstimateStats reads the row count from the database's catalog
+	// statistics, which is fast but ignores the table's filter.
+	EstimateStats RowEstimate = "stats"
+
+	// EstimateNone skips estimation, so only rows done and rate are reported.
+	EstimateNone RowEstimate = "none"
+)
+
+// Validate returns an error if the row estimate isn't recognised.
+func (re RowEstimate) Validate() error {
+	switch re {
+	case "", EstimateCount, EstimateStats, EstimateNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid row estimate: %q", re)
+	}
+}
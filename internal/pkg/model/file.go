@@ -0,0 +1,89 @@
+package model
+
+import "fmt"
+
+// File drivers read and write each table as files in a directory, rather than
+// as tables in a database.
+const (
+	DriverCSV     = "csv"
+	DriverJSONL   = "jsonl"
+	DriverParquet = "parquet"
+	DriverSQL     = "sql"
+)
+
+const (
+	// DefaultRowsPerFile is the number of rows written to each file, unless
+	// a database's rows_per_file says otherwise. Exports are checkpointed as
+	// each file completes, so it bounds the rows an interrupted export writes
+	// again.
+	DefaultRowsPerFile = 100000
+
+	// SingleFile, as a database's rows_per_file, writes each table to a
+	// single file, which is only checkpointed once it's complete.
+	SingleFile = -1
+)
+
+// FileRows returns the number of rows to write to each of the database's
+// files, or zero if each table is written to a single file.
+func (d Database) FileRows() int {
+	switch {
+	case d.RowsPerFile == 0:
+		return DefaultRowsPerFile
+	case d.RowsPerFile < 0:
+		return 0
+	default:
+		return d.RowsPerFile
+	}
+}
+
+// DefaultNullString is the field that stands for NULL in CSV files, unless a
+// database's null_string says otherwise.
+const DefaultNullString = `\N`
+
+// Null returns the field that stands for NULL in the database's CSV files.
+func (d Database) Null() string {
+	if d.NullString == nil {
+		return DefaultNullString
+	}
+	return *d.NullString
+}
+
+// Compression determines how files are compressed.
+type Compression string
+
+const (
+	// CompressionNone writes files uncompressed.
+	CompressionNone Compression = "none"
+
+	// CompressionGzip compresses files with gzip.
+	CompressionGzip Compression = "gzip"
+
+	// CompressionZstd compresses files with Zstandard.
+	CompressionZstd Compression = "zstd"
+
+	// CompressionSnappy compresses Parquet files with Snappy, which is the
+	// default for Parquet files.
+	CompressionSnappy Compression = "snappy"
+)
+
+// Validate returns an error if the compression isn't recognised.
+func (c Compression) Validate() error {
+	switch c {
+	case "", CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression: %q", c)
+	}
+}
+
+// Extension returns the suffix added to the names of compressed files.
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		compression Compression
+		expErr      error
+	}{
+		{name: "default", compression: ""},
+		{name: "none", compression: CompressionNone},
+		{name: "gzip", compression: CompressionGzip},
+		{name: "zstd", compression: CompressionZstd},
+		{name: "snappy", compression: CompressionSnappy},
+		{name: "invalid", compression: "lz4", expErr: fmt.Errorf(`invalid compression: "lz4"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expErr, c.compression.Validate())
+		})
+	}
+}
+
+func TestCompressionExtension(t *testing.T) {
+	assert.Equal(t, "", Compression("").Extension())
+	assert.Equal(t, "", CompressionNone.Extension())
+	assert.Equal(t, ".gz", CompressionGzip.Extension())
+	assert.Equal(t, ".zst", CompressionZstd.Extension())
+	assert.Equal(t, "", CompressionSnappy.Extension())
+}
+
+func TestDatabaseIsFile(t *testing.T) {
+	assert.False(t, Database{}.IsFile())
+	assert.False(t, Database{Driver: "pgx"}.IsFile())
+	assert.True(t, Database{Driver: DriverCSV}.IsFile())
+	assert.True(t, Database{Driver: DriverJSONL}.IsFile())
+	assert.True(t, Database{Driver: DriverParquet}.IsFile())
+	assert.True(t, Database{Driver: DriverSQL}.IsFile())
+}
+
+func TestDatabaseFileRows(t *testing.T) {
+	assert.Equal(t, DefaultRowsPerFile, Database{}.FileRows())
+	assert.Equal(t, 10, Database{RowsPerFile: 10}.FileRows())
+	assert.Equal(t, 0, Database{RowsPerFile: SingleFile}.FileRows())
+}
@@ -0,0 +1,30 @@
+package model
+
+import "fmt"
+
+// LoadMode determines how rows are loaded into a target table during an
+// insert.
+type LoadMode string
+
+const (
+	// LoadAppend copies rows into the live table in checkpointed batches.
+	LoadAppend LoadMode = "append"
+
+	// LoadTruncate truncates the live table and copies every row into it
+	// within a single transaction.
+	LoadTruncate LoadMode = "truncate"
+
+	// LoadSwap copies rows into a shadow table, then renames it over the
+	// live table once all rows have been copied.
+	LoadSwap LoadMode = "swap"
+)
+
+// Validate returns an error if the load mode isn't recognised.
+func (lm LoadMode) Validate() error {
+	switch lm {
+	case "", LoadAppend, LoadTruncate, LoadSwap:
+		return nil
+	default:
+		return fmt.Errorf("invalid load mode: %q", lm)
+	}
+}
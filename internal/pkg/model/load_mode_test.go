@@ -0,0 +1,28 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadModeValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		loadMode LoadMode
+		expErr   error
+	}{
+		{name: "default", loadMode: ""},
+		{name: "append", loadMode: LoadAppend},
+		{name: "truncate", loadMode: LoadTruncate},
+		{name: "swap", loadMode: LoadSwap},
+		{name: "invalid", loadMode: "replace", expErr: fmt.Errorf(`invalid load mode: "replace"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expErr, c.loadMode.Validate())
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// CatalogTable is a table found in a database's catalog, used to expand the
+// database's table patterns.
+type CatalogTable struct {
+	Table
+
+	// QualifiedName is the table's name, qualified with its schema, which
+	// patterns are also matched against.
+	QualifiedName string
+}
+
+// ExpandTables returns the database with its include patterns replaced by the
+// tables in its catalog that they match, less any that match its exclude
+// patterns. Configured tables are kept, in order, ahead of the tables found in
+// the catalog, and override the matching catalog table; their columns and
+// primary key are taken from the catalog if they don't set them. Tables found
+// in the catalog are read with the database's read_limit and read_delay.
+func (d Database) ExpandTables(catalog []CatalogTable) (Database, error) {
+	if len(d.Include) == 0 && len(d.Exclude) == 0 {
+		return d, nil
+	}
+
+	var tables []Table
+	configured := map[string]bool{}
+
+	for _, t := range d.Tables {
+		if c, ok := lo.Find(catalog, func(c CatalogTable) bool { return c.matches(t.Name) }); ok {
+			configured[c.Name] = true
+			if len(t.Columns) == 0 {
+				t.Columns = c.Columns
+			}
+			if t.PrimaryKey == "" {
+				t.PrimaryKey = c.PrimaryKey
+			}
+		}
+		configured[t.Name] = true
+		tables = append(tables, t)
+	}
+
+	for _, c := range catalog {
+		if configured[c.Name] {
+			continue
+		}
+
+		ok, err := selected(d.Include, c.Name, c.QualifiedName)
+		if err != nil {
+			return Database{}, err
+		}
+		if ok {
+			t := c.Table
+			t.ReadLimit, t.ReadDelay = d.ReadLimit, d.ReadDelay
+			tables = append(tables, t)
+		}
+	}
+
+	tables, err := excludeTables(tables, d.Exclude, catalog)
+	if err != nil {
+		return Database{}, err
+	}
+
+	d.Tables, d.Include, d.Exclude = tables, nil, nil
+	d.expanded = true
+	return d, nil
+}
+
+// SelectTables returns the database with only the tables whose names are
+// selected by the include patterns, or every table if there aren't any, less
+// those that match the exclude patterns.
+func (d Database) SelectTables(include, exclude []string) (Database, error) {
+	if len(include) > 0 {
+		var tables []Table
+		for _, t := range d.Tables {
+			ok, err := selected(include, t.Name)
+			if err != nil {
+				return Database{}, err
+			}
+			if ok {
+				tables = append(tables, t)
+			}
+		}
+		d.Tables = tables
+	}
+
+	var err error
+	if d.Tables, err = excludeTables(d.Tables, exclude, nil); err != nil {
+		return Database{}, err
+	}
+
+	if len(d.Tables) == 0 {
+		return Database{}, fmt.Errorf("no tables selected")
+	}
+
+	return d, nil
+}
+
+// matches returns true if a configured table name refers to the catalog table.
+func (c CatalogTable) matches(name string) bool {
+	return name == c.Name || name == c.QualifiedName
+}
+
+// excludeTables removes the tables matching any of the patterns, using their
+// qualified names from the catalog where they're known.
+func excludeTables(tables []Table, patterns []string, catalog []CatalogTable) ([]Table, error) {
+	if len(patterns) == 0 {
+		return tables, nil
+	}
+
+	var kept []Table
+	for _, t := range tables {
+		names := []string{t.Name}
+		if c, ok := lo.Find(catalog, func(c CatalogTable) bool { return c.matches(t.Name) }); ok {
+			names = append(names, c.QualifiedName)
+		}
+
+		excluded := false
+		for _, pattern := range patterns {
+			ok, err := matchPattern(pattern, names...)
+			if err != nil {
+				return nil, err
+			}
+			excluded = excluded || ok
+		}
+
+		if !excluded {
+			kept = append(kept, t)
+		}
+	}
+
+	return kept, nil
+}
+
+// selected returns true if a table is selected by a list of patterns. Patterns
+// are applied in order and the last one to match a table decides: patterns
+// prefixed with ! deselect the tables they match, so ["public.*", "!*_tmp"]
+// selects every table in the public schema except temporary ones. Lists that
+// start with a negated pattern start by selecting every table.
+func selected(patterns []string, names ...string) (bool, error) {
+	ok := len(patterns) > 0 && strings.HasPrefix(patterns[0], "!")
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+
+		matched, err := matchPattern(strings.TrimPrefix(pattern, "!"), names...)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			ok = !negated
+		}
+	}
+	return ok, nil
+}
+
+// matchPattern returns true if any of the names match a pattern, which is
+// either a glob, such as public.*, or a regular expression between slashes,
+// such as /^audit_[0-9]+$/.
+func matchPattern(pattern string, names ...string) (bool, error) {
+	if expr, ok := regexPattern(pattern); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		return lo.SomeBy(names, re.MatchString), nil
+	}
+
+	for _, name := range names {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func regexPattern(pattern string) (string, bool) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return pattern[1 : len(pattern)-1], true
+	}
+	return "", false
+}
+
+// validatePattern returns an error if a table pattern can't be parsed.
+func validatePattern(pattern string) error {
+	_, err := matchPattern(strings.TrimPrefix(pattern, "!"), "")
+	return err
+}
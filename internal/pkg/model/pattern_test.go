@@ -0,0 +1,141 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelected(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		names    []string
+		exp      bool
+		expErr   string
+	}{
+		{name: "no patterns", names: []string{"person"}, exp: false},
+		{name: "glob", patterns: []string{"pers*"}, names: []string{"person"}, exp: true},
+		{name: "qualified glob", patterns: []string{"public.*"}, names: []string{"person", "public.person"}, exp: true},
+		{name: "glob doesn't match", patterns: []string{"public.*"}, names: []string{"audit.person"}, exp: false},
+		{name: "regex", patterns: []string{`/^audit_[0-9]+$/`}, names: []string{"audit_2023"}, exp: true},
+		{name: "regex doesn't match", patterns: []string{`/^audit_[0-9]+$/`}, names: []string{"audit_tmp"}, exp: false},
+		{name: "negated", patterns: []string{"public.*", "!*_tmp"}, names: []string{"person_tmp", "public.person_tmp"}, exp: false},
+		{name: "negation overridden", patterns: []string{"public.*", "!*_tmp", "person_tmp"}, names: []string{"person_tmp", "public.person_tmp"}, exp: true},
+		{name: "leading negation", patterns: []string{"!*_tmp"}, names: []string{"person"}, exp: true},
+		{name: "invalid glob", patterns: []string{"[a"}, names: []string{"person"}, expErr: `invalid table pattern "[a": syntax error in pattern`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := selected(c.patterns, c.names...)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestExpandTables(t *testing.T) {
+	catalog := []CatalogTable{
+		{QualifiedName: "audit.event", Table: Table{Name: "audit.event", Columns: []Column{{Name: "id"}}}},
+		{QualifiedName: "public.order", Table: Table{Name: "order", PrimaryKey: "id", Columns: []Column{{Name: "id"}, {Name: "total"}}}},
+		{QualifiedName: "public.order_tmp", Table: Table{Name: "order_tmp", Columns: []Column{{Name: "id"}}}},
+		{QualifiedName: "public.person", Table: Table{Name: "person", PrimaryKey: "id", Columns: []Column{{Name: "id"}, {Name: "name"}}}},
+	}
+
+	d := Database{
+		Include: []string{"public.*", "!*_tmp"},
+		Exclude: []string{"audit.*"},
+		Tables: []Table{
+			{Name: "public.person", ReadLimit: 10},
+			{Name: "view", Columns: []Column{{Name: "id"}}},
+		},
+	}
+
+	act, err := d.ExpandTables(catalog)
+	assert.Nil(t, err)
+	assert.Nil(t, act.Include)
+	assert.Nil(t, act.Exclude)
+	assert.Equal(t, []Table{
+		{Name: "public.person", ReadLimit: 10, PrimaryKey: "id", Columns: []Column{{Name: "id"}, {Name: "name"}}},
+		{Name: "view", Columns: []Column{{Name: "id"}}},
+		{Name: "order", PrimaryKey: "id", Columns: []Column{{Name: "id"}, {Name: "total"}}},
+	}, act.Tables)
+
+	// Exclude patterns also apply to configured tables.
+	d.Exclude = []string{"/^vie/"}
+	act, err = d.ExpandTables(catalog)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"public.person", "order"}, tableNames(act.Tables))
+}
+
+func TestExpandTablesReadSettings(t *testing.T) {
+	catalog := []CatalogTable{
+		{QualifiedName: "public.order", Table: Table{Name: "order", Columns: []Column{{Name: "id"}}}},
+		{QualifiedName: "public.person", Table: Table{Name: "person", Columns: []Column{{Name: "id"}}}},
+	}
+
+	d := Database{
+		Include:   []string{"public.*"},
+		ReadLimit: 1000,
+		ReadDelay: time.Second,
+		Tables:    []Table{{Name: "person", ReadLimit: 10}},
+	}
+
+	// Only the tables selected from the catalog take the database's settings.
+	act, err := d.ExpandTables(catalog)
+	assert.Nil(t, err)
+	assert.Equal(t, []Table{
+		{Name: "person", ReadLimit: 10, Columns: []Column{{Name: "id"}}},
+		{Name: "order", ReadLimit: 1000, ReadDelay: time.Second, Columns: []Column{{Name: "id"}}},
+	}, act.Tables)
+}
+
+func TestExpandTablesWithoutPatterns(t *testing.T) {
+	d := Database{Tables: []Table{{Name: "person"}}}
+
+	act, err := d.ExpandTables(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, d, act)
+}
+
+func TestSelectTables(t *testing.T) {
+	d := Database{Tables: []Table{{Name: "order"}, {Name: "order_tmp"}, {Name: "person"}}}
+
+	cases := []struct {
+		name    string
+		include []string
+		exclude []string
+		exp     []string
+		expErr  error
+	}{
+		{name: "all", exp: []string{"order", "order_tmp", "person"}},
+		{name: "include", include: []string{"order*"}, exp: []string{"order", "order_tmp"}},
+		{name: "include with negation", include: []string{"order*", "!*_tmp"}, exp: []string{"order"}},
+		{name: "exclude", exclude: []string{"*_tmp", "person"}, exp: []string{"order"}},
+		{name: "none", include: []string{"missing"}, expErr: fmt.Errorf("no tables selected")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := d.SelectTables(c.include, c.exclude)
+			assert.Equal(t, c.expErr, err)
+			assert.Equal(t, c.exp, tableNames(act.Tables))
+		})
+	}
+}
+
+func tableNames(tables []Table) []string {
+	var names []string
+	for _, t := range tables {
+		names = append(names, t.Name)
+	}
+	return names
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ResolveSecrets returns the config with the URLs of its source and target
+// read from their url_file and password_file, if they're configured.
+func (c Config) ResolveSecrets() (Config, error) {
+	var err error
+	if c.Source, err = c.Source.resolveSecrets(); err != nil {
+		return Config{}, fmt.Errorf("source: %w", err)
+	}
+	if c.Target, err = c.Target.resolveSecrets(); err != nil {
+		return Config{}, fmt.Errorf("target: %w", err)
+	}
+	return c, nil
+}
+
+// Secrets returns the passwords in the config's connection URLs, so they can
+// be redacted from logs and errors.
+func (c Config) Secrets() []string {
+	var secrets []string
+	for _, rawURL := range []string{c.Source.URL, c.Target.URL, c.State.URL} {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if password, ok := u.User.Password(); ok && password != "" {
+			secrets = append(secrets, password)
+		}
+	}
+	return secrets
+}
+
+// resolveSecrets reads the database's URL from its url_file and sets its
+// password from its password_file, if either is configured. Both files are
+// trimmed of surrounding whitespace, such as the trailing newline of a
+// mounted secret.
+func (d Database) resolveSecrets() (Database, error) {
+	if d.URLFile != "" {
+		if d.URL != "" {
+			return Database{}, fmt.Errorf("url and url_file can't both be set")
+		}
+
+		var err error
+		if d.URL, err = readSecret(d.URLFile); err != nil {
+			return Database{}, fmt.Errorf("reading url_file: %w", err)
+		}
+	}
+
+	if d.PasswordFile != "" {
+		password, err := readSecret(d.PasswordFile)
+		if err != nil {
+			return Database{}, fmt.Errorf("reading password_file: %w", err)
+		}
+
+		// Errors from parsing the URL can include it, so they're left out.
+		u, err := url.Parse(d.URL)
+		if err != nil || u.Scheme == "" {
+			return Database{}, fmt.Errorf("password_file requires a url of the form scheme://user@host/database")
+		}
+		if u.User == nil {
+			return Database{}, fmt.Errorf("password_file requires a url with a user")
+		}
+
+		u.User = url.UserPassword(u.User.Username(), password)
+		d.URL = u.String()
+	}
+
+	return d, nil
+}
+
+func readSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
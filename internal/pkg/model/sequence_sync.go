@@ -0,0 +1,32 @@
+package model
+
+import "fmt"
+
+// SequenceSync determines how the sequences behind a target table's columns,
+// such as serial and identity columns, are advanced once rows have been
+// loaded into it, so the application's next inserts don't collide with them.
+type SequenceSync string
+
+const (
+	// SequenceSyncMax advances each sequence past the largest value in its
+	// column.
+	SequenceSyncMax SequenceSync = "max"
+
+	// SequenceSyncSource advances each sequence to the current value of the
+	// sequence behind the source table's column, or past the largest value in
+	// its column, whichever is further.
+	SequenceSyncSource SequenceSync = "source"
+
+	// SequenceSyncNone leaves sequences as they are.
+	SequenceSyncNone SequenceSync = "none"
+)
+
+// Validate returns an error if the sequence sync isn't recognised.
+func (s SequenceSync) Validate() error {
+	switch s {
+	case "", SequenceSyncMax, SequenceSyncSource, SequenceSyncNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid sequence sync: %q", s)
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceSyncValidate(t *testing.T) {
+	cases := []struct {
+		name         string
+		sequenceSync SequenceSync
+		expErr       error
+	}{
+		{name: "default", sequenceSync: ""},
+		{name: "max", sequenceSync: SequenceSyncMax},
+		{name: "source", sequenceSync: SequenceSyncSource},
+		{name: "none", sequenceSync: SequenceSyncNone},
+		{name: "invalid", sequenceSync: "reset", expErr: fmt.Errorf(`invalid sequence sync: "reset"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expErr, c.sequenceSync.Validate())
+		})
+	}
+}
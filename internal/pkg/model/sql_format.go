@@ -0,0 +1,26 @@
+package model
+
+import "fmt"
+
+// SQLFormat determines how rows are written to SQL files.
+type SQLFormat string
+
+const (
+	// SQLFormatInsert writes each batch of rows as an INSERT statement, or an
+	// upsert when updating.
+	SQLFormatInsert SQLFormat = "insert"
+
+	// SQLFormatCopy writes each batch of rows as a COPY FROM STDIN block in
+	// Postgres' text format.
+	SQLFormatCopy SQLFormat = "copy"
+)
+
+// Validate returns an error if the SQL format isn't recognised.
+func (f SQLFormat) Validate() error {
+	switch f {
+	case "", SQLFormatInsert, SQLFormatCopy:
+		return nil
+	default:
+		return fmt.Errorf("invalid sql format: %q", f)
+	}
+}
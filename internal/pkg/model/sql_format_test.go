@@ -0,0 +1,27 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLFormatValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		format SQLFormat
+		expErr error
+	}{
+		{name: "default", format: ""},
+		{name: "insert", format: SQLFormatInsert},
+		{name: "copy", format: SQLFormatCopy},
+		{name: "invalid", format: "csv", expErr: fmt.Errorf(`invalid sql format: "csv"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expErr, c.format.Validate())
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// defaultStateTable is the name of the state table if one isn't configured.
+const defaultStateTable = "_shift_state"
+
+// runsTable is the name of the table that records the history of each run.
+const runsTable = "_shift_runs"
+
+// locksTable is the name of the table that holds each table's lock.
+const locksTable = "_shift_locks"
+
+// defaultLockTTL is how long a lock lasts without being renewed if a lock TTL
+// isn't configured.
+const defaultLockTTL = time.Minute
+
+// State configures where table offsets are stored.
+type State struct {
+	// Store selects where offsets are stored: "target" (default) stores them
+	// in a table in the target database, "database" in a table in a separate
+	// database and "file" in a local JSON file.
+	Store string `yaml:"store"`
+
+	// URL is the connection URL of the database used by the database store.
+	URL string `yaml:"url"`
+
+	// Path is the location of the file used by the file store.
+	Path string `yaml:"path"`
+
+	// Schema is the schema containing the state table, if not the default.
+	Schema string `yaml:"schema"`
+
+	// Table is the name of the state table; defaults to _shift_state.
+	Table string `yaml:"table"`
+
+	// LockTTL is how long a run's table locks last without being renewed;
+	// defaults to one minute.
+	LockTTL time.Duration `yaml:"lock_ttl"`
+}
+
+// Name returns the state table's unqualified name.
+func (s State) Name() string {
+	if s.Table == "" {
+		return defaultStateTable
+	}
+	return s.Table
+}
+
+// TableName returns the state table's name, qualified with its schema if one
+// has been configured.
+func (s State) TableName() string {
+	return s.qualify(s.Name())
+}
+
+// RunsTableName returns the name of the run history table, qualified with the
+// state table's schema if one has been configured.
+func (s State) RunsTableName() string {
+	return s.qualify(runsTable)
+}
+
+// LocksTableName returns the name of the lock table, qualified with the state
+// table's schema if one has been configured.
+func (s State) LocksTableName() string {
+	return s.qualify(locksTable)
+}
+
+// LockDuration returns how long a lock lasts without being renewed.
+func (s State) LockDuration() time.Duration {
+	if s.LockTTL <= 0 {
+		return defaultLockTTL
+	}
+	return s.LockTTL
+}
+
+func (s State) qualify(name string) string {
+	if s.Schema == "" {
+		return name
+	}
+	return s.Schema + "." + name
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateTableName(t *testing.T) {
+	cases := []struct {
+		name  string
+		state State
+		exp   string
+	}{
+		{name: "default", state: State{}, exp: "_shift_state"},
+		{name: "table", state: State{Table: "checkpoints"}, exp: "checkpoints"},
+		{name: "schema", state: State{Schema: "ds"}, exp: "ds._shift_state"},
+		{name: "schema and table", state: State{Schema: "ds", Table: "checkpoints"}, exp: "ds.checkpoints"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, c.state.TableName())
+		})
+	}
+}
+
+func TestStateRunsTableName(t *testing.T) {
+	assert.Equal(t, "_shift_runs", State{}.RunsTableName())
+	assert.Equal(t, "_shift_runs", State{Table: "checkpoints"}.RunsTableName())
+	assert.Equal(t, "ds._shift_runs", State{Schema: "ds"}.RunsTableName())
+}
+
+func TestStateLocksTableName(t *testing.T) {
+	assert.Equal(t, "_shift_locks", State{}.LocksTableName())
+	assert.Equal(t, "ds._shift_locks", State{Schema: "ds"}.LocksTableName())
+}
+
+func TestStateLockDuration(t *testing.T) {
+	assert.Equal(t, time.Minute, State{}.LockDuration())
+	assert.Equal(t, 10*time.Second, State{LockTTL: 10 * time.Second}.LockDuration())
+}
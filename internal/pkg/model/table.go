@@ -29,6 +29,44 @@ type Table struct {
 	// ReadDelay throttles reads from the source so neither database gets hammered.
 	ReadDelay time.Duration `yaml:"read_delay"`
 	Columns   []Column      `yaml:"columns"`
+
+	// ExtraColumns are target columns that have no source column. They're
+	// never loaded, so they take their default values.
+	ExtraColumns []Column `yaml:"extra_columns"`
+
+	// OnConflict determines how existing target rows are treated during an
+	// update; defaults to source_wins.
+	OnConflict ConflictStrategy `yaml:"on_conflict"`
+
+	// VersionColumn is compared between source and target rows when
+	// OnConflict is newest_wins.
+	VersionColumn string `yaml:"version_column"`
+
+	// LoadMode determines how rows are loaded into the table during an
+	// insert; defaults to append.
+	LoadMode LoadMode `yaml:"load_mode"`
+
+	// SequenceSync determines how the sequences behind the table's columns
+	// are advanced once rows have been loaded into it; defaults to max.
+	SequenceSync SequenceSync `yaml:"sequence_sync"`
+
+	// RowEstimate determines how the table's row count is estimated for
+	// progress reporting; defaults to count.
+	RowEstimate RowEstimate `yaml:"row_estimate"`
+
+	// File is the path or glob of the table's files, relative to the
+	// database's path, when reading from files.
+	File string `yaml:"file"`
+
+	// Windows are the maintenance windows during which the source table may
+	// be shifted, replacing the job's windows.
+	Windows []Window `yaml:"windows"`
+}
+
+// IsTargetOf returns true if the target table is loaded from the named source
+// table, either by its source_name or, if they share it, its name.
+func (t Table) IsTargetOf(source string) bool {
+	return t.SourceName == source || t.Name == source
 }
 
 // SelectStatement returns a SELECT statement for a table's columns.
@@ -50,29 +88,110 @@ func (t Table) SelectStatement(offset int) string {
 	)
 }
 
-func (t Table) UpsertStatement(sourceValues Values) (string, error) {
-	colums := t.ColumnNames()
+// CountStatement returns a statement that counts the rows a SelectStatement
+// would read in total. Filters are counted in a subquery, so those that order
+// or limit the table's rows are counted as they're read.
+func (t Table) CountStatement() string {
+	if t.Filter == "" {
+		return fmt.Sprintf("SELECT COUNT(*) FROM %s", t.Name)
+	}
+	return fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s %s) AS _shift_count", t.Name, t.Filter)
+}
 
+// UpsertStatement returns an INSERT statement for a batch of source values
+// that resolves conflicts with existing target rows using the table's
+// conflict strategy.
+func (t Table) UpsertStatement(sourceValues Values) (string, error) {
 	params, err := sourceValues.ToParams()
 	if err != nil {
 		return "", fmt.Errorf("creating params for upsert: %w", err)
 	}
 
+	return t.UpsertValuesStatement(params)
+}
+
+// UpsertValuesStatement returns the same statement as UpsertStatement for an
+// already formatted list of rows, such as the literal values written to SQL
+// files.
+func (t Table) UpsertValuesStatement(params string) (string, error) {
+	if err := t.OnConflict.Validate(); err != nil {
+		return "", err
+	}
+
+	colums := t.ColumnNames()
+
+	switch t.OnConflict {
+	case ConflictTargetWins, ConflictError:
+		return fmt.Sprintf(
+			`INSERT INTO %s AS _shift_t (%s) VALUES %s
+		 ON CONFLICT (%s) DO NOTHING`,
+			t.Name,
+			strings.Join(colums, ", "),
+			params,
+			t.PrimaryKey,
+		), nil
+	}
+
 	fieldsForSet, err := t.fieldsForSetStatement()
 	if err != nil {
 		return "", fmt.Errorf("creating fields for set statement: %w", err)
 	}
 
+	where := "_shift_t IS DISTINCT FROM EXCLUDED"
+	if t.OnConflict == ConflictNewestWins {
+		if t.VersionColumn == "" {
+			return "", fmt.Errorf("missing version_column for %s conflict strategy", ConflictNewestWins)
+		}
+		where += fmt.Sprintf(" AND _shift_t.%s < EXCLUDED.%s", t.VersionColumn, t.VersionColumn)
+	}
+
 	return fmt.Sprintf(
 		`INSERT INTO %s AS _shift_t (%s) VALUES %s
 		 ON CONFLICT (%s) DO UPDATE
 		 SET %s
-		 WHERE _shift_t IS DISTINCT FROM EXCLUDED`,
+		 WHERE %s`,
 		t.Name,
 		strings.Join(colums, ", "),
 		params,
 		t.PrimaryKey,
 		fieldsForSet,
+		where,
+	), nil
+}
+
+// ConflictStatement returns a statement that selects the primary keys of
+// target rows that differ from their source values. Only the table's loaded
+// columns are compared, so columns that take their default values in the
+// target don't count as conflicts, and the rows themselves are left untouched.
+// It's used by the error conflict strategy after new rows have been inserted,
+// with the same arguments as the insert.
+func (t Table) ConflictStatement(sourceValues Values) (string, error) {
+	columns := t.ColumnNames()
+	pk := lo.IndexOf(columns, t.PrimaryKey)
+	if pk == -1 {
+		return "", fmt.Errorf("primary_key %s isn't one of the table's columns", t.PrimaryKey)
+	}
+
+	targetColumns := strings.Join(lo.Map(columns, func(c string, _ int) string {
+		return "_shift_t." + c
+	}), ", ")
+
+	rows := make([]string, len(sourceValues))
+	argIdx := 0
+	for i, row := range sourceValues {
+		params := lo.Times(len(row), func(j int) string {
+			return fmt.Sprintf("$%d", argIdx+j+1)
+		})
+		rows[i] = fmt.Sprintf("(_shift_t.%s = %s AND (%s) IS DISTINCT FROM (%s))", t.PrimaryKey, params[pk], targetColumns, strings.Join(params, ", "))
+		argIdx += len(row)
+	}
+
+	return fmt.Sprintf(
+		`SELECT _shift_t.%s FROM %s AS _shift_t
+		 WHERE %s`,
+		t.PrimaryKey,
+		t.Name,
+		strings.Join(rows, "\n\t\t OR "),
 	), nil
 }
 
@@ -98,6 +217,12 @@ func (t Table) fieldsForSetStatement() (string, error) {
 	return sb.String(), nil
 }
 
+// PrefixedName returns the table's name with a prefix, used to name shadow
+// tables that sit alongside it.
+func (t Table) PrefixedName(prefix string) string {
+	return prefix + t.Name
+}
+
 // ColumnNames returns a slice of strings representing a table's column names.
 func (t Table) ColumnNames() []string {
 	return lo.Map(t.Columns, func(c Column, _ int) string {
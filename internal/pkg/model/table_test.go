@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -50,31 +51,174 @@ func TestSelectStatement(t *testing.T) {
 	}
 }
 
+func TestCountStatement(t *testing.T) {
+	cases := []struct {
+		name  string
+		table Table
+		exp   string
+	}{
+		{
+			name:  "no filter",
+			table: Table{Name: "test"},
+			exp:   `SELECT COUNT(*) FROM test`,
+		},
+		{
+			name:  "filter",
+			table: Table{Name: "test", Filter: "WHERE col < '2023-01-01'"},
+			exp:   `SELECT COUNT(*) FROM (SELECT 1 FROM test WHERE col < '2023-01-01') AS _shift_count`,
+		},
+		{
+			name:  "filter with order and limit",
+			table: Table{Name: "test", Filter: "WHERE col < '2023-01-01' ORDER BY col LIMIT 10"},
+			exp:   `SELECT COUNT(*) FROM (SELECT 1 FROM test WHERE col < '2023-01-01' ORDER BY col LIMIT 10) AS _shift_count`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, c.table.CountStatement())
+		})
+	}
+}
+
 func TestUpsertStatement(t *testing.T) {
+	columns := []Column{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "c"},
+	}
+
+	sourceValues := Values{
+		[]any{"a", 1, time.Date(2023, 1, 1, 1, 1, 1, 1, time.UTC)},
+		[]any{"b", 2, time.Date(2023, 2, 2, 2, 2, 2, 2, time.UTC)},
+		[]any{"c", 3, time.Date(2023, 3, 3, 3, 3, 3, 3, time.UTC)},
+	}
+
+	cases := []struct {
+		name   string
+		table  Table
+		exp    string
+		expErr error
+	}{
+		{
+			name: "default conflict strategy",
+			table: Table{
+				Name:       "test",
+				ReadLimit:  10,
+				Columns:    columns,
+				PrimaryKey: "id",
+			},
+			exp: "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO UPDATE\n\t\t SET a = EXCLUDED.a, b = EXCLUDED.b, c = EXCLUDED.c\n\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED",
+		},
+		{
+			name: "source wins",
+			table: Table{
+				Name:       "test",
+				Columns:    columns,
+				PrimaryKey: "id",
+				OnConflict: ConflictSourceWins,
+			},
+			exp: "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO UPDATE\n\t\t SET a = EXCLUDED.a, b = EXCLUDED.b, c = EXCLUDED.c\n\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED",
+		},
+		{
+			name: "target wins",
+			table: Table{
+				Name:       "test",
+				Columns:    columns,
+				PrimaryKey: "id",
+				OnConflict: ConflictTargetWins,
+			},
+			exp: "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO NOTHING",
+		},
+		{
+			name: "error",
+			table: Table{
+				Name:       "test",
+				Columns:    columns,
+				PrimaryKey: "id",
+				OnConflict: ConflictError,
+			},
+			exp: "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO NOTHING",
+		},
+		{
+			name: "newest wins",
+			table: Table{
+				Name:          "test",
+				Columns:       columns,
+				PrimaryKey:    "id",
+				OnConflict:    ConflictNewestWins,
+				VersionColumn: "c",
+			},
+			exp: "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO UPDATE\n\t\t SET a = EXCLUDED.a, b = EXCLUDED.b, c = EXCLUDED.c\n\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED AND _shift_t.c < EXCLUDED.c",
+		},
+		{
+			name: "newest wins without version column",
+			table: Table{
+				Name:       "test",
+				Columns:    columns,
+				PrimaryKey: "id",
+				OnConflict: ConflictNewestWins,
+			},
+			expErr: fmt.Errorf("missing version_column for newest_wins conflict strategy"),
+		},
+		{
+			name: "invalid strategy",
+			table: Table{
+				Name:       "test",
+				Columns:    columns,
+				PrimaryKey: "id",
+				OnConflict: "invalid",
+			},
+			expErr: fmt.Errorf(`invalid conflict strategy: "invalid"`),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := c.table.UpsertStatement(sourceValues)
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
+
+func TestConflictStatement(t *testing.T) {
 	table := Table{
-		Name:      "test",
-		ReadLimit: 10,
+		Name: "test",
 		Columns: []Column{
-			{Name: "a"},
+			{Name: "id"},
 			{Name: "b"},
-			{Name: "c"},
 		},
 		PrimaryKey: "id",
+		OnConflict: ConflictError,
 	}
 
 	sourceValues := Values{
-		[]any{"a", 1, time.Date(2023, 1, 1, 1, 1, 1, 1, time.UTC)},
-		[]any{"b", 2, time.Date(2023, 2, 2, 2, 2, 2, 2, time.UTC)},
-		[]any{"c", 3, time.Date(2023, 3, 3, 3, 3, 3, 3, time.UTC)},
+		[]any{"a", 1},
+		[]any{"b", 2},
 	}
 
-	act, err := table.UpsertStatement(sourceValues)
+	act, err := table.ConflictStatement(sourceValues)
 	assert.Nil(t, err)
 
-	exp := "INSERT INTO test AS _shift_t (a, b, c) VALUES ($1, $2, $3), ($4, $5, $6), ($7, $8, $9)\n\t\t ON CONFLICT (id) DO UPDATE\n\t\t SET a = EXCLUDED.a, b = EXCLUDED.b, c = EXCLUDED.c\n\t\t WHERE _shift_t IS DISTINCT FROM EXCLUDED"
+	exp := "SELECT _shift_t.id FROM test AS _shift_t\n\t\t WHERE (_shift_t.id = $1 AND (_shift_t.id, _shift_t.b) IS DISTINCT FROM ($1, $2))\n\t\t OR (_shift_t.id = $3 AND (_shift_t.id, _shift_t.b) IS DISTINCT FROM ($3, $4))"
 	assert.Equal(t, exp, act)
+
+	table.PrimaryKey = "uuid"
+	_, err = table.ConflictStatement(sourceValues)
+	assert.EqualError(t, err, "primary_key uuid isn't one of the table's columns")
 }
 
 func TestColumnNames(t *testing.T) {
 
 }
+
+func TestPrefixedName(t *testing.T) {
+	table := Table{Name: "person"}
+
+	assert.Equal(t, "_shift_new_person", table.PrefixedName("_shift_new_"))
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultMaxDelay is the longest the throttle waits between batches if a
+// max_delay isn't configured.
+const defaultMaxDelay = 30 * time.Second
+
+// Throttle configures how reads from the source are slowed down to protect
+// the source and target databases. Each table's read_delay is the least it
+// waits between batches.
+type Throttle struct {
+	// RowsPerSecond caps the rate at which rows are read from each table.
+	RowsPerSecond int `yaml:"rows_per_second"`
+
+	// MaxBatchLatency is the longest a batch should take to read or write;
+	// the delay between batches grows while batches take longer, and shrinks
+	// again once they don't.
+	MaxBatchLatency time.Duration `yaml:"max_batch_latency"`
+
+	// AdmissionControl also grows the delay between batches while the target
+	// CockroachDB cluster has work queued by admission control.
+	AdmissionControl bool `yaml:"admission_control"`
+
+	// MaxDelay is the longest the delay between batches can grow to;
+	// defaults to 30s.
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+// DelayLimit returns the longest the delay between batches can grow to.
+func (t Throttle) DelayLimit() time.Duration {
+	if t.MaxDelay <= 0 {
+		return defaultMaxDelay
+	}
+	return t.MaxDelay
+}
+
+// Validate returns every problem with the throttle's settings.
+func (t Throttle) Validate() []error {
+	var errs []error
+	if t.RowsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("invalid rows_per_second: %d", t.RowsPerSecond))
+	}
+	if t.MaxBatchLatency < 0 {
+		errs = append(errs, fmt.Errorf("invalid max_batch_latency: %s", t.MaxBatchLatency))
+	}
+	if t.MaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("invalid max_delay: %s", t.MaxDelay))
+	}
+	return errs
+}
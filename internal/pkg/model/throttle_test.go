@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleDelayLimit(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Throttle{}.DelayLimit())
+	assert.Equal(t, time.Minute, Throttle{MaxDelay: time.Minute}.DelayLimit())
+}
+
+func TestThrottleValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		throttle Throttle
+		exp      []error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "valid",
+			throttle: Throttle{
+				RowsPerSecond:    1000,
+				MaxBatchLatency:  time.Second,
+				AdmissionControl: true,
+				MaxDelay:         time.Minute,
+			},
+		},
+		{
+			name: "invalid",
+			throttle: Throttle{
+				RowsPerSecond:   -1,
+				MaxBatchLatency: -time.Second,
+				MaxDelay:        -time.Minute,
+			},
+			exp: []error{
+				fmt.Errorf("invalid rows_per_second: -1"),
+				fmt.Errorf("invalid max_batch_latency: -1s"),
+				fmt.Errorf("invalid max_delay: -1m0s"),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, c.throttle.Validate())
+		})
+	}
+}
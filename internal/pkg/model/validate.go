@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samber/lo"
+)
+
+// Validate checks the config for mistakes that can be found without
+// connecting to either database, returning every problem it finds. If upsert
+// is true, tables are also checked for what upserts need, such as a primary
+// key.
+func (c Config) Validate(upsert bool) error {
+	var errs []error
+	add := func(prefix string, problems ...error) {
+		for _, err := range problems {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+			}
+		}
+	}
+
+	add("source", c.Source.validate(true)...)
+	add("target", c.Target.validate(false)...)
+	add("throttle", c.Throttle.Validate()...)
+	add("batch_size", c.BatchSize.Validate()...)
+	add("windows", validateWindows(c.Windows)...)
+	if c.Throttle.AdmissionControl && c.Target.IsFile() {
+		errs = append(errs, fmt.Errorf("throttle: admission_control requires a target database"))
+	}
+
+	if len(c.Source.Tables) == 0 && len(c.Source.Include) == 0 {
+		errs = append(errs, fmt.Errorf("source: missing tables"))
+	}
+
+	// Tables selected by patterns, and the columns of configured tables that
+	// match them, are only known once the patterns are expanded, after which
+	// the config is validated again.
+	for i, sourceTable := range c.Source.Tables {
+		if sourceTable.Name == "" {
+			errs = append(errs, fmt.Errorf("source table %d: missing name", i+1))
+			continue
+		}
+		add("source table "+sourceTable.Name, sourceTable.validate(len(c.Source.Include) > 0)...)
+
+		// Catalog statistics are read from Postgres' pg_class, which files
+		// don't have.
+		if sourceTable.RowEstimate == EstimateStats && c.Source.IsFile() {
+			errs = append(errs, fmt.Errorf("source table %s: row_estimate %s requires a source database", sourceTable.Name, EstimateStats))
+		}
+
+		targetTable, err := c.Target.GetTargetTable(sourceTable)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		add("target table "+targetTable.Name, targetTable.validate(len(c.Source.Include) > 0 || len(c.Target.Include) > 0)...)
+		add("target table "+targetTable.Name, targetTable.validateTarget(sourceTable, upsert)...)
+
+		if targetTable.SequenceSync == SequenceSyncSource && c.Source.IsFile() {
+			errs = append(errs, fmt.Errorf("target table %s: sequence_sync %s requires a source database", targetTable.Name, SequenceSyncSource))
+		}
+	}
+
+	// Target tables that don't name a source table are never used, which is
+	// usually because a renamed table is missing its source_name. Tables
+	// selected from the catalog needn't match the source, so they're skipped.
+	if len(c.Source.Include) == 0 && len(c.Target.Include) == 0 && !c.Target.expanded {
+		for _, targetTable := range c.Target.Tables {
+			if !lo.ContainsBy(c.Source.Tables, func(t Table) bool { return targetTable.IsTargetOf(t.Name) }) {
+				errs = append(errs, fmt.Errorf("target table %s: doesn't match a source table; ensure table names match, or set its source_name", targetTable.Name))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the settings of the source or target database.
+func (d Database) validate(source bool) []error {
+	var errs []error
+
+	switch {
+	case d.IsFile() && d.Path == "":
+		errs = append(errs, fmt.Errorf("missing path for %s files", d.Driver))
+	case !d.IsFile() && d.URL == "":
+		errs = append(errs, fmt.Errorf("missing url"))
+	}
+
+	// Target databases are always connected to with pgx, so only the source's
+	// driver is required.
+	if source && d.Driver == "" {
+		errs = append(errs, fmt.Errorf("missing driver"))
+	}
+
+	if d.RowsPerFile < SingleFile {
+		errs = append(errs, fmt.Errorf("invalid rows_per_file: %d", d.RowsPerFile))
+	}
+	if d.ReadLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid read_limit: %d", d.ReadLimit))
+	}
+	if d.ReadDelay < 0 {
+		errs = append(errs, fmt.Errorf("invalid read_delay: %s", d.ReadDelay))
+	}
+	if d.RowGroupSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid row_group_size: %d", d.RowGroupSize))
+	}
+
+	if d.IsFile() && len(d.Include) > 0 {
+		errs = append(errs, fmt.Errorf("include requires a database, rather than %s files", d.Driver))
+	}
+	for _, pattern := range append(d.Include, d.Exclude...) {
+		errs = append(errs, validatePattern(pattern))
+	}
+
+	return append(errs, d.Compression.Validate(), d.SQLFormat.Validate())
+}
+
+// validate checks the settings of a source or target table. Tables of
+// databases with include patterns can leave their columns to the catalog.
+func (t Table) validate(patterns bool) []error {
+	errs := []error{
+		t.OnConflict.Validate(),
+		t.LoadMode.Validate(),
+		t.SequenceSync.Validate(),
+		t.RowEstimate.Validate(),
+	}
+
+	if len(t.Columns) == 0 && !patterns {
+		errs = append(errs, fmt.Errorf("missing columns"))
+	}
+
+	for _, col := range lo.FindDuplicates(t.ColumnNames()) {
+		errs = append(errs, fmt.Errorf("duplicate column: %s", col))
+	}
+
+	if t.ReadLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid read_limit: %d", t.ReadLimit))
+	}
+	if t.ReadDelay < 0 {
+		errs = append(errs, fmt.Errorf("invalid read_delay: %s", t.ReadDelay))
+	}
+
+	return append(errs, validateWindows(t.Windows)...)
+}
+
+// validateTarget checks that a target table can receive the rows of its
+// source table. Its columns have already been merged over the source's, so
+// their number matches.
+func (t Table) validateTarget(source Table, upsert bool) []error {
+	var errs []error
+
+	for _, c := range t.ExtraColumns {
+		if lo.Contains(t.ColumnNames(), c.Name) {
+			errs = append(errs, fmt.Errorf("extra column %s is loaded from source table %s", c.Name, source.Name))
+		}
+	}
+
+	if t.PrimaryKey != "" && !lo.Contains(t.ColumnNames(), t.PrimaryKey) {
+		errs = append(errs, fmt.Errorf("primary_key %s isn't one of the table's columns", t.PrimaryKey))
+	}
+
+	if t.OnConflict == ConflictNewestWins && t.VersionColumn == "" {
+		errs = append(errs, fmt.Errorf("missing version_column for %s conflict strategy", ConflictNewestWins))
+	}
+
+	if upsert && t.PrimaryKey == "" {
+		errs = append(errs, fmt.Errorf("missing primary_key for upserts"))
+	}
+
+	return errs
+}
@@ -0,0 +1,248 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{
+			Source: Database{
+				Driver: "pgx",
+				URL:    "postgres://source",
+				Tables: []Table{
+					{Name: "person", Columns: []Column{{Name: "id"}, {Name: "name"}}},
+				},
+			},
+			Target: Database{
+				URL: "postgres://target",
+				Tables: []Table{
+					{Name: "people", SourceName: "person", PrimaryKey: "id", Columns: []Column{{Name: "id"}, {Name: "full_name"}}},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		config  func(c *Config)
+		upsert  bool
+		expErrs []string
+	}{
+		{
+			name:   "valid",
+			config: func(c *Config) {},
+			upsert: true,
+		},
+		{
+			name: "missing connection details",
+			config: func(c *Config) {
+				c.Source.Driver = ""
+				c.Source.URL = ""
+				c.Target = Database{Driver: DriverCSV, Tables: c.Target.Tables}
+			},
+			expErrs: []string{
+				"source: missing url",
+				"source: missing driver",
+				"target: missing path for csv files",
+			},
+		},
+		{
+			name: "invalid settings",
+			config: func(c *Config) {
+				c.Target.Compression = "lz4"
+				c.Source.Tables[0].ReadLimit = -1
+				c.Source.Tables[0].Columns = append(c.Source.Tables[0].Columns, Column{Name: "id"})
+				c.Target.Tables[0].OnConflict = ConflictNewestWins
+				c.Target.Tables[0].Columns = append(c.Target.Tables[0].Columns, Column{Name: "age"})
+			},
+			expErrs: []string{
+				`target: invalid compression: "lz4"`,
+				"source table person: duplicate column: id",
+				"source table person: invalid read_limit: -1",
+				"target table people: missing version_column for newest_wins conflict strategy",
+			},
+		},
+		{
+			name: "target tables derived from source",
+			config: func(c *Config) {
+				c.Source.Tables[0].PrimaryKey = "id"
+				c.Target.Tables = nil
+			},
+			upsert: true,
+		},
+		{
+			name: "unmatched target table",
+			config: func(c *Config) {
+				c.Target.Tables[0].SourceName = ""
+			},
+			expErrs: []string{
+				"target table people: doesn't match a source table; ensure table names match, or set its source_name",
+			},
+		},
+		{
+			name: "partial target columns",
+			config: func(c *Config) {
+				c.Target.Tables[0].Columns = c.Target.Tables[0].Columns[:1]
+				c.Target.Tables[0].ExtraColumns = []Column{{Name: "created_at"}}
+			},
+		},
+		{
+			name: "too many target columns",
+			config: func(c *Config) {
+				c.Target.Tables[0].Columns = append(c.Target.Tables[0].Columns, Column{Name: "age"})
+			},
+			expErrs: []string{
+				"target table people: has 3 columns but source table person has 2; use extra_columns for columns it doesn't have",
+			},
+		},
+		{
+			name: "extra column loaded from source",
+			config: func(c *Config) {
+				c.Target.Tables[0].ExtraColumns = []Column{{Name: "full_name"}}
+			},
+			expErrs: []string{
+				"target table people: extra column full_name is loaded from source table person",
+			},
+		},
+		{
+			name: "missing primary key for upserts",
+			config: func(c *Config) {
+				c.Target.Tables[0].PrimaryKey = ""
+			},
+			upsert: true,
+			expErrs: []string{
+				"target table people: missing primary_key for upserts",
+			},
+		},
+		{
+			name: "unknown primary key",
+			config: func(c *Config) {
+				c.Target.Tables[0].PrimaryKey = "uuid"
+			},
+			expErrs: []string{
+				"target table people: primary_key uuid isn't one of the table's columns",
+			},
+		},
+		{
+			name: "include patterns",
+			config: func(c *Config) {
+				c.Source.Include = []string{"public.*", "!/^tmp_[/"}
+				c.Source.Tables = []Table{{Name: "order", ReadLimit: 10}}
+				c.Target.Include = []string{"*"}
+				c.Target.Tables = nil
+			},
+			expErrs: []string{
+				"source: invalid table pattern \"/^tmp_[/\": error parsing regexp",
+			},
+		},
+		{
+			name: "invalid include read settings",
+			config: func(c *Config) {
+				c.Source.Include = []string{"public.*"}
+				c.Source.ReadLimit = -1
+				c.Source.ReadDelay = -time.Second
+			},
+			expErrs: []string{
+				"source: invalid read_limit: -1",
+				"source: invalid read_delay: -1s",
+			},
+		},
+		{
+			name: "include patterns for files",
+			config: func(c *Config) {
+				c.Target.Driver = DriverCSV
+				c.Target.Path = "out"
+				c.Target.Include = []string{"*"}
+			},
+			expErrs: []string{
+				"target: include requires a database, rather than csv files",
+			},
+		},
+		{
+			name: "invalid throttle",
+			config: func(c *Config) {
+				c.Throttle = Throttle{RowsPerSecond: -1, AdmissionControl: true}
+				c.Target = Database{Driver: DriverCSV, Path: "out"}
+			},
+			expErrs: []string{
+				"throttle: invalid rows_per_second: -1",
+				"throttle: admission_control requires a target database",
+			},
+		},
+		{
+			name: "invalid windows",
+			config: func(c *Config) {
+				c.Windows = []Window{{Cron: "0 22 * *", Duration: time.Hour}}
+				c.Source.Tables[0].Windows = []Window{{Cron: "0 22 * * *"}}
+			},
+			expErrs: []string{
+				`windows: window 1: invalid cron expression "0 22 * *": expected 5 fields, got 4`,
+				"source table person: window 1: invalid duration: 0s",
+			},
+		},
+		{
+			name: "invalid sequence sync",
+			config: func(c *Config) {
+				c.Source.Tables[0].SequenceSync = "reset"
+				c.Target.Tables[0].SequenceSync = SequenceSyncSource
+			},
+			expErrs: []string{
+				`source table person: invalid sequence sync: "reset"`,
+			},
+		},
+		{
+			name: "sequence sync from file source",
+			config: func(c *Config) {
+				c.Source = Database{Driver: DriverCSV, Path: "in", Tables: []Table{
+					{Name: "person", File: "person.csv", Columns: []Column{{Name: "id"}, {Name: "name"}}, SequenceSync: SequenceSyncSource},
+				}}
+				c.Target.Tables = nil
+			},
+			expErrs: []string{
+				"target table person: sequence_sync source requires a source database",
+			},
+		},
+		{
+			name: "stats row estimate from file source",
+			config: func(c *Config) {
+				c.Source = Database{Driver: DriverCSV, Path: "in", Tables: []Table{
+					{Name: "person", File: "person.csv", Columns: []Column{{Name: "id"}, {Name: "name"}}, RowEstimate: EstimateStats},
+				}}
+				c.Target.Tables = nil
+			},
+			expErrs: []string{
+				"source table person: row_estimate stats requires a source database",
+			},
+		},
+		{
+			name: "missing tables",
+			config: func(c *Config) {
+				c.Source.Tables = nil
+			},
+			expErrs: []string{
+				"source: missing tables",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := valid()
+			c.config(&config)
+
+			err := config.Validate(c.upsert)
+			if len(c.expErrs) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			for _, exp := range c.expErrs {
+				assert.ErrorContains(t, err, exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"ds/internal/pkg/schedule"
+	"fmt"
+	"time"
+)
+
+// Window is a maintenance window, a recurring period of time during which
+// tables may be shifted.
+type Window struct {
+	// Cron is when the window opens, as a five-field cron expression
+	// ("minute hour day-of-month month day-of-week"), such as "0 22 * * *"
+	// for 22:00 each day.
+	Cron string `yaml:"cron"`
+
+	// Duration is how long the window stays open.
+	Duration time.Duration `yaml:"duration"`
+
+	// Timezone is the IANA time zone that Cron is evaluated in, such as
+	// Europe/London; defaults to UTC.
+	Timezone string `yaml:"timezone"`
+}
+
+// Schedule returns the window's schedule.
+func (w Window) Schedule() (schedule.Window, error) {
+	return schedule.NewWindow(w.Cron, w.Duration, w.Timezone)
+}
+
+// WindowsFor returns the schedules of the maintenance windows during which a
+// source table may be shifted: the table's own windows, if it has any, or the
+// job's otherwise. Tables without windows may be shifted at any time.
+func (c Config) WindowsFor(t Table) ([]schedule.Window, error) {
+	windows := t.Windows
+	if len(windows) == 0 {
+		windows = c.Windows
+	}
+
+	schedules := make([]schedule.Window, len(windows))
+	for i, w := range windows {
+		var err error
+		if schedules[i], err = w.Schedule(); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+	}
+
+	return schedules, nil
+}
+
+// validateWindows returns an error for each window that can't be scheduled.
+func validateWindows(windows []Window) []error {
+	var errs []error
+	for i, w := range windows {
+		if _, err := w.Schedule(); err != nil {
+			errs = append(errs, fmt.Errorf("window %d: %w", i+1, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsFor(t *testing.T) {
+	nights := Window{Cron: "0 22 * * *", Duration: 8 * time.Hour, Timezone: "Europe/London"}
+	weekends := Window{Cron: "0 0 * * sat", Duration: 48 * time.Hour}
+
+	// A Wednesday lunchtime, which neither window is open for.
+	at := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		config   Config
+		table    Table
+		expCount int
+		expErr   string
+	}{
+		{
+			name: "no windows",
+		},
+		{
+			name:     "job windows",
+			config:   Config{Windows: []Window{nights, weekends}},
+			expCount: 2,
+		},
+		{
+			name:     "table windows replace job windows",
+			config:   Config{Windows: []Window{nights, weekends}},
+			table:    Table{Windows: []Window{weekends}},
+			expCount: 1,
+		},
+		{
+			name:   "invalid window",
+			config: Config{Windows: []Window{nights, {Cron: "0 22 * * *", Timezone: "Mars/Olympus", Duration: time.Hour}}},
+			expErr: "window 2: invalid timezone: unknown time zone Mars/Olympus",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, err := c.config.WindowsFor(c.table)
+			if c.expErr != "" {
+				assert.EqualError(t, err, c.expErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Len(t, act, c.expCount)
+
+			for _, w := range act {
+				open, _ := w.Open(at)
+				assert.False(t, open)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package progress
+
+import (
+	"ds/internal/pkg/metrics"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// barWidth is the number of characters used to draw the progress bar.
+	barWidth = 30
+
+	// interactiveInterval is how often the progress bar is redrawn on a TTY.
+	interactiveInterval = 500 * time.Millisecond
+
+	// logInterval is how often a progress line is logged when not on a TTY.
+	logInterval = 10 * time.Second
+)
+
+// Tracker tracks the progress of a single table and periodically reports it,
+// as a progress bar when writing to a terminal and as log lines otherwise.
+type Tracker struct {
+	table       string
+	total       int64
+	out         io.Writer
+	interactive bool
+
+	mu      sync.Mutex
+	initial int64
+	done    int64
+	started time.Time
+	set     bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Start begins reporting progress for a table, given its estimated number of
+// rows (or zero, if unknown). Progress is written to stderr.
+func Start(table string, total int64) *Tracker {
+	t := &Tracker{
+		table:       table,
+		total:       total,
+		out:         os.Stderr,
+		interactive: term.IsTerminal(int(os.Stderr.Fd())),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	interval := logInterval
+	if t.interactive {
+		interval = interactiveInterval
+	}
+
+	go t.run(interval)
+
+	return t
+}
+
+// Set records the number of rows done, and reports the number still to do,
+// if the table's total is known, as its lag. The first call establishes the
+// starting point from which the rate is calculated, so resumed tables don't
+// report inflated rates. It's safe to call on a nil Tracker.
+func (t *Tracker) Set(done int64) {
+	if t == nil {
+		return
+	}
+
+	if t.total > 0 {
+		metrics.Lag.WithLabelValues(t.table).Set(float64(max(t.total-done, 0)))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.set {
+		t.initial = done
+		t.started = time.Now()
+		t.set = true
+	}
+	t.done = done
+}
+
+// Stop reports the table's final progress and stops reporting. It's safe to
+// call on a nil Tracker.
+func (t *Tracker) Stop() {
+	if t == nil {
+		return
+	}
+
+	close(t.stop)
+	<-t.stopped
+}
+
+func (t *Tracker) run(interval time.Duration) {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.report(false)
+		case <-t.stop:
+			t.report(true)
+			return
+		}
+	}
+}
+
+func (t *Tracker) report(final bool) {
+	s := t.Snapshot()
+
+	if !t.interactive {
+		slog.Info("progress", s.attrs()...)
+		return
+	}
+
+	line := fmt.Sprintf("\r%s %s", s.bar(), s.String())
+	if final {
+		line += "\n"
+	}
+	fmt.Fprint(t.out, line)
+}
+
+// Snapshot returns the table's current progress.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Snapshot{
+		Table: t.table,
+		Done:  t.done,
+		Total: t.total,
+	}
+
+	if !t.set {
+		return s
+	}
+
+	if elapsed := time.Since(t.started).Seconds(); elapsed > 0 {
+		s.Rate = float64(t.done-t.initial) / elapsed
+	}
+
+	if t.total > 0 {
+		s.Percent = math.Min(float64(t.done)/float64(t.total)*100, 100)
+
+		if s.Rate > 0 && t.done < t.total {
+			s.ETA = time.Duration(float64(t.total-t.done)/s.Rate) * time.Second
+		}
+	}
+
+	return s
+}
+
+// Snapshot captures a table's progress at a point in time.
+type Snapshot struct {
+	Table   string
+	Done    int64
+	Total   int64
+	Rate    float64
+	Percent float64
+	ETA     time.Duration
+}
+
+// String returns the snapshot as a line of key=value pairs.
+func (s Snapshot) String() string {
+	parts := []string{
+		fmt.Sprintf("table=%s", s.Table),
+		fmt.Sprintf("rows=%d", s.Done),
+	}
+
+	if s.Total > 0 {
+		parts = append(parts,
+			fmt.Sprintf("total=%d", s.Total),
+			fmt.Sprintf("percent=%.1f", s.Percent),
+		)
+	}
+
+	parts = append(parts, fmt.Sprintf("rate=%.0f/s", s.Rate))
+
+	if s.ETA > 0 {
+		parts = append(parts, fmt.Sprintf("eta=%s", s.ETA.Round(time.Second)))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (s Snapshot) attrs() []any {
+	attrs := []any{"table", s.Table, "rows", s.Done, "rate", math.Round(s.Rate)}
+
+	if s.Total > 0 {
+		attrs = append(attrs, "total", s.Total, "percent", math.Round(s.Percent*10)/10)
+	}
+
+	if s.ETA > 0 {
+		attrs = append(attrs, "eta", s.ETA.Round(time.Second))
+	}
+
+	return attrs
+}
+
+func (s Snapshot) bar() string {
+	filled := int(s.Percent / 100 * barWidth)
+	return fmt.Sprintf("[%s%s]", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled))
+}
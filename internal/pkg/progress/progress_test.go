@@ -0,0 +1,80 @@
+package progress
+
+import (
+	"ds/internal/pkg/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	tracker := &Tracker{table: "person", total: 200}
+
+	tracker.Set(50)
+	tracker.Set(100)
+
+	act := tracker.Snapshot()
+	assert.Equal(t, "person", act.Table)
+	assert.Equal(t, int64(100), act.Done)
+	assert.Equal(t, int64(200), act.Total)
+	assert.Equal(t, 50.0, act.Percent)
+	assert.True(t, act.Rate > 0)
+}
+
+func TestSnapshotNilTracker(t *testing.T) {
+	var tracker *Tracker
+
+	assert.NotPanics(t, func() {
+		tracker.Set(1)
+		tracker.Stop()
+	})
+}
+
+func TestSnapshotString(t *testing.T) {
+	cases := []struct {
+		name     string
+		snapshot Snapshot
+		exp      string
+	}{
+		{
+			name: "known total",
+			snapshot: Snapshot{
+				Table:   "person",
+				Done:    100,
+				Total:   200,
+				Rate:    10,
+				Percent: 50,
+				ETA:     10 * time.Second,
+			},
+			exp: "table=person rows=100 total=200 percent=50.0 rate=10/s eta=10s",
+		},
+		{
+			name: "unknown total",
+			snapshot: Snapshot{
+				Table: "person",
+				Done:  100,
+				Rate:  10,
+			},
+			exp: "table=person rows=100 rate=10/s",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, c.snapshot.String())
+		})
+	}
+}
+
+func TestSetLag(t *testing.T) {
+	tracker := &Tracker{table: "lagging", total: 200}
+
+	tracker.Set(50)
+	assert.Equal(t, 150.0, testutil.ToFloat64(metrics.Lag.WithLabelValues("lagging")))
+
+	// Estimates can be exceeded, but lag never goes negative.
+	tracker.Set(250)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.Lag.WithLabelValues("lagging")))
+}
@@ -0,0 +1,149 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/metrics"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/progress"
+	"ds/internal/pkg/throttle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ApplyTable replays the statements of a table's SQL files, written by an
+// export to a sql target, into the target database, and returns the number of
+// rows processed.
+//
+// Each statement holds one batch of rows from the export, so statements are
+// executed one at a time, paced by the pacer as batches would be, and the
+// offset is checkpointed after each. Outside of the table's maintenance
+// windows, it pauses before the next statement. Offsets count statements
+// rather than rows, so an interrupted apply resumes from the first statement
+// it didn't complete.
+func ApplyTable(ctx context.Context, dump model.Database, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer) (stats Stats, err error) {
+	ctx, span := tracer.Start(ctx, "apply table", trace.WithAttributes(
+		attribute.String("table", sourceTable.Name),
+		attribute.String("target", targetTable.Name),
+	))
+	defer func() { endSpan(span, err) }()
+
+	finish, err := trackStatus(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("setting status: %w", err)
+	}
+	defer func() {
+		if statusErr := finish(err); statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}()
+
+	// Fetch current offset.
+	offset, err := store.Offset(ctx, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("fetching current offset: %w", err)
+	}
+
+	r, err := file.NewReader(dump, sourceTable, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer r.Close()
+
+	// Skip the statements that have already been applied, counting their rows
+	// towards the table's progress.
+	var applied int64
+	for i := 0; i < offset; i++ {
+		stmt, err := r.ReadStatement()
+		if err != nil {
+			return stats, fmt.Errorf("skipping to offset %d: %w", offset, err)
+		}
+		applied += int64(stmt.Rows)
+	}
+	tracker.Set(applied)
+
+	logger := slog.With("table", sourceTable.Name, "target", targetTable.Name)
+	logger.Info("applying statements", "offset", offset, "path", dump.Path)
+
+	runStart, statements := time.Now(), 0
+
+	for {
+		if err = pacer.Open(ctx); err != nil {
+			return stats, err
+		}
+
+		stmt, err := r.ReadStatement()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("reading statement: %w", err)
+		}
+		metrics.RowsRead.WithLabelValues(sourceTable.Name).Add(float64(stmt.Rows))
+		stats.RowsRead += int64(stmt.Rows)
+
+		start := time.Now()
+		writeCtx, writeSpan := tracer.Start(ctx, "write", trace.WithAttributes(
+			attribute.String("db.statement", stmt.SQL),
+			attribute.Int("offset", offset),
+			attribute.Int("rows", stmt.Rows),
+		))
+		var tag pgconn.CommandTag
+		err = withRetries(writeCtx, sourceTable.Name, func() (err error) {
+			tag, err = execStatement(writeCtx, targetDB, stmt)
+			return err
+		})
+		endSpan(writeSpan, err)
+		if err != nil {
+			return stats, fmt.Errorf("applying statement %d: %w", offset+1, err)
+		}
+		metrics.WriteDuration.WithLabelValues(sourceTable.Name).Observe(time.Since(start).Seconds())
+		metrics.RowsWritten.WithLabelValues(sourceTable.Name).Add(float64(tag.RowsAffected()))
+		pacer.Observe(stmt.Rows, len(stmt.SQL)+len(stmt.Data), 0, time.Since(start))
+		stats.RowsWritten += tag.RowsAffected()
+
+		// Set current offset.
+		offset++
+		if err = checkpointOffset(ctx, store, sourceTable.Name, offset); err != nil {
+			return stats, fmt.Errorf("setting current offset: %w", err)
+		}
+		applied += int64(stmt.Rows)
+		tracker.Set(applied)
+
+		statements++
+		logger.Debug("statement applied", "offset", offset, "rows", tag.RowsAffected(), "duration", time.Since(start))
+
+		if err = pacer.Wait(ctx, stmt.Rows); err != nil {
+			return stats, err
+		}
+	}
+
+	logger.Info("statements applied", "statements", statements, "offset", offset, "rows", stats.RowsWritten, "duration", time.Since(runStart))
+	return stats, nil
+}
+
+// execStatement executes a statement read from a SQL file, streaming the rows
+// of COPY statements to the target.
+func execStatement(ctx context.Context, targetDB *pgxpool.Pool, stmt file.Statement) (pgconn.CommandTag, error) {
+	if stmt.Data == nil {
+		return targetDB.Exec(ctx, stmt.SQL)
+	}
+
+	conn, err := targetDB.Acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Release()
+
+	return conn.Conn().PgConn().CopyFrom(ctx, bytes.NewReader(stmt.Data), stmt.SQL)
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTable(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	table := model.Table{
+		Name: "person",
+		Columns: []model.Column{
+			{Name: "id"},
+			{Name: "full_name"},
+			{Name: "created_at"},
+		},
+		PrimaryKey: "id",
+		ReadLimit:  2,
+		Filter:     "WHERE created_at > '2023-01-01T01:01:01Z' ORDER BY created_at",
+	}
+
+	dump := model.Database{Driver: model.DriverSQL, Path: dir}
+
+	// Export upserts for the source rows, then replay them into the target.
+	exportStore := checkpoint.NewFileStore(filepath.Join(dir, "export.json"), "export")
+	assert.Nil(t, exportStore.Ensure(ctx, model.Database{Tables: []model.Table{table}}, false))
+
+	_, err := ExportTable(ctx, NewDBSource(source), dump, exportStore, table, table, true, nil, nil)
+	assert.Nil(t, err)
+
+	applyStore := checkpoint.NewFileStore(filepath.Join(dir, "apply.json"), "apply")
+	assert.Nil(t, applyStore.Ensure(ctx, model.Database{Tables: []model.Table{table}}, false))
+
+	stats, err := ApplyTable(ctx, dump, target, applyStore, table, table, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), stats.RowsRead)
+
+	act := fetchTargetPeople(t)
+	assert.Len(t, act, 4)
+
+	offset, err := applyStore.Offset(ctx, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, offset)
+
+	// Applying again resumes after the last statement.
+	stats, err = ApplyTable(ctx, dump, target, applyStore, table, table, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{}, stats)
+}
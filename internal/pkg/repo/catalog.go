@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// catalogStmt selects the columns of every user table, in order, along with
+// the table's name as the database displays it (qualified with its schema
+// only if it's not on the search path), its qualified name and whether the
+// column is the table's primary key. Composite primary keys aren't supported,
+// so they're left for the config to set. ds' own tables are skipped.
+const catalogStmt = `SELECT c.oid::regclass::text, n.nspname || '.' || c.relname, a.attname,
+	COALESCE(i.indnatts = 1 AND a.attnum = i.indkey[0], false)
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+	LEFT JOIN pg_index i ON i.indrelid = c.oid AND i.indisprimary
+	WHERE c.relkind IN ('r', 'p')
+	AND n.nspname NOT IN ('pg_catalog', 'information_schema', 'crdb_internal', 'pg_extension')
+	AND n.nspname NOT LIKE 'pg\_toast%'
+	AND c.relname NOT LIKE '\_shift\_%'
+	ORDER BY 1, a.attnum`
+
+// catalogColumn is a row of the catalog statement.
+type catalogColumn struct {
+	Table         string
+	QualifiedName string
+	Column        string
+	PrimaryKey    bool
+}
+
+// ExpandSourceTables expands the source's table patterns using the source
+// database's catalog. The catalog is only read if the source has include
+// patterns.
+func ExpandSourceTables(ctx context.Context, src Source, d model.Database) (model.Database, error) {
+	var catalog []model.CatalogTable
+	if len(d.Include) > 0 {
+		var err error
+		if catalog, err = src.catalog(ctx); err != nil {
+			return model.Database{}, fmt.Errorf("reading source catalog: %w", err)
+		}
+	}
+
+	return d.ExpandTables(catalog)
+}
+
+// ExpandTargetTables expands the target's table patterns using the target
+// database's catalog. The catalog is only read if the target has include
+// patterns.
+func ExpandTargetTables(ctx context.Context, targetDB *pgxpool.Pool, d model.Database) (model.Database, error) {
+	var catalog []model.CatalogTable
+	if len(d.Include) > 0 {
+		rows, err := targetDB.Query(ctx, catalogStmt)
+		if err != nil {
+			return model.Database{}, fmt.Errorf("reading target catalog: %w", err)
+		}
+
+		columns, err := pgx.CollectRows(rows, pgx.RowToStructByPos[catalogColumn])
+		if err != nil {
+			return model.Database{}, fmt.Errorf("reading target catalog: %w", err)
+		}
+		catalog = catalogTables(columns)
+	}
+
+	return d.ExpandTables(catalog)
+}
+
+// catalog returns the tables in the source database's catalog.
+func (s *DBSource) catalog(ctx context.Context) ([]model.CatalogTable, error) {
+	rows, err := s.db.QueryContext(ctx, catalogStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []catalogColumn
+	for rows.Next() {
+		var c catalogColumn
+		if err = rows.Scan(&c.Table, &c.QualifiedName, &c.Column, &c.PrimaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+
+	return catalogTables(columns), rows.Err()
+}
+
+// catalog returns an error, as files don't have a catalog to select tables
+// from.
+func (s *FileSource) catalog(ctx context.Context) ([]model.CatalogTable, error) {
+	return nil, fmt.Errorf("%s files don't support include patterns", s.d.Driver)
+}
+
+// catalogTables groups the columns selected by the catalog statement into
+// tables.
+func catalogTables(columns []catalogColumn) []model.CatalogTable {
+	var tables []model.CatalogTable
+	for _, c := range columns {
+		if len(tables) == 0 || tables[len(tables)-1].Name != c.Table {
+			tables = append(tables, model.CatalogTable{
+				Table:         model.Table{Name: c.Table},
+				QualifiedName: c.QualifiedName,
+			})
+		}
+
+		t := &tables[len(tables)-1]
+		t.Columns = append(t.Columns, model.Column{Name: c.Column})
+		if c.PrimaryKey {
+			t.PrimaryKey = c.Column
+		}
+	}
+	return tables
+}
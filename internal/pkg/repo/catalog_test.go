@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogTables(t *testing.T) {
+	columns := []catalogColumn{
+		{Table: "audit.event", QualifiedName: "audit.event", Column: "id"},
+		{Table: "person", QualifiedName: "public.person", Column: "id", PrimaryKey: true},
+		{Table: "person", QualifiedName: "public.person", Column: "name"},
+	}
+
+	assert.Equal(t, []model.CatalogTable{
+		{
+			Table:         model.Table{Name: "audit.event", Columns: []model.Column{{Name: "id"}}},
+			QualifiedName: "audit.event",
+		},
+		{
+			Table:         model.Table{Name: "person", PrimaryKey: "id", Columns: []model.Column{{Name: "id"}, {Name: "name"}}},
+			QualifiedName: "public.person",
+		},
+	}, catalogTables(columns))
+}
+
+func TestExpandSourceTables(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	d := model.Database{Include: []string{"public.*"}, Exclude: []string{"*_tmp"}}
+
+	act, err := ExpandSourceTables(context.Background(), NewDBSource(source), d)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Table{
+		{Name: "person", PrimaryKey: "id", Columns: []model.Column{{Name: "id"}, {Name: "full_name"}, {Name: "created_at"}}},
+	}, act.Tables)
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RowConflictError is returned when a table using the error conflict strategy
+// contains target rows that differ from the source.
+type RowConflictError struct {
+	Table string
+	Keys  []any
+}
+
+func (e *RowConflictError) Error() string {
+	return fmt.Sprintf("%d conflicting row(s) in %s with keys: %v", len(e.Keys), e.Table, e.Keys)
+}
+
+// upsertOrReport inserts rows that don't yet exist in the target and checks
+// whether any existing rows differ from the source. If they do, the whole
+// batch is rolled back and a RowConflictError containing their keys is returned.
+func upsertOrReport(ctx context.Context, targetDB *pgxpool.Pool, t model.Table, stmt string, values model.Values) error {
+	conflictStmt, err := t.ConflictStatement(values)
+	if err != nil {
+		return fmt.Errorf("generating conflict statement: %w", err)
+	}
+
+	tx, err := targetDB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	args := values.Flatten()
+	if _, err = tx.Exec(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("inserting rows: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, conflictStmt, args...)
+	if err != nil {
+		return fmt.Errorf("checking for conflicts: %w", err)
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[any])
+	if err != nil {
+		return fmt.Errorf("scanning conflicts: %w", err)
+	}
+
+	if len(keys) > 0 {
+		return &RowConflictError{Table: t.Name, Keys: keys}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
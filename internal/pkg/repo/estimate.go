@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+)
+
+// EstimateRows returns the number of rows that will be read from a source
+// table. Zero is returned if the number of rows is unknown.
+func EstimateRows(ctx context.Context, src Source, t model.Table) (int64, error) {
+	if err := t.RowEstimate.Validate(); err != nil {
+		return 0, err
+	}
+
+	return src.estimateRows(ctx, t)
+}
+
+// estimateRows estimates the number of rows in a table using the table's row
+// estimate.
+func (s *DBSource) estimateRows(ctx context.Context, t model.Table) (int64, error) {
+	var stmt string
+	var args []any
+
+	switch t.RowEstimate {
+	case model.EstimateNone:
+		return 0, nil
+	case model.EstimateStats:
+		stmt = `SELECT reltuples::INT8 FROM pg_class WHERE oid = $1::regclass`
+		args = append(args, t.Name)
+	default:
+		stmt = t.CountStatement()
+	}
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, stmt, args...).Scan(&count); err != nil {
+		if t.RowEstimate == model.EstimateStats {
+			return 0, fmt.Errorf("estimating rows from catalog statistics, which need Postgres' pg_class catalog (use row_estimate %s otherwise): %w", model.EstimateCount, err)
+		}
+		return 0, fmt.Errorf("estimating rows: %w", err)
+	}
+
+	// Tables that have never been analysed report a negative row count.
+	if count < 0 {
+		return 0, nil
+	}
+
+	return count, nil
+}
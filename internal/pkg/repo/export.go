@@ -0,0 +1,187 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/metrics"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/progress"
+	"ds/internal/pkg/throttle"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExportTable writes rows from the source database to files in the target's
+// directory, in the target's file format, and returns the number of rows
+// processed. SQL files upsert each batch of rows if upsert is set, and insert
+// them otherwise; other files only support inserts.
+//
+// Offsets are checkpointed as each file is completed, so an interrupted export
+// resumes from the start of the file it was writing. Files hold
+// DefaultRowsPerFile rows unless the target says otherwise, and tables written
+// to a single file are only checkpointed once the whole file is complete.
+func ExportTable(ctx context.Context, src Source, target model.Database, store checkpoint.Store, sourceTable, targetTable model.Table, upsert bool, tracker *progress.Tracker, pacer *throttle.Pacer) (stats Stats, err error) {
+	ctx, span := tracer.Start(ctx, "export table", trace.WithAttributes(
+		attribute.String("table", sourceTable.Name),
+		attribute.String("target", targetTable.Name),
+		attribute.String("format", target.Driver),
+	))
+	defer func() { endSpan(span, err) }()
+
+	if err = checkExport(target, targetTable, upsert); err != nil {
+		return stats, err
+	}
+
+	finish, err := trackStatus(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("setting status: %w", err)
+	}
+	defer func() {
+		if statusErr := finish(err); statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}()
+
+	// Fetch current offset.
+	offset, err := store.Offset(ctx, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("fetching current offset: %w", err)
+	}
+	position, err := fetchPosition(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("fetching current position: %w", err)
+	}
+	tracker.Set(int64(offset))
+
+	// The source's column types give Parquet files their schema.
+	types, _, err := src.describe(ctx, sourceTable)
+	if err != nil {
+		return stats, fmt.Errorf("checking source table %s: %w", sourceTable.Name, err)
+	}
+
+	w, err := file.NewWriter(target, targetTable, upsert, offset, types)
+	if err != nil {
+		return stats, fmt.Errorf("creating writer: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			w.Abort()
+		}
+	}()
+
+	logger := slog.With("table", sourceTable.Name, "target", targetTable.Name)
+	logger.Info("exporting rows", "offset", offset, "path", target.Path, "format", target.Driver)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runStart, rows, batches := time.Now(), 0, 0
+	checkpointed := offset
+
+	// The positions in the source's files that batches were read up to are
+	// kept until the file they end in is complete, so they can be
+	// checkpointed with it. Files that end part way through a batch are
+	// checkpointed without one.
+	positions := map[int]*file.Position{}
+
+	for b := range src.batches(ctx, sourceTable, targetTable, offset, position, pacer) {
+		start := time.Now()
+		_, writeSpan := tracer.Start(b.ctx, "write")
+
+		var count int
+		for b.Next() {
+			if err = w.Write(b.row); err != nil {
+				break
+			}
+			count++
+		}
+		if err == nil {
+			err = b.Err()
+		}
+		if err == nil {
+			err = w.EndBatch()
+		}
+
+		writeSpan.SetAttributes(attribute.Int("rows", count))
+		endSpan(writeSpan, err)
+		if err != nil {
+			b.end(count, err)
+			return stats, fmt.Errorf("writing rows: %w", err)
+		}
+		// Rows are written as they're read, so only the time spent writing,
+		// rather than waiting for rows, is observed.
+		write := time.Since(start) - b.waitTime
+		metrics.WriteDuration.WithLabelValues(sourceTable.Name).Observe(write.Seconds())
+		metrics.RowsWritten.WithLabelValues(sourceTable.Name).Add(float64(count))
+		pacer.Observe(count, b.bytes, b.readTime, write)
+		stats.RowsRead += int64(count)
+		stats.RowsWritten += int64(count)
+
+		if count == 0 {
+			b.end(0, nil)
+			break
+		}
+		offset += count
+		if b.position != nil {
+			positions[offset] = b.position
+		}
+
+		// Checkpoint any files that have been completed.
+		if w.Completed() != checkpointed {
+			checkpointed = w.Completed()
+			err = checkpointPosition(b.ctx, store, sourceTable.Name, checkpointed, positions[checkpointed])
+			for row := range positions {
+				if row < checkpointed {
+					delete(positions, row)
+				}
+			}
+		}
+		b.end(count, err)
+		if err != nil {
+			return stats, fmt.Errorf("setting current offset: %w", err)
+		}
+		tracker.Set(int64(offset))
+
+		batches++
+		rows += count
+		logger.Debug("batch written", "batch", batches, "offset", offset, "rows", count, "duration", time.Since(start))
+	}
+
+	// The source stops reading batches once the context is cancelled, which
+	// mustn't be mistaken for the end of the table.
+	if err = ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	if err = w.Close(); err != nil {
+		return stats, fmt.Errorf("closing file: %w", err)
+	}
+
+	if err = checkpointPosition(ctx, store, sourceTable.Name, w.Completed(), positions[w.Completed()]); err != nil {
+		return stats, fmt.Errorf("setting current offset: %w", err)
+	}
+
+	logger.Info("rows exported", "batches", batches, "offset", offset, "rows", rows, "duration", time.Since(runStart))
+	return stats, nil
+}
+
+// checkExport returns an error if a table's settings aren't supported by the
+// files of the given target.
+func checkExport(target model.Database, targetTable model.Table, upsert bool) error {
+	switch {
+	case upsert && target.Driver != model.DriverSQL:
+		return fmt.Errorf("%s targets only support insert", target.Driver)
+	case upsert && targetTable.PrimaryKey == "":
+		return fmt.Errorf("missing primary_key for upserts into %s", targetTable.Name)
+	case upsert && targetTable.OnConflict == model.ConflictError:
+		return fmt.Errorf("on_conflict %s isn't supported by %s targets", targetTable.OnConflict, target.Driver)
+	case !upsert && targetTable.LoadMode != "" && targetTable.LoadMode != model.LoadAppend:
+		return fmt.Errorf("load mode %s isn't supported by %s targets", targetTable.LoadMode, target.Driver)
+	}
+	return nil
+}
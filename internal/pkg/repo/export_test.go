@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/throttle"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportTable(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	table := model.Table{
+		Name: "person",
+		Columns: []model.Column{
+			{Name: "id"},
+			{Name: "full_name"},
+		},
+		ReadLimit: 2,
+		Filter:    "WHERE created_at > '2023-01-01T01:01:01Z' ORDER BY created_at",
+	}
+
+	target := model.Database{Driver: model.DriverCSV, Path: dir, RowsPerFile: 3}
+
+	fileStore := checkpoint.NewFileStore(filepath.Join(dir, "state.json"), "export")
+	assert.Nil(t, fileStore.Ensure(ctx, model.Database{Tables: []model.Table{table}}, false))
+
+	stats, err := ExportTable(ctx, NewDBSource(source), target, fileStore, table, table, false, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{RowsRead: 4, RowsWritten: 4}, stats)
+
+	assert.Equal(t, [][]string{
+		{"id", "full_name"},
+		{"bc229cee-5387-4c36-b83e-7a46613071de", "b b"},
+		{"ccb45142-cba0-4f97-9179-33c7e3d51e92", "c c"},
+		{"dfbad599-b5b6-4c59-8859-b19db1dd2ac0", "d d"},
+	}, readCSV(t, filepath.Join(dir, "person-0000000000.csv")))
+
+	assert.Equal(t, [][]string{
+		{"id", "full_name"},
+		{"eba7ea84-e57b-4816-8806-2faae31c2830", "e e"},
+	}, readCSV(t, filepath.Join(dir, "person-0000000003.csv")))
+
+	offset, err := fileStore.Offset(ctx, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, offset)
+}
+
+func TestExportTableCancelled(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "person.csv"), []byte("id,name\n1,a\n2,b\n3,c\n"), 0644))
+
+	table := model.Table{
+		Name:      "person",
+		File:      "person.csv",
+		Columns:   []model.Column{{Name: "id"}, {Name: "name"}},
+		ReadLimit: 1,
+	}
+
+	source := model.Database{Driver: model.DriverCSV, Path: dir, Tables: []model.Table{table}}
+	target := model.Database{Driver: model.DriverJSONL, Path: filepath.Join(dir, "out")}
+
+	fileStore := checkpoint.NewFileStore(filepath.Join(dir, "state.json"), "export")
+	assert.Nil(t, fileStore.Ensure(context.Background(), source, false))
+
+	// Cancel the table once its first batch has been read, while it's waiting
+	// to read the next.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pacer := throttle.New(model.Throttle{}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person", ReadDelay: time.Hour}, nil)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	stats, err := ExportTable(ctx, NewFileSource(source, nil), target, fileStore, table, table, false, nil, pacer)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, Stats{RowsRead: 1, RowsWritten: 1}, stats)
+}
+
+func TestExportTableResumesFromPosition(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// The first row can't be decoded, so the export only succeeds if it's
+	// never read again.
+	header, first := "id,name\n", "\\xzz,a\n"
+	path := filepath.Join(dir, "person.csv")
+	assert.Nil(t, os.WriteFile(path, []byte(header+first+"2,b\n3,c\n"), 0644))
+
+	table := model.Table{
+		Name:      "person",
+		File:      "person.csv",
+		Columns:   []model.Column{{Name: "id"}, {Name: "name"}},
+		ReadLimit: 1,
+	}
+
+	source := model.Database{Driver: model.DriverCSV, Path: dir, Tables: []model.Table{table}}
+	target := model.Database{Driver: model.DriverCSV, Path: filepath.Join(dir, "out"), RowsPerFile: 1}
+
+	fileStore := checkpoint.NewFileStore(filepath.Join(dir, "state.json"), "export")
+	assert.Nil(t, fileStore.Ensure(ctx, source, false))
+
+	position := file.Position{File: path, Offset: int64(len(header + first)), Row: 1}
+	assert.Nil(t, checkpointPosition(ctx, fileStore, "person", 1, &position))
+
+	stats, err := ExportTable(ctx, NewFileSource(source, nil), target, fileStore, table, table, false, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{RowsRead: 2, RowsWritten: 2}, stats)
+
+	assert.Equal(t, [][]string{{"id", "name"}, {"2", "b"}}, readCSV(t, filepath.Join(dir, "out", "person-0000000001.csv")))
+	assert.Equal(t, [][]string{{"id", "name"}, {"3", "c"}}, readCSV(t, filepath.Join(dir, "out", "person-0000000002.csv")))
+
+	// The position at the end of the file is checkpointed with the offset.
+	offset, err := fileStore.Offset(ctx, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, offset)
+
+	position, err = fetchPosition(ctx, fileStore, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, file.Position{File: path, Offset: int64(len(header + first + "2,b\n3,c\n")), Row: 3}, position)
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+	return records
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"ds/internal/pkg/checkpoint"
 	"ds/internal/pkg/model"
 	"log"
 	"os"
@@ -17,6 +18,7 @@ var (
 	integrationTests bool
 	source           *sql.DB
 	target           *pgxpool.Pool
+	store            checkpoint.Store
 )
 
 func TestMain(m *testing.M) {
@@ -77,7 +79,8 @@ func setupDatabase() {
 		},
 	}
 
-	if err = EnsureStateTable(target, targetDatabase, true); err != nil {
+	store = checkpoint.NewDBStore(target, model.Config{})
+	if err = store.Ensure(context.Background(), targetDatabase, true); err != nil {
 		log.Fatalf("error ensuring database: %v", err)
 	}
 }
@@ -33,3 +33,7 @@ func (m *mockRows) Next() bool {
 func (m *mockRows) Columns() ([]string, error) {
 	return m.columns, nil
 }
+
+func (m *mockRows) Err() error {
+	return nil
+}
@@ -0,0 +1,292 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/metrics"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/throttle"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultBufferSize is the number of rows buffered ahead of the writer for
+// tables without a read_limit.
+const defaultBufferSize = 1000
+
+// batch streams the rows of a single read from the source. It implements
+// pgx.CopyFromSource, so it can be passed straight to CopyFrom.
+type batch struct {
+	offset int
+	rows   chan []any
+	limit  int
+	row    []any
+	err    error
+
+	// bytes is the approximate size of the rows consumed from the batch.
+	bytes int
+
+	// readTime is how long the batch took to read, which is set before its
+	// rows channel is closed.
+	readTime time.Duration
+
+	// waitTime is how long the writer spent waiting for rows to be read,
+	// when they're streamed to it.
+	waitTime time.Duration
+
+	// position is the position in the source's files that the batch was read
+	// up to, which is set before its rows channel is closed. It's nil for
+	// batches read from a database.
+	position *file.Position
+
+	// ctx carries the batch's span, which is started by the reader and ended
+	// by the writer once the batch has been written.
+	ctx   context.Context
+	span  trace.Span
+	table string
+}
+
+// newBatch returns a batch of at most limit rows of a table, starting from the
+// given offset, or of every remaining row if limit isn't positive.
+func newBatch(ctx context.Context, t model.Table, offset, limit int) *batch {
+	size := limit
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	ctx, span := tracer.Start(ctx, "batch", trace.WithAttributes(
+		attribute.String("table", t.Name),
+		attribute.Int("offset", offset),
+		attribute.Int("limit", limit),
+	))
+
+	return &batch{
+		offset: offset,
+		limit:  limit,
+		rows:   make(chan []any, size),
+		ctx:    ctx,
+		span:   span,
+		table:  t.Name,
+	}
+}
+
+// end records the number of rows written in the batch and ends its span.
+func (b *batch) end(rows int, err error) {
+	b.span.SetAttributes(attribute.Int("rows", rows), attribute.Int("bytes", b.bytes))
+	endSpan(b.span, err)
+
+	if rows > 0 {
+		metrics.BatchBytes.WithLabelValues(b.table).Observe(float64(b.bytes))
+	}
+}
+
+// Next moves to the next row, blocking until it has been read from the source.
+func (b *batch) Next() bool {
+	var (
+		row []any
+		ok  bool
+	)
+	select {
+	case row, ok = <-b.rows:
+	default:
+		start := time.Now()
+		row, ok = <-b.rows
+		b.waitTime += time.Since(start)
+	}
+	b.row = row
+	b.bytes += rowSize(row)
+	return ok
+}
+
+// Values returns the current row.
+func (b *batch) Values() ([]any, error) {
+	return b.row, nil
+}
+
+// Err returns any error encountered whilst reading the batch. It's only safe
+// to call once Next has returned false.
+func (b *batch) Err() error {
+	return b.err
+}
+
+// collect drains the batch into a Values collection, for writes that require
+// every row up-front.
+func (b *batch) collect() (model.Values, error) {
+	var values model.Values
+	for b.Next() {
+		values = append(values, b.row)
+	}
+
+	return values, b.Err()
+}
+
+// read queries the source for the batch's rows and streams them to the batch,
+// returning the number of rows read.
+func (b *batch) read(ctx context.Context, sourceDB *sql.DB, t model.Table) int {
+	defer close(b.rows)
+
+	start := time.Now()
+	defer func() {
+		b.readTime = time.Since(start)
+		metrics.ReadDuration.WithLabelValues(t.Name).Observe(b.readTime.Seconds())
+	}()
+
+	t.ReadLimit = b.limit
+	stmt := t.SelectStatement(b.offset)
+
+	_, readSpan := tracer.Start(b.ctx, "read", trace.WithAttributes(attribute.String("db.statement", stmt)))
+	rows, err := sourceDB.QueryContext(ctx, stmt)
+	endSpan(readSpan, err)
+	if err != nil {
+		b.err = fmt.Errorf("querying rows: %w", err)
+		return 0
+	}
+	defer rows.Close()
+
+	_, scanSpan := tracer.Start(b.ctx, "scan")
+	count, err := scan(ctx, rows, t, b.rows)
+	scanSpan.SetAttributes(attribute.Int("rows", count))
+	endSpan(scanSpan, err)
+
+	metrics.RowsRead.WithLabelValues(t.Name).Add(float64(count))
+	if err != nil {
+		b.err = fmt.Errorf("scanning rows: %w", err)
+	}
+
+	return count
+}
+
+// readFile reads the batch's rows from a table's files and streams them to the
+// batch, returning the number of rows read.
+func (b *batch) readFile(ctx context.Context, r *file.Reader, t model.Table) int {
+	defer close(b.rows)
+
+	start := time.Now()
+	defer func() {
+		b.readTime = time.Since(start)
+		metrics.ReadDuration.WithLabelValues(t.Name).Observe(b.readTime.Seconds())
+	}()
+
+	_, readSpan := tracer.Start(b.ctx, "read")
+
+	var count int
+	for b.limit <= 0 || count < b.limit {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			b.err = fmt.Errorf("reading rows: %w", err)
+			break
+		}
+
+		select {
+		case b.rows <- row:
+			count++
+			continue
+		case <-ctx.Done():
+			b.err = ctx.Err()
+		}
+		break
+	}
+
+	readSpan.SetAttributes(attribute.Int("rows", count))
+	endSpan(readSpan, b.err)
+
+	pos := r.Position()
+	b.position = &pos
+
+	metrics.RowsRead.WithLabelValues(t.Name).Add(float64(count))
+	return count
+}
+
+// readBatches reads successive batches of a source table from the given offset
+// in a separate goroutine, using the given function to read each batch. The
+// next batch is read while the previous one is being written, and at most one
+// batch is buffered ahead of the writer, so memory use is bounded by the
+// table's read_limit. The pacer decides how many rows to read in each batch
+// and how long to wait between them.
+//
+// Reading stops after a short or failed batch, or when the context is
+// cancelled, at which point done is called, if given, and the returned
+// channel is closed.
+func readBatches(ctx context.Context, t model.Table, offset int, pacer *throttle.Pacer, read func(context.Context, *batch) int, done func()) <-chan *batch {
+	batches := make(chan *batch, 1)
+
+	go func() {
+		defer close(batches)
+		if done != nil {
+			defer done()
+		}
+
+		for {
+			// Batches are only read while one of the table's maintenance
+			// windows is open. Errors waiting for one are passed to the
+			// writer in an empty batch, so it doesn't mistake them for the
+			// end of the table.
+			openErr := pacer.Open(ctx)
+
+			limit := pacer.Limit(t.ReadLimit)
+			if limit > 0 && openErr == nil {
+				metrics.BatchSize.WithLabelValues(t.Name).Set(float64(limit))
+			}
+
+			b := newBatch(ctx, t, offset, limit)
+			select {
+			case batches <- b:
+			case <-ctx.Done():
+				b.end(0, ctx.Err())
+				return
+			}
+
+			if openErr != nil {
+				b.err = openErr
+				close(b.rows)
+				return
+			}
+
+			count := read(ctx, b)
+			if b.err != nil || count == 0 || count < limit || limit <= 0 {
+				return
+			}
+			offset += count
+
+			if err := pacer.Wait(ctx, count); err != nil {
+				return
+			}
+		}
+	}()
+
+	return batches
+}
+
+// rowSize returns the approximate size of a row's values in bytes: the length
+// of strings and byte slices, 8 bytes for numbers and times, and the length of
+// the text form of anything else.
+func rowSize(row []any) int {
+	var size int
+	for _, v := range row {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		case bool:
+			size++
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			size += 8
+		case time.Time:
+			size += 8
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
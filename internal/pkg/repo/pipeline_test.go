@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/schedule"
+	"ds/internal/pkg/throttle"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowSize(t *testing.T) {
+	cases := []struct {
+		name string
+		row  []any
+		exp  int
+	}{
+		{name: "empty", row: nil, exp: 0},
+		{name: "nulls", row: []any{nil, nil}, exp: 0},
+		{name: "strings and bytes", row: []any{"abc", []byte("de")}, exp: 5},
+		{name: "fixed width", row: []any{1, int64(2), 3.5, true, time.Now()}, exp: 33},
+		{name: "other", row: []any{[]string{"a", "b"}}, exp: 5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, rowSize(c.row))
+		})
+	}
+}
+
+func TestReadBatchesOutsideWindows(t *testing.T) {
+	never, err := schedule.NewWindow("0 0 30 2 *", time.Hour, "")
+	assert.Nil(t, err)
+
+	table := model.Table{Name: "person", ReadLimit: 10}
+	pacer := throttle.New(model.Throttle{}, model.BatchSize{}, nil).Pacer(table, []schedule.Window{never})
+
+	var reads int
+	batches := readBatches(context.Background(), table, 0, pacer, func(context.Context, *batch) int {
+		reads++
+		return 0
+	}, nil)
+
+	b := <-batches
+	values, err := b.collect()
+	assert.Empty(t, values)
+	assert.EqualError(t, err, "no maintenance window opens in the next five years")
+
+	_, ok := <-batches
+	assert.False(t, ok)
+	assert.Equal(t, 0, reads)
+}
+
+func TestBatchWaitTime(t *testing.T) {
+	b := newBatch(context.Background(), model.Table{Name: "person"}, 0, 2)
+
+	b.rows <- []any{1}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.rows <- []any{2}
+		close(b.rows)
+	}()
+
+	values, err := b.collect()
+	assert.Nil(t, err)
+	assert.Len(t, values, 2)
+	assert.GreaterOrEqual(t, b.waitTime, 50*time.Millisecond)
+}
@@ -0,0 +1,255 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/model"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/lo"
+)
+
+// Plan describes how a table will be shifted, without shifting it.
+type Plan struct {
+	// Reads are the statement that reads the first batch of rows from the
+	// source database, or the source files that rows are read from.
+	Reads []string
+
+	// Statements are the statements run against the target database, in
+	// order, or the statements written to SQL files.
+	Statements []string
+
+	// Files are the files written to, for file targets, starting with the
+	// first.
+	Files []string
+
+	// Rows is the estimated number of rows to read, or zero if it's unknown.
+	Rows int64
+
+	// Batches is the estimated number of batches the rows are read in, or
+	// zero if it's unknown.
+	Batches int64
+}
+
+// PlanTable checks that a table can be shifted, connecting to the source and,
+// unless it's given a file target, the target database, and describes how it
+// will be shifted by an insert or, if upsert is set, an update. Nothing is
+// written to either database.
+//
+// Every configured column must exist in both tables, and each source column's
+// type must be compatible with its target column's type. Values read from
+// files are parsed using the target column's type, so they're not compared.
+func PlanTable(ctx context.Context, src Source, target model.Database, targetDB *pgxpool.Pool, sourceTable, targetTable model.Table, upsert bool) (plan Plan, err error) {
+	sourceTypes, reads, err := src.describe(ctx, sourceTable)
+	if err != nil {
+		return plan, fmt.Errorf("checking source table %s: %w", sourceTable.Name, err)
+	}
+	plan.Reads = reads
+
+	if target.IsFile() {
+		if err = checkExport(target, targetTable, upsert); err != nil {
+			return plan, err
+		}
+		plan.Files = []string{file.Name(target, targetTable, 0)}
+	} else {
+		targetTypes, err := columnTypes(ctx, targetDB, targetTable)
+		if err != nil {
+			return plan, fmt.Errorf("checking target table %s: %w", targetTable.Name, err)
+		}
+
+		if err = checkTypes(sourceTable, targetTable, sourceTypes, targetTypes); err != nil {
+			return plan, err
+		}
+
+		if targetTable.LoadMode == model.LoadSwap && !upsert {
+			if err = checkSwap(ctx, targetDB, targetTable); err != nil {
+				return plan, err
+			}
+		}
+	}
+
+	if plan.Statements, err = writeStatements(target, targetTable, upsert); err != nil {
+		return plan, err
+	}
+
+	if plan.Rows, err = EstimateRows(ctx, src, sourceTable); err != nil {
+		return plan, fmt.Errorf("estimating rows for %s: %w", sourceTable.Name, err)
+	}
+	plan.Batches = batches(plan.Rows, sourceTable.ReadLimit)
+
+	return plan, nil
+}
+
+// PlanApply checks that a table's SQL files can be replayed into the target
+// database, and describes how they will be. Each statement in the files is
+// read to count its rows, but nothing is executed.
+func PlanApply(ctx context.Context, dump model.Database, targetDB *pgxpool.Pool, sourceTable, targetTable model.Table) (plan Plan, err error) {
+	if _, err = columnTypes(ctx, targetDB, targetTable); err != nil {
+		return plan, fmt.Errorf("checking target table %s: %w", targetTable.Name, err)
+	}
+
+	if plan.Reads, err = file.Files(dump, sourceTable); err != nil {
+		return plan, err
+	}
+
+	r, err := file.NewReader(dump, sourceTable, nil)
+	if err != nil {
+		return plan, err
+	}
+	defer r.Close()
+
+	for {
+		stmt, err := r.ReadStatement()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return plan, fmt.Errorf("reading statement: %w", err)
+		}
+
+		plan.Rows += int64(stmt.Rows)
+		plan.Batches++
+	}
+
+	return plan, nil
+}
+
+// writeStatements returns the statements that write a table's rows to the
+// target, mirroring InsertTable, UpdateTable and ExportTable. Batches of rows
+// are shown as a single row of placeholders.
+func writeStatements(target model.Database, targetTable model.Table, upsert bool) ([]string, error) {
+	if target.IsFile() && target.Driver != model.DriverSQL {
+		return nil, nil
+	}
+
+	if upsert {
+		placeholders := lo.Times(len(targetTable.Columns), func(i int) string {
+			return fmt.Sprintf("$%d", i+1)
+		})
+
+		stmt, err := targetTable.UpsertValuesStatement("(" + strings.Join(placeholders, ", ") + ")")
+		if err != nil {
+			return nil, fmt.Errorf("generating upsert statement: %w", err)
+		}
+		return []string{stmt}, nil
+	}
+
+	if target.IsFile() {
+		if target.SQLFormat == model.SQLFormatCopy {
+			return []string{copyStatement(targetTable.Name, targetTable)}, nil
+		}
+		return []string{fmt.Sprintf("INSERT INTO %s (%s) VALUES ...", targetTable.Name, strings.Join(targetTable.ColumnNames(), ", "))}, nil
+	}
+
+	switch targetTable.LoadMode {
+	case model.LoadTruncate:
+		return []string{
+			fmt.Sprintf("TRUNCATE %s", targetTable.Name),
+			copyStatement(targetTable.Name, targetTable),
+		}, nil
+	case model.LoadSwap:
+		create, swap, drop := shadowStatements(targetTable)
+		stmts := append(create, copyStatement(targetTable.PrefixedName("_shift_new_"), targetTable))
+		return append(append(stmts, swap...), drop), nil
+	default:
+		return []string{copyStatement(targetTable.Name, targetTable)}, nil
+	}
+}
+
+// batches returns the number of batches needed to read the given number of
+// rows, reading at most limit rows at a time.
+func batches(rows int64, limit int) int64 {
+	if rows <= 0 {
+		return 0
+	}
+	if limit <= 0 {
+		return 1
+	}
+	return (rows + int64(limit) - 1) / int64(limit)
+}
+
+// checkTypes returns an error for each source column whose type isn't
+// compatible with its target column's type. Columns are matched by position.
+func checkTypes(sourceTable, targetTable model.Table, sourceTypes, targetTypes []string) error {
+	if sourceTypes == nil {
+		return nil
+	}
+
+	var errs []error
+	for i := 0; i < min(len(sourceTypes), len(targetTypes)); i++ {
+		if !compatibleTypes(sourceTypes[i], targetTypes[i]) {
+			errs = append(errs, fmt.Errorf("%s.%s (%s) isn't compatible with %s.%s (%s)",
+				sourceTable.Name, sourceTable.Columns[i].Name, sourceTypes[i],
+				targetTable.Name, targetTable.Columns[i].Name, targetTypes[i]))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// typeFamilies groups database types whose values can be copied between
+// each other without conversion.
+var typeFamilies = map[string]string{
+	"smallint": "integer", "integer": "integer", "bigint": "integer",
+	"int": "integer", "int2": "integer", "int4": "integer", "int8": "integer",
+
+	"numeric": "numeric", "decimal": "numeric",
+
+	"real": "float", "double precision": "float", "float4": "float", "float8": "float",
+
+	"text": "text", "character varying": "text", "varchar": "text", "character": "text",
+	"char": "text", "bpchar": "text", "name": "text", "citext": "text", "string": "text",
+
+	"timestamp without time zone": "timestamp", "timestamp with time zone": "timestamp",
+	"timestamp": "timestamp", "timestamptz": "timestamp",
+
+	"json": "json", "jsonb": "json",
+
+	"boolean": "boolean", "bool": "boolean",
+}
+
+// typeWidenings lists the families that each family's values can also be
+// written to.
+var typeWidenings = map[string][]string{
+	"integer": {"numeric", "float"},
+	"numeric": {"float"},
+	"float":   {"numeric"},
+	"uuid":    {"text"},
+}
+
+// typeModifier matches the modifiers of a type, such as its length.
+var typeModifier = regexp.MustCompile(`\([^)]*\)`)
+
+// compatibleTypes returns true if values of the source type can be written to
+// columns of the target type. Types are compared without their modifiers, so
+// lengths and precisions aren't checked.
+func compatibleTypes(source, target string) bool {
+	family := func(t string) string {
+		t = strings.ToLower(strings.TrimSpace(typeModifier.ReplaceAllString(t, "")))
+		t = strings.Join(strings.Fields(t), " ")
+
+		// Arrays are only compatible with arrays of a compatible type.
+		if elem, ok := strings.CutSuffix(t, "[]"); ok {
+			if f, ok := typeFamilies[elem]; ok {
+				return f + "[]"
+			}
+			return t
+		}
+
+		if f, ok := typeFamilies[t]; ok {
+			return f
+		}
+		return t
+	}
+
+	sf, tf := family(source), family(target)
+	if sf == tf {
+		return true
+	}
+	return lo.Contains(typeWidenings[sf], tf)
+}
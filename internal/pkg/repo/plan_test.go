@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"ds/internal/pkg/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatibleTypes(t *testing.T) {
+	cases := []struct {
+		source string
+		target string
+		exp    bool
+	}{
+		{source: "uuid", target: "uuid", exp: true},
+		{source: "character varying(255)", target: "text", exp: true},
+		{source: "integer", target: "bigint", exp: true},
+		{source: "integer", target: "numeric(10,2)", exp: true},
+		{source: "numeric(10,2)", target: "integer", exp: false},
+		{source: "timestamp(3) without time zone", target: "timestamp with time zone", exp: true},
+		{source: "uuid", target: "STRING", exp: true},
+		{source: "text", target: "uuid", exp: false},
+		{source: "integer[]", target: "bigint[]", exp: true},
+		{source: "integer[]", target: "bigint", exp: false},
+		{source: "jsonb", target: "json", exp: true},
+		{source: "date", target: "timestamp without time zone", exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.source+" to "+c.target, func(t *testing.T) {
+			assert.Equal(t, c.exp, compatibleTypes(c.source, c.target))
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	assert.Equal(t, int64(0), batches(0, 10))
+	assert.Equal(t, int64(1), batches(5, 0))
+	assert.Equal(t, int64(1), batches(10, 10))
+	assert.Equal(t, int64(2), batches(11, 10))
+}
+
+func TestWriteStatements(t *testing.T) {
+	table := model.Table{
+		Name:       "person",
+		PrimaryKey: "id",
+		Columns:    []model.Column{{Name: "id"}, {Name: "name"}},
+	}
+
+	cases := []struct {
+		name     string
+		target   model.Database
+		loadMode model.LoadMode
+		upsert   bool
+		exp      []string
+	}{
+		{
+			name: "append",
+			exp:  []string{"COPY person (id, name) FROM STDIN"},
+		},
+		{
+			name:     "truncate",
+			loadMode: model.LoadTruncate,
+			exp:      []string{"TRUNCATE person", "COPY person (id, name) FROM STDIN"},
+		},
+		{
+			name:     "swap",
+			loadMode: model.LoadSwap,
+			exp: []string{
+				"DROP TABLE IF EXISTS _shift_new_person",
+				"CREATE TABLE _shift_new_person (LIKE person INCLUDING ALL)",
+				"COPY _shift_new_person (id, name) FROM STDIN",
+				"ALTER TABLE person RENAME TO _shift_old_person",
+				"ALTER TABLE _shift_new_person RENAME TO person",
+				"DROP TABLE _shift_old_person",
+			},
+		},
+		{
+			name:   "upsert",
+			upsert: true,
+			exp: []string{`INSERT INTO person AS _shift_t (id, name) VALUES ($1, $2)
+		 ON CONFLICT (id) DO UPDATE
+		 SET name = EXCLUDED.name
+		 WHERE _shift_t IS DISTINCT FROM EXCLUDED`},
+		},
+		{
+			name:   "csv target",
+			target: model.Database{Driver: model.DriverCSV},
+		},
+		{
+			name:   "sql target",
+			target: model.Database{Driver: model.DriverSQL},
+			exp:    []string{"INSERT INTO person (id, name) VALUES ..."},
+		},
+		{
+			name:   "sql copy target",
+			target: model.Database{Driver: model.DriverSQL, SQLFormat: model.SQLFormatCopy},
+			exp:    []string{"COPY person (id, name) FROM STDIN"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			table := table
+			table.LoadMode = c.loadMode
+
+			act, err := writeStatements(c.target, table, c.upsert)
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, act)
+		})
+	}
+}
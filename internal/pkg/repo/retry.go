@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/metrics"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// maxRetries is the number of times a write that fails with a transient
+	// error is retried before its table fails.
+	maxRetries = 3
+
+	// retryDelay is how long the first retry waits, doubling for each retry
+	// after it.
+	retryDelay = 100 * time.Millisecond
+)
+
+// withRetries calls fn, retrying it if it fails with a transient error, such
+// as a serialization failure, which CockroachDB asks clients to retry. Only
+// writes that can safely be repeated are retried: rows streamed into COPY are
+// consumed as they're written, so they can't be read again.
+func withRetries(ctx context.Context, table string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > maxRetries || !retryable(err) {
+			return err
+		}
+
+		metrics.Retries.WithLabelValues(table).Inc()
+		slog.Warn("retrying write", "table", table, "attempt", attempt, "error", err)
+
+		select {
+		case <-time.After(retryDelay << (attempt - 1)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// retryable returns true if an error is transient, so the write that caused
+// it can be retried: serialization failures and deadlocks, which roll back
+// the statement, and connection errors that happened before it was sent.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRetries(t *testing.T) {
+	serialization := fmt.Errorf("upserting rows: %w", &pgconn.PgError{Code: "40001"})
+	violation := &pgconn.PgError{Code: "23505"}
+
+	cases := []struct {
+		name     string
+		errs     []error
+		expCalls int
+		expErr   error
+	}{
+		{name: "success", errs: []error{nil}, expCalls: 1},
+		{name: "transient error retried", errs: []error{serialization, serialization, nil}, expCalls: 3},
+		{name: "retries exhausted", errs: []error{serialization, serialization, serialization, serialization, nil}, expCalls: 4, expErr: serialization},
+		{name: "other error not retried", errs: []error{violation, nil}, expCalls: 1, expErr: violation},
+		{name: "plain error not retried", errs: []error{errors.New("boom"), nil}, expCalls: 1, expErr: errors.New("boom")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls int
+			err := withRetries(context.Background(), "person", func() error {
+				calls++
+				return c.errs[calls-1]
+			})
+			assert.Equal(t, c.expErr, err)
+			assert.Equal(t, c.expCalls, calls)
+		})
+	}
+}
+
+func TestWithRetriesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int
+	err := withRetries(ctx, "person", func() error {
+		calls++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+	assert.Equal(t, &pgconn.PgError{Code: "40P01"}, err)
+	assert.Equal(t, 1, calls)
+}
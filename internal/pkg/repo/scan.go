@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"ds/internal/pkg/model"
 	"fmt"
 )
@@ -9,49 +10,74 @@ type rowScanner interface {
 	Columns() ([]string, error)
 	Next() bool
 	Scan(...any) error
+	Err() error
 }
 
-// scan a row collection for a given table into a multi-dimensional array.
-func scan(rs rowScanner, t model.Table) (model.Values, error) {
+// scan streams a row collection for a given table to a channel, one row at a
+// time, returning the number of rows sent. Rows are scanned directly into a
+// slice in the order of the table's columns, without intermediate copies.
+func scan(ctx context.Context, rs rowScanner, t model.Table, out chan<- []any) (int, error) {
 	fields, err := rs.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("listing columns: %w", err)
+		return 0, fmt.Errorf("listing columns: %w", err)
 	}
 
-	var rows []map[string]any
+	// Map each selected field to its position in the table's columns, in case
+	// the source returns them in a different order.
+	positions := make([]int, len(fields))
+	for i, field := range fields {
+		positions[i] = -1
+		for j, col := range t.Columns {
+			if col.Name == field {
+				positions[i] = j
+				break
+			}
+		}
+	}
+
+	ordered := inOrder(positions)
+
+	var count int
 	for rs.Next() {
 		scans := make([]any, len(fields))
-		row := make(map[string]any)
-
 		for i := range scans {
 			scans[i] = &scans[i]
 		}
 
 		if err = rs.Scan(scans...); err != nil {
-			return nil, fmt.Errorf("scaning values: %w", err)
+			return count, fmt.Errorf("scaning values: %w", err)
 		}
 
-		for i, v := range scans {
-			if v != nil {
-				row[fields[i]] = v
+		row := scans
+		if !ordered {
+			row = make([]any, len(t.Columns))
+			for i, v := range scans {
+				if positions[i] >= 0 {
+					row[positions[i]] = v
+				}
 			}
 		}
-		rows = append(rows, row)
+
+		select {
+		case out <- row:
+			count++
+		case <-ctx.Done():
+			return count, ctx.Err()
+		}
 	}
 
-	return mapToNArray(rows, t), nil
-}
+	if err = rs.Err(); err != nil {
+		return count, fmt.Errorf("iterating rows: %w", err)
+	}
 
-func mapToNArray(m []map[string]any, t model.Table) model.Values {
-	values := model.Values{}
+	return count, nil
+}
 
-	for _, row := range m {
-		columns := make([]any, len(t.Columns))
-		for i, col := range t.Columns {
-			columns[i] = row[col.Name]
+func inOrder(positions []int) bool {
+	for i, p := range positions {
+		if p != i {
+			return false
 		}
-		values = append(values, columns)
 	}
-
-	return values
+	return true
 }
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"ds/internal/pkg/model"
 	"testing"
 
@@ -33,7 +34,41 @@ func TestScan(t *testing.T) {
 		[]any{3, "C", "2023-01-03", true},
 	}
 
-	act, err := scan(mockRows, table)
+	out := make(chan []any, len(rows))
+	count, err := scan(context.Background(), mockRows, table, out)
 	assert.Nil(t, err)
+	assert.Equal(t, len(exp), count)
+	close(out)
+
+	act := model.Values{}
+	for row := range out {
+		act = append(act, row)
+	}
 	assert.Equal(t, exp, act)
 }
+
+func TestScanColumnOrder(t *testing.T) {
+	columns := []string{"b", "a"}
+
+	rows := [][]any{
+		{"A", 1},
+		{"B", 2},
+	}
+
+	mockRows := newMockRows(rows, columns)
+
+	table := model.Table{
+		Columns: []model.Column{
+			{Name: "a"},
+			{Name: "b"},
+		},
+	}
+
+	out := make(chan []any, len(rows))
+	_, err := scan(context.Background(), mockRows, table, out)
+	assert.Nil(t, err)
+	close(out)
+
+	assert.Equal(t, []any{1, "A"}, <-out)
+	assert.Equal(t, []any{2, "B"}, <-out)
+}
@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/lo"
+)
+
+// sequencesStmt selects the columns of a table that take their values from a
+// sequence, along with the sequence: serial and identity columns, columns
+// that own a sequence and columns that default to the next value of one.
+const sequencesStmt = `SELECT column_name, sequence_name FROM (
+	SELECT a.attnum, a.attname AS column_name, COALESCE(
+		pg_get_serial_sequence($1, a.attname),
+		substring(pg_get_expr(d.adbin, d.adrelid) FROM 'nextval\(''([^'']+)''')
+	) AS sequence_name
+	FROM pg_attribute a
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+) s
+WHERE sequence_name IS NOT NULL
+ORDER BY attnum`
+
+// columnSequence is a row of the sequences statement.
+type columnSequence struct {
+	Column   string
+	Sequence string
+}
+
+// SyncSequences advances the sequences behind a target table's columns, such
+// as serial and identity columns, past the values that have been loaded into
+// them, so the application's next inserts don't collide with them. Only the
+// columns that are loaded are synchronised, and sequences are never moved
+// backwards.
+func SyncSequences(ctx context.Context, src Source, targetDB *pgxpool.Pool, sourceTable, targetTable model.Table) error {
+	if err := targetTable.SequenceSync.Validate(); err != nil {
+		return err
+	}
+	if targetTable.SequenceSync == model.SequenceSyncNone {
+		return nil
+	}
+
+	rows, err := targetDB.Query(ctx, sequencesStmt, targetTable.Name)
+	if err != nil {
+		return fmt.Errorf("finding sequences: %w", err)
+	}
+
+	sequences, err := pgx.CollectRows(rows, pgx.RowToStructByPos[columnSequence])
+	if err != nil {
+		return fmt.Errorf("finding sequences: %w", err)
+	}
+
+	logger := slog.With("table", sourceTable.Name, "target", targetTable.Name)
+
+	for _, s := range sequences {
+		// Columns that aren't loaded still take their values from their
+		// sequence, so they're left alone. Loaded columns are matched with
+		// the source table's by position.
+		_, i, found := lo.FindIndexOf(targetTable.Columns, func(c model.Column) bool {
+			return strings.EqualFold(c.Name, s.Column)
+		})
+		if !found {
+			continue
+		}
+
+		var loaded *int64
+		stmt := fmt.Sprintf("SELECT MAX(%s)::INT8 FROM %s", targetTable.Columns[i].Name, targetTable.Name)
+		if err = targetDB.QueryRow(ctx, stmt).Scan(&loaded); err != nil {
+			return fmt.Errorf("finding largest value of %s: %w", s.Column, err)
+		}
+
+		value, ok := lo.FromPtr(loaded), loaded != nil
+		if targetTable.SequenceSync == model.SequenceSyncSource && i < len(sourceTable.Columns) {
+			sourceValue, found, err := src.sequence(ctx, sourceTable, sourceTable.Columns[i].Name)
+			if err != nil {
+				return fmt.Errorf("reading source sequence of %s: %w", sourceTable.Columns[i].Name, err)
+			}
+			if found && (!ok || sourceValue > value) {
+				value, ok = sourceValue, true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		var last int64
+		var called bool
+		if err = targetDB.QueryRow(ctx, fmt.Sprintf("SELECT last_value, is_called FROM %s", s.Sequence)).Scan(&last, &called); err != nil {
+			return fmt.Errorf("reading sequence %s: %w", s.Sequence, err)
+		}
+		if !behind(last, called, value) {
+			continue
+		}
+
+		if _, err = targetDB.Exec(ctx, "SELECT setval($1, $2)", s.Sequence, value); err != nil {
+			return fmt.Errorf("advancing sequence %s: %w", s.Sequence, err)
+		}
+		logger.Info("sequence advanced", "column", s.Column, "sequence", s.Sequence, "value", value)
+	}
+
+	return nil
+}
+
+// behind returns true if the next value of a sequence, given its last value
+// and whether that's been issued yet, is no greater than the given value.
+func behind(last int64, called bool, value int64) bool {
+	if called {
+		return last < value
+	}
+	return last <= value
+}
+
+// sequence returns the last value issued by the sequence behind a source
+// table's column, and false if the column doesn't have one or it hasn't
+// issued any values.
+func (s *DBSource) sequence(ctx context.Context, t model.Table, column string) (int64, bool, error) {
+	rows, err := s.db.QueryContext(ctx, sequencesStmt, t.Name)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var sequence string
+	for rows.Next() {
+		var c columnSequence
+		if err = rows.Scan(&c.Column, &c.Sequence); err != nil {
+			return 0, false, err
+		}
+		if strings.EqualFold(c.Column, column) {
+			sequence = c.Sequence
+		}
+	}
+	if err = rows.Err(); err != nil || sequence == "" {
+		return 0, false, err
+	}
+
+	var last int64
+	var called bool
+	if err = s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT last_value, is_called FROM %s", sequence)).Scan(&last, &called); err != nil {
+		return 0, false, err
+	}
+	return last, called, nil
+}
+
+// sequence returns an error, as files don't have sequences.
+func (s *FileSource) sequence(ctx context.Context, t model.Table, column string) (int64, bool, error) {
+	return 0, false, fmt.Errorf("%s files don't have sequences", s.d.Driver)
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBehind(t *testing.T) {
+	cases := []struct {
+		name   string
+		last   int64
+		called bool
+		value  int64
+		exp    bool
+	}{
+		{name: "unused sequence behind", last: 1, value: 10, exp: true},
+		{name: "unused sequence at value", last: 10, value: 10, exp: true},
+		{name: "unused sequence ahead", last: 11, value: 10, exp: false},
+		{name: "used sequence behind", last: 9, called: true, value: 10, exp: true},
+		{name: "used sequence at value", last: 10, called: true, value: 10, exp: false},
+		{name: "used sequence ahead", last: 20, called: true, value: 10, exp: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.exp, behind(c.last, c.called, c.value))
+		})
+	}
+}
+
+func TestSyncSequences(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+
+	createStmts := []string{
+		`CREATE SEQUENCE ticket_id_seq`,
+		`CREATE TABLE ticket (id INT8 PRIMARY KEY DEFAULT nextval('ticket_id_seq'), title VARCHAR(255) NOT NULL)`,
+	}
+	for _, stmt := range createStmts {
+		_, err := source.Exec(stmt)
+		assert.Nil(t, err)
+		_, err = target.Exec(ctx, stmt)
+		assert.Nil(t, err)
+	}
+	defer func() {
+		for _, stmt := range []string{`DROP TABLE ticket`, `DROP SEQUENCE ticket_id_seq`} {
+			_, err := source.Exec(stmt)
+			assert.Nil(t, err)
+			_, err = target.Exec(ctx, stmt)
+			assert.Nil(t, err)
+		}
+	}()
+
+	// The source has issued ids up to 10, but only 1 to 3 are still in use.
+	_, err := source.Exec(`SELECT setval('ticket_id_seq', 10)`)
+	assert.Nil(t, err)
+
+	_, err = target.Exec(ctx, `INSERT INTO ticket (id, title) VALUES (1, 'a'), (2, 'b'), (3, 'c')`)
+	assert.Nil(t, err)
+
+	table := model.Table{
+		Name:    "ticket",
+		Columns: []model.Column{{Name: "id"}, {Name: "title"}},
+	}
+
+	nextID := func() int64 {
+		var id int64
+		assert.Nil(t, target.QueryRow(ctx, `SELECT nextval('ticket_id_seq')`).Scan(&id))
+		return id
+	}
+
+	assert.Nil(t, SyncSequences(ctx, NewDBSource(source), target, table, table))
+	assert.Equal(t, int64(4), nextID())
+
+	// Sequences are never moved backwards.
+	assert.Nil(t, SyncSequences(ctx, NewDBSource(source), target, table, table))
+	assert.Equal(t, int64(5), nextID())
+
+	table.SequenceSync = model.SequenceSyncSource
+	assert.Nil(t, SyncSequences(ctx, NewDBSource(source), target, table, table))
+	assert.Equal(t, int64(11), nextID())
+}
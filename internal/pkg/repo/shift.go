@@ -2,106 +2,467 @@ package repo
 
 import (
 	"context"
-	"database/sql"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/metrics"
 	"ds/internal/pkg/model"
+	"ds/internal/pkg/progress"
+	"ds/internal/pkg/throttle"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// InsertTable performs a bulk insert from the source database into the target database.
-func InsertTable(sourceDB *sql.DB, targetDB *pgxpool.Pool, sourceTable, targetTable model.Table) error {
-	for {
-		// Fetch current offset.
-		offset, err := getShiftState(targetDB, sourceTable.Name)
-		if err != nil {
-			return fmt.Errorf("fetching current offset: %w", err)
+// targetConn is satisfied by both *pgxpool.Pool and pgx.Tx, allowing rows
+// to be written to the target inside or outside of a transaction.
+type targetConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// Stats counts the rows processed whilst shifting a table.
+type Stats struct {
+	RowsRead     int64
+	RowsWritten  int64
+	RowsRejected int64
+}
+
+// InsertTable performs a bulk insert from the source database into the target database,
+// using the target table's load mode, and returns the number of rows processed.
+func InsertTable(ctx context.Context, src Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer) (stats Stats, err error) {
+	ctx, span := tracer.Start(ctx, "insert table", trace.WithAttributes(
+		attribute.String("table", sourceTable.Name),
+		attribute.String("target", targetTable.Name),
+		attribute.String("load_mode", string(targetTable.LoadMode)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	if err = targetTable.LoadMode.Validate(); err != nil {
+		return stats, err
+	}
+
+	finish, err := trackStatus(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("setting status: %w", err)
+	}
+	defer func() {
+		if statusErr := finish(err); statusErr != nil && err == nil {
+			err = statusErr
 		}
+	}()
 
-		// Read from input.
-		stmt := sourceTable.SelectStatement(offset)
-		rows, err := sourceDB.Query(stmt)
-		if err != nil {
-			return fmt.Errorf("querying rows: %w", err)
+	slog.Info("inserting table", "table", sourceTable.Name, "target", targetTable.Name, "load_mode", targetTable.LoadMode)
+
+	switch targetTable.LoadMode {
+	case model.LoadTruncate:
+		err = truncateAndLoad(ctx, src, targetDB, store, sourceTable, targetTable, tracker, pacer, &stats)
+	case model.LoadSwap:
+		err = swapAndLoad(ctx, src, targetDB, store, sourceTable, targetTable, tracker, pacer, &stats)
+	default:
+		err = copyTable(ctx, src, targetDB, store, sourceTable, targetTable, targetTable.Name, tracker, pacer, &stats)
+	}
+
+	return stats, err
+}
+
+// truncateAndLoad truncates the target table and copies every source row into
+// it within one transaction, so readers never observe a partially loaded table.
+func truncateAndLoad(ctx context.Context, src Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer, stats *Stats) error {
+	tx, err := targetDB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	slog.Info("truncating table", "table", sourceTable.Name, "target", targetTable.Name)
+	if _, err = tx.Exec(ctx, fmt.Sprintf("TRUNCATE %s", targetTable.Name)); err != nil {
+		return fmt.Errorf("truncating table: %w", err)
+	}
+
+	// The whole load is atomic, so always start from the beginning.
+	if err = checkpointOffset(ctx, store, sourceTable.Name, 0); err != nil {
+		return fmt.Errorf("resetting current offset: %w", err)
+	}
+
+	if err = copyTable(ctx, src, tx, store, sourceTable, targetTable, targetTable.Name, tracker, pacer, stats); err != nil {
+		return err
+	}
+
+	// Leave the offset at zero, so the next insert refreshes the table again.
+	if err = checkpointOffset(ctx, store, sourceTable.Name, 0); err != nil {
+		return fmt.Errorf("resetting current offset: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// swapAndLoad copies every source row into a shadow table and then renames it
+// over the target table in one transaction. Copying into the shadow table is
+// checkpointed, so an interrupted load resumes where it left off.
+func swapAndLoad(ctx context.Context, src Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer, stats *Stats) error {
+	newName := targetTable.PrefixedName("_shift_new_")
+	oldName := targetTable.PrefixedName("_shift_old_")
+	createStmts, swapStmts, dropStmt := shadowStatements(targetTable)
+
+	if err := checkSwap(ctx, targetDB, targetTable); err != nil {
+		return err
+	}
+
+	offset, err := store.Offset(ctx, sourceTable.Name)
+	if err != nil {
+		return fmt.Errorf("fetching current offset: %w", err)
+	}
+
+	// Start with a fresh shadow table, unless we're resuming a previous load.
+	// The shadow table is missing if a previous load swapped it in but was
+	// interrupted before resetting its offset.
+	var exists bool
+	if err = targetDB.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", newName).Scan(&exists); err != nil {
+		return fmt.Errorf("checking for shadow table: %w", err)
+	}
+
+	if offset == 0 || !exists {
+		if err = checkpointOffset(ctx, store, sourceTable.Name, 0); err != nil {
+			return fmt.Errorf("resetting current offset: %w", err)
 		}
 
-		values, err := scan(rows, sourceTable)
-		if err != nil {
-			return fmt.Errorf("scanning rows: %w", err)
+		slog.Info("creating shadow table", "table", sourceTable.Name, "shadow", newName)
+		for _, stmt := range createStmts {
+			if _, err = targetDB.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("creating shadow table: %w", err)
+			}
 		}
+	}
 
-		if len(values) == 0 {
-			return nil
+	if err = copyTable(ctx, src, targetDB, store, sourceTable, targetTable, newName, tracker, pacer, stats); err != nil {
+		return err
+	}
+
+	tx, err := targetDB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	slog.Info("swapping shadow table", "table", sourceTable.Name, "shadow", newName, "target", targetTable.Name)
+	for _, stmt := range swapStmts {
+		if _, err = tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("swapping shadow table: %w", err)
+		}
+	}
+
+	// The shadow table's serial columns share the old table's sequences,
+	// which would be dropped along with it.
+	if err = moveSequences(ctx, tx, oldName, targetTable.Name); err != nil {
+		return fmt.Errorf("moving sequences: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, dropStmt); err != nil {
+		return fmt.Errorf("dropping old table: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	// Reset the offset, so the next insert refreshes the table again.
+	if err = checkpointOffset(ctx, store, sourceTable.Name, 0); err != nil {
+		return fmt.Errorf("resetting current offset: %w", err)
+	}
+
+	return nil
+}
+
+// shadowStatements returns the statements that create a table's shadow table,
+// the statements that swap it for the table once it's been loaded, and the
+// statement that then drops the old table.
+func shadowStatements(t model.Table) (create, swap []string, drop string) {
+	newName := t.PrefixedName("_shift_new_")
+	oldName := t.PrefixedName("_shift_old_")
+
+	create = []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", newName),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", newName, t.Name),
+	}
+	swap = []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", t.Name, oldName),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", newName, t.Name),
+	}
+	return create, swap, fmt.Sprintf("DROP TABLE %s", oldName)
+}
+
+// swapDependentsStmt selects the objects that depend on a table but wouldn't
+// follow it to its shadow table: foreign keys, which aren't copied to the
+// shadow table, and views, which stay with the table they were created on.
+const swapDependentsStmt = `SELECT 'foreign key ' || conname FROM pg_constraint
+	WHERE contype = 'f' AND (conrelid = $1::regclass OR confrelid = $1::regclass)
+UNION
+SELECT 'view ' || r.ev_class::regclass::text FROM pg_depend d
+	JOIN pg_rewrite r ON r.oid = d.objid
+	WHERE d.classid = 'pg_rewrite'::regclass
+	AND d.refobjid = $1::regclass
+	AND r.ev_class <> $1::regclass
+ORDER BY 1`
+
+// checkSwap returns an error if a table has dependent objects that stop it
+// from being swapped for its shadow table.
+func checkSwap(ctx context.Context, targetDB *pgxpool.Pool, t model.Table) error {
+	rows, err := targetDB.Query(ctx, swapDependentsStmt, t.Name)
+	if err != nil {
+		return fmt.Errorf("finding dependent objects: %w", err)
+	}
+
+	dependents, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("finding dependent objects: %w", err)
+	}
+
+	if len(dependents) > 0 {
+		return fmt.Errorf("table %s can't use load_mode swap, as it has dependent objects: %s", t.Name, strings.Join(dependents, ", "))
+	}
+	return nil
+}
+
+// ownedSequencesStmt selects the columns of a table that own a sequence, such
+// as serial columns, along with the sequence. Identity columns' sequences
+// aren't included, as they're copied with the column.
+const ownedSequencesStmt = `SELECT a.attname, d.objid::regclass::text
+	FROM pg_depend d
+	JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+	JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+	WHERE d.classid = 'pg_class'::regclass
+	AND d.refobjid = $1::regclass
+	AND d.deptype = 'a'`
+
+// moveSequences moves the ownership of the sequences owned by the old table's
+// columns to the new table's columns of the same name.
+func moveSequences(ctx context.Context, tx pgx.Tx, oldName, newName string) error {
+	rows, err := tx.Query(ctx, ownedSequencesStmt, oldName)
+	if err != nil {
+		return err
+	}
+
+	sequences, err := pgx.CollectRows(rows, pgx.RowToStructByPos[columnSequence])
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sequences {
+		stmt := fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", s.Sequence, newName, pgx.Identifier{s.Column}.Sanitize())
+		if _, err = tx.Exec(ctx, stmt); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		// Write to output.
-		if _, err = targetDB.CopyFrom(context.Background(), pgx.Identifier{targetTable.Name}, targetTable.ColumnNames(), pgx.CopyFromRows(values)); err != nil {
+// copyStatement returns the statement that copies rows into the named table,
+// which is either the target table or its shadow.
+func copyStatement(name string, t model.Table) string {
+	return fmt.Sprintf("COPY %s (%s) FROM STDIN", name, strings.Join(t.ColumnNames(), ", "))
+}
+
+// copyTable copies rows from the source table into the named table, which is
+// either the target table or its shadow, in batches, checkpointing the offset
+// after each batch.
+func copyTable(ctx context.Context, src Source, targetDB targetConn, store checkpoint.Store, sourceTable, targetTable model.Table, targetName string, tracker *progress.Tracker, pacer *throttle.Pacer, stats *Stats) error {
+	// Fetch current offset.
+	offset, err := store.Offset(ctx, sourceTable.Name)
+	if err != nil {
+		return fmt.Errorf("fetching current offset: %w", err)
+	}
+	position, err := fetchPosition(ctx, store, sourceTable.Name)
+	if err != nil {
+		return fmt.Errorf("fetching current position: %w", err)
+	}
+	tracker.Set(int64(offset))
+
+	logger := slog.With("table", sourceTable.Name, "target", targetName)
+	logger.Info("copying rows", "offset", offset)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runStart, rows, batches := time.Now(), 0, 0
+
+	// Stream rows from the input directly into the output.
+	targetColumns := targetTable.ColumnNames()
+	copyStmt := copyStatement(targetName, targetTable)
+
+	for b := range src.batches(ctx, sourceTable, targetTable, offset, position, pacer) {
+		start := time.Now()
+		writeCtx, writeSpan := tracer.Start(b.ctx, "write", trace.WithAttributes(attribute.String("db.statement", copyStmt)))
+		count, err := targetDB.CopyFrom(writeCtx, pgx.Identifier{targetName}, targetColumns, b)
+		writeSpan.SetAttributes(attribute.Int64("rows", count))
+		endSpan(writeSpan, err)
+		if err != nil {
+			b.end(int(count), err)
 			return fmt.Errorf("inserting rows: %w", err)
 		}
+		// Rows are streamed into CopyFrom as they're read, so only the time
+		// it spent writing, rather than waiting for rows, is observed.
+		write := time.Since(start) - b.waitTime
+		metrics.WriteDuration.WithLabelValues(sourceTable.Name).Observe(write.Seconds())
+		metrics.RowsWritten.WithLabelValues(sourceTable.Name).Add(float64(count))
+		pacer.Observe(int(count), b.bytes, b.readTime, write)
+
+		// CopyFrom consumes every row read, so the two counts are the same.
+		stats.RowsRead += count
+		stats.RowsWritten += count
+
+		if count == 0 {
+			b.end(0, nil)
+			break
+		}
 
 		// Set current offset.
-		if err = setShiftState(targetDB, sourceTable.Name, offset+len(values)); err != nil {
+		offset += int(count)
+		err = checkpointPosition(b.ctx, store, sourceTable.Name, offset, b.position)
+		b.end(int(count), err)
+		if err != nil {
 			return fmt.Errorf("setting current offset: %w", err)
 		}
+		tracker.Set(int64(offset))
 
-		// Exit loop if we've read less than the read_limit.
-		if len(values) < sourceTable.ReadLimit {
-			return nil
-		}
+		batches++
+		rows += int(count)
+		logger.Debug("batch written", "batch", batches, "offset", offset, "rows", count, "duration", time.Since(start))
+	}
 
-		if sourceTable.ReadDelay > 0 {
-			time.Sleep(sourceTable.ReadDelay)
-		}
+	// The source stops reading batches once the context is cancelled, which
+	// mustn't be mistaken for the end of the table.
+	if err = ctx.Err(); err != nil {
+		return err
 	}
+
+	logger.Info("rows copied", "batches", batches, "offset", offset, "rows", rows, "duration", time.Since(runStart))
+	return nil
 }
 
-func UpdateTable(sourceDB *sql.DB, targetDB *pgxpool.Pool, sourceTable, targetTable model.Table) error {
-	for {
-		// Fetch current offset.
-		offset, err := getShiftState(targetDB, sourceTable.Name)
-		if err != nil {
-			return fmt.Errorf("fetching current offset: %w", err)
-		}
+// UpdateTable upserts rows from the source database into the target database,
+// resolving conflicts using the target table's conflict strategy, and returns
+// the number of rows processed.
+func UpdateTable(ctx context.Context, src Source, targetDB *pgxpool.Pool, store checkpoint.Store, sourceTable, targetTable model.Table, tracker *progress.Tracker, pacer *throttle.Pacer) (stats Stats, err error) {
+	ctx, span := tracer.Start(ctx, "update table", trace.WithAttributes(
+		attribute.String("table", sourceTable.Name),
+		attribute.String("target", targetTable.Name),
+		attribute.String("on_conflict", string(targetTable.OnConflict)),
+	))
+	defer func() { endSpan(span, err) }()
 
-		// Read from input.
-		stmt := sourceTable.SelectStatement(offset)
-		rows, err := sourceDB.Query(stmt)
-		if err != nil {
-			return fmt.Errorf("querying rows: %w", err)
+	finish, err := trackStatus(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("setting status: %w", err)
+	}
+	defer func() {
+		if statusErr := finish(err); statusErr != nil && err == nil {
+			err = statusErr
 		}
+	}()
+
+	// Fetch current offset.
+	offset, err := store.Offset(ctx, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("fetching current offset: %w", err)
+	}
+	position, err := fetchPosition(ctx, store, sourceTable.Name)
+	if err != nil {
+		return stats, fmt.Errorf("fetching current position: %w", err)
+	}
+	tracker.Set(int64(offset))
 
-		values, err := scan(rows, sourceTable)
+	logger := slog.With("table", sourceTable.Name, "target", targetTable.Name)
+	logger.Info("updating table", "offset", offset, "on_conflict", targetTable.OnConflict)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runStart, rows, batches := time.Now(), 0, 0
+
+	for b := range src.batches(ctx, sourceTable, targetTable, offset, position, pacer) {
+		// Read from input.
+		values, err := b.collect()
 		if err != nil {
-			return fmt.Errorf("scanning rows: %w", err)
+			b.end(0, err)
+			return stats, fmt.Errorf("reading rows: %w", err)
 		}
+		stats.RowsRead += int64(len(values))
 
 		if len(values) == 0 {
-			return nil
+			b.end(0, nil)
+			break
 		}
 
 		// Generate logical upsert statement.
-		if stmt, err = targetTable.UpsertStatement(values); err != nil {
-			return fmt.Errorf("generating upsert statement: %w", err)
+		stmt, err := targetTable.UpsertStatement(values)
+		if err != nil {
+			b.end(0, err)
+			return stats, fmt.Errorf("generating upsert statement: %w", err)
 		}
 
-		if _, err = targetDB.Exec(context.Background(), stmt, values.Flatten()...); err != nil {
-			return fmt.Errorf("upserting rows: %w", err)
+		start := time.Now()
+		writeCtx, writeSpan := tracer.Start(b.ctx, "write", trace.WithAttributes(
+			attribute.String("db.statement", stmt),
+			attribute.Int("rows", len(values)),
+		))
+		err = withRetries(writeCtx, sourceTable.Name, func() error {
+			if targetTable.OnConflict == model.ConflictError {
+				return upsertOrReport(writeCtx, targetDB, targetTable, stmt, values)
+			}
+			_, err := targetDB.Exec(writeCtx, stmt, values.Flatten()...)
+			return err
+		})
+		endSpan(writeSpan, err)
+
+		var conflictErr *RowConflictError
+		if errors.As(err, &conflictErr) {
+			metrics.RowsRejected.WithLabelValues(sourceTable.Name).Add(float64(len(conflictErr.Keys)))
+			stats.RowsRejected += int64(len(conflictErr.Keys))
+			logger.Error("conflicting rows", "batch", batches+1, "offset", offset, "rows", len(conflictErr.Keys), "keys", conflictErr.Keys)
+		}
+		if err != nil {
+			b.end(0, err)
+			return stats, fmt.Errorf("upserting rows: %w", err)
 		}
+		metrics.WriteDuration.WithLabelValues(sourceTable.Name).Observe(time.Since(start).Seconds())
+		metrics.RowsWritten.WithLabelValues(sourceTable.Name).Add(float64(len(values)))
+		pacer.Observe(len(values), b.bytes, b.readTime, time.Since(start))
+		stats.RowsWritten += int64(len(values))
 
 		// Set current offset.
-		if err = setShiftState(targetDB, sourceTable.Name, offset+len(values)); err != nil {
-			return fmt.Errorf("setting current offset: %w", err)
+		offset += len(values)
+		err = checkpointPosition(b.ctx, store, sourceTable.Name, offset, b.position)
+		b.end(len(values), err)
+		if err != nil {
+			return stats, fmt.Errorf("setting current offset: %w", err)
 		}
+		tracker.Set(int64(offset))
 
-		// Exit loop if we've read less than the read_limit.
-		if len(values) < sourceTable.ReadLimit {
-			return nil
-		}
+		batches++
+		rows += len(values)
+		logger.Debug("batch written", "batch", batches, "offset", offset, "rows", len(values), "duration", time.Since(start))
+	}
 
-		if sourceTable.ReadDelay > 0 {
-			time.Sleep(sourceTable.ReadDelay)
-		}
+	// The source stops reading batches once the context is cancelled, which
+	// mustn't be mistaken for the end of the table.
+	if err = ctx.Err(); err != nil {
+		return stats, err
 	}
+
+	logger.Info("table updated", "batches", batches, "offset", offset, "rows", rows, "duration", time.Since(runStart))
+	return stats, nil
 }
@@ -2,7 +2,9 @@ package repo
 
 import (
 	"context"
+	"ds/internal/pkg/checkpoint"
 	"ds/internal/pkg/model"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -35,13 +37,15 @@ func TestInsertTable(t *testing.T) {
 		},
 	}
 
-	assert.Nil(t, InsertTable(source, target, sourceTable, targetTable))
+	stats, err := InsertTable(context.Background(), NewDBSource(source), target, store, sourceTable, targetTable, nil, nil)
+	assert.Nil(t, err)
 
 	act := fetchTargetPeople(t)
 	act = lo.Map(act, func(p person, i int) person {
 		p.createdAt = p.createdAt.In(time.UTC)
 		return p
 	})
+	assert.Equal(t, Stats{RowsRead: int64(len(act)), RowsWritten: int64(len(act))}, stats)
 
 	assert.Equal(t, person{id: "bc229cee-5387-4c36-b83e-7a46613071de", fullName: "b b", createdAt: time.Date(2023, 1, 1, 1, 1, 2, 0, time.UTC)}, act[0])
 	assert.Equal(t, person{id: "ccb45142-cba0-4f97-9179-33c7e3d51e92", fullName: "c c", createdAt: time.Date(2023, 1, 1, 1, 1, 3, 0, time.UTC)}, act[1])
@@ -74,7 +78,8 @@ func TestUpdateTable(t *testing.T) {
 		},
 	}
 
-	assert.Nil(t, InsertTable(source, target, sourceTable, targetTable))
+	_, err := InsertTable(context.Background(), NewDBSource(source), target, store, sourceTable, targetTable, nil, nil)
+	assert.Nil(t, err)
 
 	makeUpdate(t)
 
@@ -91,6 +96,117 @@ func TestUpdateTable(t *testing.T) {
 	assert.Equal(t, person{id: "ee807359-2a2c-4f6b-a753-0b3cddc3729a", fullName: "F F", createdAt: time.Date(2023, 1, 1, 1, 1, 5, 0, time.UTC)}, act[4])
 }
 
+func TestInsertTableSwap(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+
+	createStmt := `CREATE TABLE event (id SERIAL PRIMARY KEY, name VARCHAR(255) NOT NULL)`
+	_, err := source.Exec(createStmt)
+	assert.Nil(t, err)
+	_, err = target.Exec(ctx, createStmt)
+	assert.Nil(t, err)
+	defer func() {
+		_, err := source.Exec(`DROP TABLE event`)
+		assert.Nil(t, err)
+		_, err = target.Exec(ctx, `DROP TABLE event`)
+		assert.Nil(t, err)
+	}()
+
+	_, err = source.Exec(`INSERT INTO event (name) VALUES ('a'), ('b'), ('c')`)
+	assert.Nil(t, err)
+
+	table := model.Table{
+		Name:     "event",
+		Columns:  []model.Column{{Name: "id"}, {Name: "name"}},
+		LoadMode: model.LoadSwap,
+	}
+
+	state := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+	assert.Nil(t, state.Ensure(ctx, model.Database{Tables: []model.Table{table}}, false))
+
+	// Each load hands the serial column's sequence over to the table it swaps
+	// in, so the old table can be dropped without it.
+	for i := 0; i < 2; i++ {
+		_, err = InsertTable(ctx, NewDBSource(source), target, state, table, table, nil, nil)
+		assert.Nil(t, err)
+	}
+
+	var count int
+	assert.Nil(t, target.QueryRow(ctx, `SELECT count(*) FROM event`).Scan(&count))
+	assert.Equal(t, 3, count)
+
+	assert.Nil(t, SyncSequences(ctx, NewDBSource(source), target, table, table))
+
+	var id int
+	assert.Nil(t, target.QueryRow(ctx, `INSERT INTO event (name) VALUES ('d') RETURNING id`).Scan(&id))
+	assert.Equal(t, 4, id)
+
+	// Tables with dependent objects can't be swapped.
+	_, err = target.Exec(ctx, `CREATE VIEW event_name AS SELECT name FROM event`)
+	assert.Nil(t, err)
+	defer func() {
+		_, err := target.Exec(ctx, `DROP VIEW event_name`)
+		assert.Nil(t, err)
+	}()
+
+	_, err = InsertTable(ctx, NewDBSource(source), target, state, table, table, nil, nil)
+	assert.ErrorContains(t, err, "table event can't use load_mode swap, as it has dependent objects: view event_name")
+}
+
+func TestUpdateTableConflictError(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+
+	_, err := source.Exec(`CREATE TABLE tag (id INT PRIMARY KEY, name VARCHAR(255) NOT NULL)`)
+	assert.Nil(t, err)
+	_, err = target.Exec(ctx, `CREATE TABLE tag (id INT PRIMARY KEY, name VARCHAR(255) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT now())`)
+	assert.Nil(t, err)
+	defer func() {
+		_, err := source.Exec(`DROP TABLE tag`)
+		assert.Nil(t, err)
+		_, err = target.Exec(ctx, `DROP TABLE tag`)
+		assert.Nil(t, err)
+	}()
+
+	_, err = source.Exec(`INSERT INTO tag (id, name) VALUES (1, 'a'), (2, 'b')`)
+	assert.Nil(t, err)
+
+	table := model.Table{
+		Name:       "tag",
+		PrimaryKey: "id",
+		Columns:    []model.Column{{Name: "id"}, {Name: "name"}},
+		OnConflict: model.ConflictError,
+	}
+
+	state := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "state.json"), "job")
+	assert.Nil(t, state.Ensure(ctx, model.Database{Tables: []model.Table{table}}, false))
+
+	// Rows that match the source aren't conflicts, even though the target's
+	// created_at column isn't loaded.
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, state.Reset(ctx, table.Name))
+		_, err = UpdateTable(ctx, NewDBSource(source), target, state, table, table, nil, nil)
+		assert.Nil(t, err)
+	}
+
+	_, err = target.Exec(ctx, `UPDATE tag SET name = 'B' WHERE id = 2`)
+	assert.Nil(t, err)
+
+	assert.Nil(t, state.Reset(ctx, table.Name))
+	_, err = UpdateTable(ctx, NewDBSource(source), target, state, table, table, nil, nil)
+
+	var conflictErr *RowConflictError
+	if assert.ErrorAs(t, err, &conflictErr) && assert.Len(t, conflictErr.Keys, 1) {
+		assert.EqualValues(t, 2, conflictErr.Keys[0])
+	}
+}
+
 func makeUpdate(t *testing.T) {
 	insertStmt := `INSERT INTO person (id, full_name, created_at) VALUES
 		('ee807359-2a2c-4f6b-a753-0b3cddc3729a', 'f f', '2023-01-01T01:01:05Z')`
@@ -0,0 +1,214 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/throttle"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/lo"
+)
+
+// Source reads the rows of source tables, either from a database or from
+// files.
+type Source interface {
+	// batches reads successive batches of a source table from the given
+	// offset, paced by the given pacer. Sources that read files resume from
+	// the given position in them, if it was recorded at the offset. The
+	// target table's column types are used to parse values from untyped
+	// sources.
+	batches(ctx context.Context, sourceTable, targetTable model.Table, offset int, position file.Position, pacer *throttle.Pacer) <-chan *batch
+
+	// estimateRows returns the number of rows that will be read from a source
+	// table, or zero if it's unknown.
+	estimateRows(ctx context.Context, t model.Table) (int64, error)
+
+	// describe checks that a source table can be read, returning the database
+	// types of its columns, or nil if its values are untyped, and the
+	// statement or files it's read from.
+	describe(ctx context.Context, t model.Table) (types []string, reads []string, err error)
+
+	// catalog returns the tables that the source's include patterns can
+	// select from.
+	catalog(ctx context.Context) ([]model.CatalogTable, error)
+
+	// sequence returns the last value issued by the sequence behind a source
+	// table's column, and false if it doesn't have one or it's yet to issue
+	// a value.
+	sequence(ctx context.Context, t model.Table, column string) (int64, bool, error)
+}
+
+// DBSource reads rows from a source database.
+type DBSource struct {
+	db *sql.DB
+}
+
+// NewDBSource returns a DBSource that reads rows from the given database.
+func NewDBSource(db *sql.DB) *DBSource {
+	return &DBSource{db: db}
+}
+
+func (s *DBSource) batches(ctx context.Context, sourceTable, _ model.Table, offset int, _ file.Position, pacer *throttle.Pacer) <-chan *batch {
+	return readBatches(ctx, sourceTable, offset, pacer, func(ctx context.Context, b *batch) int {
+		return b.read(ctx, s.db, sourceTable)
+	}, nil)
+}
+
+// describe returns the types of a source table's columns and the statement
+// that reads its first batch.
+func (s *DBSource) describe(ctx context.Context, t model.Table) ([]string, []string, error) {
+	rows, err := s.db.QueryContext(ctx, columnTypesStmt, t.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("querying columns: %w", err)
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			return nil, nil, fmt.Errorf("scanning columns: %w", err)
+		}
+		columns[name] = typ
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("scanning columns: %w", err)
+	}
+
+	types, err := orderTypes(t, columns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return types, []string{t.SelectStatement(0)}, nil
+}
+
+// FileSource reads rows from the files in a source directory. If it's given a
+// target database, values are parsed into the types of the target table's
+// columns; otherwise they're read as strings.
+type FileSource struct {
+	d        model.Database
+	targetDB *pgxpool.Pool
+}
+
+// NewFileSource returns a FileSource that reads the files of the given
+// database, typing values using the target database, which may be nil.
+func NewFileSource(d model.Database, targetDB *pgxpool.Pool) *FileSource {
+	return &FileSource{d: d, targetDB: targetDB}
+}
+
+// batches reads successive batches of a table's files from the offset, so an
+// interrupted import resumes where it left off.
+func (s *FileSource) batches(ctx context.Context, sourceTable, targetTable model.Table, offset int, position file.Position, pacer *throttle.Pacer) <-chan *batch {
+	r, err := s.open(ctx, sourceTable, targetTable, offset, position)
+	if err != nil {
+		return readBatches(ctx, sourceTable, offset, pacer, func(_ context.Context, b *batch) int {
+			close(b.rows)
+			b.err = err
+			return 0
+		}, nil)
+	}
+
+	return readBatches(ctx, sourceTable, offset, pacer, func(ctx context.Context, b *batch) int {
+		return b.readFile(ctx, r, sourceTable)
+	}, func() { r.Close() })
+}
+
+// open returns a reader for a table's files, moved to the offset. If the
+// position the offset was read up to is known, the reader seeks to it;
+// otherwise the rows before the offset are read again and skipped, as they
+// are when the offset has been set by hand.
+func (s *FileSource) open(ctx context.Context, sourceTable, targetTable model.Table, offset int, position file.Position) (*file.Reader, error) {
+	var types []string
+	if s.targetDB != nil {
+		var err error
+		if types, err = columnTypes(ctx, s.targetDB, targetTable); err != nil {
+			return nil, fmt.Errorf("fetching column types: %w", err)
+		}
+	}
+
+	r, err := file.NewReader(s.d, sourceTable, types)
+	if err != nil {
+		return nil, err
+	}
+
+	if position.File != "" && position.Row == offset {
+		if err = r.Seek(position); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("seeking to offset %d: %w", offset, err)
+		}
+		return r, nil
+	}
+
+	if err = r.Skip(offset); err != nil && !errors.Is(err, io.EOF) {
+		r.Close()
+		return nil, fmt.Errorf("skipping to offset %d: %w", offset, err)
+	}
+
+	return r, nil
+}
+
+// estimateRows returns zero, as counting the rows in a table's files would
+// mean reading them all.
+func (s *FileSource) estimateRows(ctx context.Context, t model.Table) (int64, error) {
+	return 0, nil
+}
+
+// describe returns the files a source table is read from. Their values are
+// untyped, so they're parsed using the target table's column types.
+func (s *FileSource) describe(ctx context.Context, t model.Table) ([]string, []string, error) {
+	files, err := file.Files(s.d, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, files, nil
+}
+
+// columnTypesStmt selects the name and database type of each of a table's
+// columns.
+const columnTypesStmt = `SELECT attname, format_type(atttypid, atttypmod) FROM pg_attribute
+	WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped`
+
+// columnTypes returns the database types of a target table's columns, in the
+// order of its configured columns.
+func columnTypes(ctx context.Context, targetDB *pgxpool.Pool, t model.Table) ([]string, error) {
+	rows, err := targetDB.Query(ctx, columnTypesStmt, t.Name)
+	if err != nil {
+		return nil, fmt.Errorf("querying columns: %w", err)
+	}
+
+	type column struct {
+		Name string
+		Type string
+	}
+
+	columns, err := pgx.CollectRows(rows, pgx.RowToStructByPos[column])
+	if err != nil {
+		return nil, fmt.Errorf("scanning columns: %w", err)
+	}
+
+	return orderTypes(t, lo.SliceToMap(columns, func(c column) (string, string) {
+		return c.Name, c.Type
+	}))
+}
+
+// orderTypes returns the types of a table's columns, in the order of its
+// configured columns, from a map of column names to types.
+func orderTypes(t model.Table, columns map[string]string) ([]string, error) {
+	types := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		typ, ok := columns[col.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing column %s in %s", col.Name, t.Name)
+		}
+		types[i] = typ
+	}
+
+	return types, nil
+}
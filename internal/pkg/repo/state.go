@@ -2,67 +2,81 @@ package repo
 
 import (
 	"context"
-	"ds/internal/pkg/model"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/metrics"
+	"encoding/json"
 	"fmt"
-
-	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
 )
 
-// EnsureStateTable creates the state table and initialises it with zeros for
-// each of the migration tables.
-func EnsureStateTable(targetDB *pgxpool.Pool, d model.Database, reset bool) error {
-	// Create table if it doesn't exist.
-	const tableStmt = `CREATE TABLE IF NOT EXISTS _shift_state (
-		"table_name" STRING PRIMARY KEY,
-		"current_offset" INT NOT NULL DEFAULT 0
-	)`
-	if _, err := targetDB.Exec(context.Background(), tableStmt); err != nil {
-		return fmt.Errorf("creating table: %w", err)
+// checkpointOffset records the current offset of a table in the store.
+func checkpointOffset(ctx context.Context, store checkpoint.Store, table string, offset int) error {
+	if err := store.Checkpoint(ctx, table, offset); err != nil {
+		return err
 	}
+	metrics.Checkpoint.WithLabelValues(table).Set(float64(offset))
+	slog.Debug("set offset", "table", table, "offset", offset)
 
-	// Add tables if they don't exist.
-	for _, table := range d.Tables {
-		rowStmt := `INSERT INTO _shift_state (table_name) VALUES ($1)
-								ON CONFLICT DO NOTHING`
+	return nil
+}
 
-		if _, err := targetDB.Exec(context.Background(), rowStmt, table.Name); err != nil {
-			return fmt.Errorf("initialising table state: %w", err)
-		}
+// checkpointPosition records the current offset of a table in the store, along
+// with the position in the source's files that it was read up to, if the table
+// was read from files.
+func checkpointPosition(ctx context.Context, store checkpoint.Store, table string, offset int, pos *file.Position) error {
+	if pos == nil {
+		return checkpointOffset(ctx, store, table, offset)
+	}
 
-		if !reset {
-			continue
-		}
+	b, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("encoding position: %w", err)
+	}
 
-		resetStmt := `UPDATE _shift_state SET current_offset = 0 WHERE true`
-		if _, err := targetDB.Exec(context.Background(), resetStmt); err != nil {
-			return fmt.Errorf("resetting table state: %w", err)
-		}
+	if err = store.CheckpointPosition(ctx, table, offset, string(b)); err != nil {
+		return err
 	}
+	metrics.Checkpoint.WithLabelValues(table).Set(float64(offset))
+	slog.Debug("set offset", "table", table, "offset", offset, "file", pos.File, "file_offset", pos.Offset)
 
 	return nil
 }
 
-// getShiftState returns the current_offset for a given table.
-func getShiftState(targetDB *pgxpool.Pool, table string) (int, error) {
-	const stmt = `SELECT current_offset FROM _shift_state WHERE table_name = $1`
-
-	row := targetDB.QueryRow(context.Background(), stmt, table)
+// fetchPosition returns the position in the source's files that a table's
+// current offset was read up to, or the zero Position if it wasn't recorded.
+func fetchPosition(ctx context.Context, store checkpoint.Store, table string) (file.Position, error) {
+	s, err := store.Position(ctx, table)
+	if err != nil || s == "" {
+		return file.Position{}, err
+	}
 
-	var offset int
-	if err := row.Scan(&offset); err != nil {
-		return 0, fmt.Errorf("scanning row: %w", err)
+	var pos file.Position
+	if err = json.Unmarshal([]byte(s), &pos); err != nil {
+		return file.Position{}, fmt.Errorf("decoding position: %w", err)
 	}
 
-	return offset, nil
+	return pos, nil
 }
 
-// setShiftState sets the current_offset for a given table.
-func setShiftState(targetDB *pgxpool.Pool, table string, offset int) error {
-	const stmt = `UPDATE _shift_state SET current_offset = $1 WHERE table_name = $2`
-
-	if _, err := targetDB.Exec(context.Background(), stmt, offset, table); err != nil {
-		return fmt.Errorf("updating offset: %w", err)
+// trackStatus marks a table as running and returns a function that marks it
+// as complete or failed, depending on the error it's given.
+func trackStatus(ctx context.Context, store checkpoint.Store, table string) (func(error) error, error) {
+	if err := store.SetStatus(ctx, table, checkpoint.StatusRunning); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return func(err error) error {
+		status := checkpoint.StatusComplete
+		if err != nil {
+			status = checkpoint.StatusFailed
+		} else {
+			// Row estimates can be out of date, so a table that's complete
+			// is no longer behind, whatever its estimate.
+			metrics.Lag.WithLabelValues(table).Set(0)
+		}
+
+		// Record the outcome even if the run was cancelled.
+		return store.SetStatus(context.WithoutCancel(ctx), table, status)
+	}, nil
 }
@@ -1,15 +1,126 @@
 package repo
 
-import "testing"
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/file"
+	"ds/internal/pkg/model"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
 
-func TestEnsureStateTable(t *testing.T) {
+	"github.com/stretchr/testify/assert"
+)
 
+func TestCheckpointOffset(t *testing.T) {
+	ctx := context.Background()
+	fileStore := newFileStore(t, "person")
+
+	assert.Nil(t, checkpointOffset(ctx, fileStore, "person", 10))
+
+	offset, err := fileStore.Offset(ctx, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, offset)
+}
+
+func TestCheckpointPosition(t *testing.T) {
+	cases := []struct {
+		name string
+		pos  *file.Position
+		exp  file.Position
+	}{
+		{name: "file source", pos: &file.Position{File: "person.csv", Offset: 42, Row: 10}, exp: file.Position{File: "person.csv", Offset: 42, Row: 10}},
+		{name: "database source"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			fileStore := newFileStore(t, "person")
+
+			assert.Nil(t, checkpointPosition(ctx, fileStore, "person", 10, c.pos))
+
+			offset, err := fileStore.Offset(ctx, "person")
+			assert.Nil(t, err)
+			assert.Equal(t, 10, offset)
+
+			pos, err := fetchPosition(ctx, fileStore, "person")
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, pos)
+		})
+	}
 }
 
-func TestGetShiftState(t *testing.T) {
+func TestTrackStatus(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		expStatus string
+	}{
+		{name: "success", expStatus: checkpoint.StatusComplete},
+		{name: "failure", err: errors.New("oh no"), expStatus: checkpoint.StatusFailed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			fileStore := newFileStore(t, "person")
+
+			finish, err := trackStatus(ctx, fileStore, "person")
+			assert.Nil(t, err)
+			assert.Equal(t, checkpoint.StatusRunning, fetchStatus(t, fileStore, "person"))
+
+			assert.Nil(t, finish(c.err))
+			assert.Equal(t, c.expStatus, fetchStatus(t, fileStore, "person"))
+		})
+	}
+}
+
+func TestStateManagement(t *testing.T) {
+	if !integrationTests {
+		t.Skipf("not running integration tests")
+	}
+
+	ctx := context.Background()
+
+	assert.Nil(t, store.Set(ctx, "person", 3))
+
+	states, err := store.List(ctx, "person")
+	assert.Nil(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, 3, states[0].Offset)
+	assert.Equal(t, checkpoint.StatusPending, states[0].Status)
+
+	assert.Nil(t, store.Reset(ctx, "person"))
+
+	states, err = store.List(ctx, "person")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, states[0].Offset)
+
+	assert.Equal(t, fmt.Errorf("missing state for missing"), store.Set(ctx, "missing", 1))
+}
+
+func newFileStore(t *testing.T, tables ...string) checkpoint.Store {
+	fileStore := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "state.json"), "test")
+
+	var d model.Database
+	for _, table := range tables {
+		d.Tables = append(d.Tables, model.Table{Name: table})
+	}
+
+	if err := fileStore.Ensure(context.Background(), d, false); err != nil {
+		t.Fatalf("error ensuring file store: %v", err)
+	}
 
+	return fileStore
 }
 
-func TestSetShiftState(t *testing.T) {
+func fetchStatus(t *testing.T, s checkpoint.Store, table string) string {
+	states, err := s.List(context.Background(), table)
+	if err != nil || len(states) != 1 {
+		t.Fatalf("error listing state for %s: %v", table, err)
+	}
 
+	return states[0].Status
 }
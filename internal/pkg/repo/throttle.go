@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"context"
+	"ds/internal/pkg/throttle"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// admissionStmt sums the lengths of the admission control queues on the
+// CockroachDB node that the target is connected to.
+const admissionStmt = `SELECT COALESCE(sum(value), 0) FROM crdb_internal.node_metrics
+	WHERE name LIKE 'admission.wait_queue_length.%'`
+
+// AdmissionPressure returns a function that reports whether the target
+// CockroachDB cluster has work queued by admission control, which it does
+// when it's overloaded.
+func AdmissionPressure(targetDB *pgxpool.Pool) throttle.PressureFunc {
+	return func(ctx context.Context) (bool, error) {
+		var queued float64
+		if err := targetDB.QueryRow(ctx, admissionStmt).Scan(&queued); err != nil {
+			return false, fmt.Errorf("querying admission control queues: %w", err)
+		}
+		return queued > 0, nil
+	}
+}
@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"ds/internal/pkg/logging"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans for tables, batches and the phases within them.
+var tracer = otel.Tracer("ds/internal/pkg/repo")
+
+// endSpan records an error against a span, if one occurred, and ends it.
+// Credentials are redacted from the error first.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		msg := logging.Redact(err.Error())
+		span.RecordError(errors.New(msg))
+		span.SetStatus(codes.Error, msg)
+	}
+	span.End()
+}
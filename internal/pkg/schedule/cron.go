@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field describes one of the five fields of a cron expression.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minutes = field{name: "minute", min: 0, max: 59}
+	hours   = field{name: "hour", min: 0, max: 23}
+	days    = field{name: "day of month", min: 1, max: 31}
+	months  = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	weekdays = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// macros are the shorthands accepted in place of a five-field expression.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron is a parsed cron expression. Each field is a bit set of the values it
+// matches.
+type Cron struct {
+	minute, hour, day, month, weekday uint64
+
+	// Days match if either the day of month or the day of week matches,
+	// unless one of them is unrestricted, in which case both must match.
+	anyDay, anyWeekday bool
+}
+
+// ParseCron parses a standard five-field cron expression ("minute hour
+// day-of-month month day-of-week"), in which each field is *, a value, a
+// range (1-5), a step (*/15 or 1-30/5) or a comma-separated list of them.
+// Months and days of the week can also be given by their three-letter
+// names, and macros such as @daily are accepted.
+func ParseCron(expr string) (Cron, error) {
+	if macro, ok := macros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(parts))
+	}
+
+	var c Cron
+	var err error
+	for i, f := range []struct {
+		field field
+		bits  *uint64
+	}{
+		{minutes, &c.minute},
+		{hours, &c.hour},
+		{days, &c.day},
+		{months, &c.month},
+		{weekdays, &c.weekday},
+	} {
+		if *f.bits, err = f.field.parse(parts[i]); err != nil {
+			return Cron{}, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+
+	// Sunday is both 0 and 7.
+	if c.weekday&(1<<7) != 0 {
+		c.weekday |= 1
+	}
+
+	c.anyDay = parts[2] == "*" || strings.HasPrefix(parts[2], "*/")
+	c.anyWeekday = parts[4] == "*" || strings.HasPrefix(parts[4], "*/")
+
+	return c, nil
+}
+
+// Next returns the first time the expression matches that's strictly after
+// the given time, in the given time's location, or the zero time if it
+// doesn't match within the next five years.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.Year() + 5
+
+	// Move to the start of each field's next matching value in turn, starting
+	// over whenever a field wraps around into the next larger one.
+wrap:
+	for t.Year() <= limit {
+		for !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+
+		for !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			if t.Day() == 1 {
+				continue wrap
+			}
+		}
+
+		for !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if t.Hour() == 0 {
+				continue wrap
+			}
+		}
+
+		for !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c Cron) matchesDay(t time.Time) bool {
+	day, weekday := has(c.day, t.Day()), has(c.weekday, int(t.Weekday()))
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+func has(bits uint64, value int) bool {
+	return bits&(1<<uint(value)) != 0
+}
+
+// parse returns the bit set of values matched by a field's expression.
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, stepExpr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepExpr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step: %q", f.name, stepExpr)
+			}
+		}
+
+		var start, end int
+		switch lo, hi, isRange := strings.Cut(rng, "-"); {
+		case rng == "*":
+			start, end = f.min, f.max
+		case isRange:
+			var err error
+			if start, err = f.value(lo); err != nil {
+				return 0, err
+			}
+			if end, err = f.value(hi); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid %s range: %q", f.name, rng)
+			}
+		default:
+			var err error
+			if start, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			end = start
+			if hasStep {
+				end = f.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// value parses a single value of the field, given as a number or a name.
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s: %q", f.name, s)
+	}
+	return v, nil
+}
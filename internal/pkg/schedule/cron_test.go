@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		name   string
+		expr   string
+		expErr error
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "values", expr: "30 22 1 6 3"},
+		{name: "ranges steps and lists", expr: "*/15 0-6,22-23 1-31/2 * 1-5"},
+		{name: "names", expr: "0 22 * jan-MAR sat,sun"},
+		{name: "sunday as seven", expr: "0 0 * * 7"},
+		{name: "macro", expr: "@daily"},
+		{name: "too few fields", expr: "0 22 * *", expErr: fmt.Errorf(`invalid cron expression "0 22 * *": expected 5 fields, got 4`)},
+		{name: "out of range", expr: "60 22 * * *", expErr: fmt.Errorf(`invalid cron expression "60 22 * * *": invalid minute: "60"`)},
+		{name: "invalid name", expr: "0 22 * * fun", expErr: fmt.Errorf(`invalid cron expression "0 22 * * fun": invalid day of week: "fun"`)},
+		{name: "invalid step", expr: "*/0 22 * * *", expErr: fmt.Errorf(`invalid cron expression "*/0 22 * * *": invalid minute step: "0"`)},
+		{name: "inverted range", expr: "0 6-2 * * *", expErr: fmt.Errorf(`invalid cron expression "0 6-2 * * *": invalid hour range: "6-2"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseCron(c.expr)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2024, time.January, 10, 12, 30, 15, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		expr string
+		from time.Time
+		exp  time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", exp: time.Date(2024, time.January, 10, 12, 31, 0, 0, time.UTC)},
+		{name: "strictly after", expr: "31 12 * * *", from: time.Date(2024, time.January, 10, 12, 31, 0, 0, time.UTC), exp: time.Date(2024, time.January, 11, 12, 31, 0, 0, time.UTC)},
+		{name: "later today", expr: "0 22 * * *", exp: time.Date(2024, time.January, 10, 22, 0, 0, 0, time.UTC)},
+		{name: "tomorrow", expr: "0 2 * * *", exp: time.Date(2024, time.January, 11, 2, 0, 0, 0, time.UTC)},
+		{name: "step", expr: "*/20 * * * *", exp: time.Date(2024, time.January, 10, 12, 40, 0, 0, time.UTC)},
+		{name: "weekend", expr: "0 0 * * sat,sun", exp: time.Date(2024, time.January, 13, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as seven", expr: "0 0 * * 7", exp: time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", expr: "0 0 15 * mon", exp: time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week first", expr: "0 0 12 * fri", exp: time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+		{name: "next month", expr: "0 0 1 * *", exp: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "next year", expr: "0 0 1 1 *", exp: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expr: "0 0 29 2 *", exp: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expr: "0 0 30 2 *", exp: time.Time{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cron, err := ParseCron(c.expr)
+			assert.Nil(t, err)
+
+			start := from
+			if !c.from.IsZero() {
+				start = c.from
+			}
+			assert.Equal(t, c.exp, cron.Next(start))
+		})
+	}
+}
+
+func TestCronNextInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+
+	cron, err := ParseCron("0 22 * * *")
+	assert.Nil(t, err)
+
+	// 01:00 UTC is 20:00 in New York, in winter.
+	from := time.Date(2024, time.January, 10, 1, 0, 0, 0, time.UTC).In(loc)
+	act := cron.Next(from)
+	assert.Equal(t, time.Date(2024, time.January, 10, 3, 0, 0, 0, time.UTC), act.UTC())
+}
@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window is a recurring period of time, which opens whenever its cron
+// expression matches and stays open for its duration.
+type Window struct {
+	cron     Cron
+	duration time.Duration
+	loc      *time.Location
+}
+
+// NewWindow returns a window that opens at the times matched by a cron
+// expression, evaluated in the given IANA time zone (UTC if empty), and stays
+// open for the given duration.
+func NewWindow(expr string, duration time.Duration, timezone string) (Window, error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return Window{}, err
+	}
+
+	if duration <= 0 {
+		return Window{}, fmt.Errorf("invalid duration: %s", duration)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	return Window{cron: cron, duration: duration, loc: loc}, nil
+}
+
+// Open returns true if the window is open at the given time, along with the
+// time it closes.
+func (w Window) Open(t time.Time) (bool, time.Time) {
+	// The window is open if it last opened within its duration of t.
+	opened := w.cron.Next(t.In(w.loc).Add(-w.duration))
+	if opened.IsZero() || opened.After(t) {
+		return false, time.Time{}
+	}
+	return true, opened.Add(w.duration)
+}
+
+// NextOpen returns the next time the window opens after the given time, or
+// the zero time if it never does.
+func (w Window) NextOpen(t time.Time) time.Time {
+	return w.cron.Next(t.In(w.loc))
+}
+
+// Until returns how long it is from the given time until one of the windows
+// is open, which is zero if one is open already or there aren't any, along
+// with the time it opens. It returns an error if none of them ever open.
+func Until(windows []Window, t time.Time) (time.Duration, time.Time, error) {
+	if len(windows) == 0 {
+		return 0, t, nil
+	}
+
+	var next time.Time
+	for _, w := range windows {
+		if open, _ := w.Open(t); open {
+			return 0, t, nil
+		}
+
+		if opens := w.NextOpen(t); !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+
+	if next.IsZero() {
+		return 0, time.Time{}, fmt.Errorf("no maintenance window opens in the next five years")
+	}
+	return next.Sub(t), next, nil
+}
@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWindow(t *testing.T) {
+	cases := []struct {
+		name     string
+		expr     string
+		duration time.Duration
+		timezone string
+		expErr   error
+	}{
+		{name: "valid", expr: "0 22 * * *", duration: 8 * time.Hour, timezone: "Europe/London"},
+		{name: "utc by default", expr: "0 22 * * *", duration: 8 * time.Hour},
+		{name: "invalid cron", expr: "0 22 * *", duration: 8 * time.Hour, expErr: fmt.Errorf(`invalid cron expression "0 22 * *": expected 5 fields, got 4`)},
+		{name: "missing duration", expr: "0 22 * * *", expErr: fmt.Errorf("invalid duration: 0s")},
+		{name: "invalid timezone", expr: "0 22 * * *", duration: 8 * time.Hour, timezone: "Mars/Olympus", expErr: fmt.Errorf("invalid timezone: unknown time zone Mars/Olympus")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewWindow(c.expr, c.duration, c.timezone)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestWindowOpen(t *testing.T) {
+	// Open from 22:00 to 06:00 London time, which is UTC in winter.
+	w, err := NewWindow("0 22 * * *", 8*time.Hour, "Europe/London")
+	assert.Nil(t, err)
+
+	cases := []struct {
+		name      string
+		at        time.Time
+		expOpen   bool
+		expCloses time.Time
+	}{
+		{name: "before", at: time.Date(2024, time.January, 10, 21, 59, 0, 0, time.UTC)},
+		{name: "opening", at: time.Date(2024, time.January, 10, 22, 0, 0, 0, time.UTC), expOpen: true, expCloses: time.Date(2024, time.January, 11, 6, 0, 0, 0, time.UTC)},
+		{name: "overnight", at: time.Date(2024, time.January, 11, 3, 0, 0, 0, time.UTC), expOpen: true, expCloses: time.Date(2024, time.January, 11, 6, 0, 0, 0, time.UTC)},
+		{name: "closing", at: time.Date(2024, time.January, 11, 6, 0, 0, 0, time.UTC)},
+		{name: "daytime", at: time.Date(2024, time.January, 11, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			open, closes := w.Open(c.at)
+			assert.Equal(t, c.expOpen, open)
+			assert.True(t, c.expCloses.Equal(closes))
+		})
+	}
+}
+
+func TestUntil(t *testing.T) {
+	nights, err := NewWindow("0 22 * * *", 8*time.Hour, "")
+	assert.Nil(t, err)
+
+	lunch, err := NewWindow("0 12 * * mon-fri", time.Hour, "")
+	assert.Nil(t, err)
+
+	never, err := NewWindow("0 0 30 2 *", time.Hour, "")
+	assert.Nil(t, err)
+
+	// A Wednesday.
+	morning := time.Date(2024, time.January, 10, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		windows  []Window
+		at       time.Time
+		exp      time.Duration
+		expOpens time.Time
+		expErr   error
+	}{
+		{name: "no windows", at: morning, expOpens: morning},
+		{name: "open", windows: []Window{nights}, at: morning.Add(-4 * time.Hour), expOpens: morning.Add(-4 * time.Hour)},
+		{name: "closed", windows: []Window{nights}, at: morning, exp: 13 * time.Hour, expOpens: time.Date(2024, time.January, 10, 22, 0, 0, 0, time.UTC)},
+		{name: "earliest window", windows: []Window{nights, lunch}, at: morning, exp: 3 * time.Hour, expOpens: time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)},
+		{name: "never opens", windows: []Window{never}, at: morning, expErr: fmt.Errorf("no maintenance window opens in the next five years")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			act, opens, err := Until(c.windows, c.at)
+			if c.expErr != nil {
+				assert.EqualError(t, err, c.expErr.Error())
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, c.exp, act)
+			assert.True(t, c.expOpens.Equal(opens))
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package throttle
+
+import (
+	"context"
+	"ds/internal/pkg/metrics"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/schedule"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// backoffStep is the least the delay between batches grows to when a
+	// table's batches are slow, and the delay below which it drops to zero
+	// once they aren't.
+	backoffStep = 100 * time.Millisecond
+
+	// pressureInterval is how often the target is checked for pressure.
+	pressureInterval = 5 * time.Second
+
+	// defaultBatchSize is the number of rows in a table's first batch when
+	// batches are sized automatically and the table doesn't have a
+	// read_limit.
+	defaultBatchSize = 1000
+
+	// windowInterval is the longest a paused table sleeps before checking its
+	// maintenance windows again, so changes to the wall clock are noticed.
+	windowInterval = time.Minute
+)
+
+// PressureFunc reports whether a database is under pressure, such as having
+// work queued by admission control.
+type PressureFunc func(context.Context) (bool, error)
+
+// Controller holds a run's throttle and batch size settings, which can be
+// changed while the run is in progress, and creates the pacers that apply them
+// to each table.
+type Controller struct {
+	pressure PressureFunc
+
+	mu       sync.Mutex
+	settings model.Throttle
+	sizing   model.BatchSize
+}
+
+// New returns a Controller with the given settings. The pressure function,
+// which may be nil, is checked if the settings enable admission control.
+func New(settings model.Throttle, sizing model.BatchSize, pressure PressureFunc) *Controller {
+	return &Controller{settings: settings, sizing: sizing, pressure: pressure}
+}
+
+// Set replaces the throttle and batch size settings, taking effect from the
+// next batch of every table.
+func (c *Controller) Set(settings model.Throttle, sizing model.BatchSize) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settings = settings
+	c.sizing = sizing
+}
+
+// Settings returns the current throttle settings.
+func (c *Controller) Settings() model.Throttle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.settings
+}
+
+// Sizing returns the current batch size settings.
+func (c *Controller) Sizing() model.BatchSize {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sizing
+}
+
+// Pacer returns a Pacer for a table, which waits at least the table's
+// read_delay between batches and only reads batches while one of the given
+// maintenance windows is open, if there are any. It's safe to call on a nil
+// Controller, which returns a nil Pacer.
+func (c *Controller) Pacer(t model.Table, windows []schedule.Window) *Pacer {
+	if c == nil {
+		return nil
+	}
+
+	return &Pacer{
+		c:        c,
+		table:    t.Name,
+		minDelay: t.ReadDelay,
+		windows:  windows,
+		started:  time.Now(),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Pacer paces the batches read from a single table. The delay between batches
+// is the longest of the table's read_delay, the time needed to keep to the
+// rows_per_second cap and an adaptive delay, which doubles while batches are
+// slower than max_batch_latency or the target is under pressure, and halves
+// while they aren't.
+//
+// If batches are sized automatically, the Pacer also chooses the number of
+// rows in each batch, scaling the last batch's size by how far its duration or
+// size was from the target, at most doubling or halving it each time.
+//
+// A Pacer can also be paused, and have its table's read_limit and read_delay
+// changed, while its table is being shifted.
+type Pacer struct {
+	c       *Controller
+	table   string
+	windows []schedule.Window
+
+	mu        sync.Mutex
+	minDelay  time.Duration
+	readLimit int
+	delay     time.Duration
+	limit     int
+	started   time.Time
+	checked   time.Time
+	pressured bool
+
+	// paused is true while the table's been paused, and changed is closed,
+	// then replaced, each time it's paused or resumed.
+	paused  bool
+	changed chan struct{}
+
+	// closed is true while the table is waiting for a maintenance window.
+	closed bool
+}
+
+// Wait blocks until the next batch can be read, given the number of rows in
+// the batch that's just been read, or until the context is cancelled. It's
+// safe to call on a nil Pacer, which doesn't wait.
+func (p *Pacer) Wait(ctx context.Context, rows int) error {
+	if p == nil {
+		return nil
+	}
+
+	p.checkPressure(ctx)
+
+	wait := p.next(rows)
+	metrics.ThrottleDelay.WithLabelValues(p.table).Set(wait.Seconds())
+
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	p.started = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Open blocks until the table is neither paused nor outside of its
+// maintenance windows, or until the context is cancelled. It's called before
+// each batch is read, so a table that's being shifted when it's paused or its
+// windows close stops once its current batch has been written and
+// checkpointed, and carries on from there when it's resumed or the next one
+// opens. It's safe to call on a nil Pacer, which doesn't wait.
+func (p *Pacer) Open(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	paused, closed := false, false
+	defer func() {
+		p.setClosed(false)
+		if paused || closed {
+			metrics.Paused.WithLabelValues(p.table).Set(0)
+		}
+	}()
+
+	for {
+		pausedNow, changed := p.state()
+		switch {
+		case pausedNow && !paused:
+			slog.Info("table paused", "table", p.table)
+			metrics.Paused.WithLabelValues(p.table).Set(1)
+		case !pausedNow && paused:
+			slog.Info("table resumed", "table", p.table)
+			metrics.Paused.WithLabelValues(p.table).Set(0)
+		}
+		paused = pausedNow
+
+		if paused {
+			if closed {
+				p.setClosed(false)
+				closed = false
+			}
+
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(p.windows) == 0 {
+			return nil
+		}
+
+		wait, opens, err := schedule.Until(p.windows, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if wait <= 0 {
+			if closed {
+				slog.Info("maintenance window open, resuming", "table", p.table)
+			}
+			return nil
+		}
+
+		if !closed {
+			slog.Info("outside maintenance window, pausing", "table", p.table, "opens", opens)
+			metrics.Paused.WithLabelValues(p.table).Set(1)
+			p.setClosed(true)
+			closed = true
+		}
+
+		// Wake up early if the table's paused in the meantime, so it's
+		// reported as paused rather than waiting for a window.
+		select {
+		case <-time.After(min(wait, windowInterval)):
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pause stops the table from reading any more batches until it's resumed. It's
+// safe to call on a nil Pacer.
+func (p *Pacer) Pause() {
+	p.setPaused(true)
+}
+
+// Resume lets a paused table carry on reading batches. It's safe to call on a
+// nil Pacer.
+func (p *Pacer) Resume() {
+	p.setPaused(false)
+}
+
+// Paused returns true if the table has been paused. It's safe to call on a nil
+// Pacer.
+func (p *Pacer) Paused() bool {
+	if p == nil {
+		return false
+	}
+
+	paused, _ := p.state()
+	return paused
+}
+
+// Closed returns true while the table is waiting for one of its maintenance
+// windows to open. It's safe to call on a nil Pacer.
+func (p *Pacer) Closed() bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+// SetReadLimit overrides the table's read_limit from its next batch. If
+// batches are sized automatically, sizing starts again from the new limit.
+// It's safe to call on a nil Pacer.
+func (p *Pacer) SetReadLimit(limit int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.readLimit = limit
+	p.limit = 0
+}
+
+// SetReadDelay overrides the table's read_delay from its next batch. It's safe
+// to call on a nil Pacer.
+func (p *Pacer) SetReadDelay(delay time.Duration) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.minDelay = delay
+}
+
+// ReadLimit returns the table's read_limit, given the one it's configured
+// with, taking into account any override. It's safe to call on a nil Pacer.
+func (p *Pacer) ReadLimit(readLimit int) int {
+	if p == nil {
+		return readLimit
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.readLimit > 0 {
+		return p.readLimit
+	}
+	return readLimit
+}
+
+// ReadDelay returns the table's read_delay, taking into account any override.
+// It's safe to call on a nil Pacer.
+func (p *Pacer) ReadDelay() time.Duration {
+	if p == nil {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.minDelay
+}
+
+// state returns whether the table's paused, along with a channel that's closed
+// the next time it's paused or resumed.
+func (p *Pacer) state() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused, p.changed
+}
+
+func (p *Pacer) setPaused(paused bool) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused != paused {
+		p.paused = paused
+		close(p.changed)
+		p.changed = make(chan struct{})
+	}
+}
+
+func (p *Pacer) setClosed(closed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = closed
+}
+
+// Limit returns the number of rows to read in the table's next batch, which
+// is its read_limit, or the limit it's been overridden with, unless batches
+// are sized automatically. It's safe to call on a nil Pacer, which returns the
+// read_limit.
+func (p *Pacer) Limit(readLimit int) int {
+	if p == nil {
+		return readLimit
+	}
+
+	readLimit = p.ReadLimit(readLimit)
+	sizing := p.c.Sizing()
+	if !sizing.Auto() {
+		return readLimit
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	minRows, maxRows := sizing.Bounds()
+	if p.limit == 0 {
+		p.limit = readLimit
+		if p.limit <= 0 {
+			p.limit = defaultBatchSize
+		}
+	}
+	p.limit = min(max(p.limit, minRows), maxRows)
+
+	return p.limit
+}
+
+// Observe adjusts the adaptive delay and, if batches are sized automatically,
+// the size of the next batch, given the number of rows and bytes in the last
+// batch and how long it took to read and write. It's safe to call on a nil
+// Pacer.
+func (p *Pacer) Observe(rows, bytes int, read, write time.Duration) {
+	if p == nil {
+		return
+	}
+
+	settings, sizing := p.c.Settings(), p.c.Sizing()
+	latency := max(read, write)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resize(sizing, rows, bytes, latency)
+
+	slow := settings.MaxBatchLatency > 0 && latency > settings.MaxBatchLatency
+	pressured := settings.AdmissionControl && p.pressured
+
+	previous := p.delay
+	switch {
+	case slow || pressured:
+		limit := max(settings.DelayLimit(), p.minDelay)
+		p.delay = min(max(2*max(p.delay, p.minDelay), backoffStep), limit)
+	case p.delay > 0:
+		if p.delay /= 2; p.delay < backoffStep {
+			p.delay = 0
+		}
+	}
+
+	if p.delay != previous {
+		slog.Debug("throttle delay changed", "table", p.table, "delay", p.delay, "latency", latency, "pressure", pressured)
+	}
+}
+
+// resize scales the number of rows in the next batch by how far the last
+// batch was from the target duration and size, favouring the smaller of the
+// two, within the configured bounds.
+func (p *Pacer) resize(sizing model.BatchSize, rows, bytes int, latency time.Duration) {
+	if !sizing.Auto() || p.limit == 0 || rows == 0 {
+		return
+	}
+
+	target := math.Inf(1)
+	if sizing.TargetDuration > 0 && latency > 0 {
+		target = math.Min(target, float64(rows)*float64(sizing.TargetDuration)/float64(latency))
+	}
+	if sizing.TargetBytes > 0 && bytes > 0 {
+		target = math.Min(target, float64(rows)*float64(sizing.TargetBytes)/float64(bytes))
+	}
+	if math.IsInf(target, 1) {
+		return
+	}
+
+	minRows, maxRows := sizing.Bounds()
+	target = math.Max(math.Min(target, float64(2*p.limit)), float64(p.limit/2))
+
+	previous := p.limit
+	p.limit = min(max(int(target), minRows), maxRows)
+
+	if p.limit != previous {
+		slog.Debug("batch size changed", "table", p.table, "rows", p.limit, "latency", latency, "bytes", bytes)
+	}
+}
+
+// Delay returns the adaptive delay between the table's batches.
+func (p *Pacer) Delay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.delay
+}
+
+// next returns how long to wait before reading the next batch.
+func (p *Pacer) next(rows int) time.Duration {
+	settings := p.c.Settings()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wait := max(p.minDelay, p.delay)
+	if settings.RowsPerSecond > 0 {
+		pace := time.Duration(rows) * time.Second / time.Duration(settings.RowsPerSecond)
+		wait = max(wait, pace-time.Since(p.started))
+	}
+
+	return wait
+}
+
+// checkPressure refreshes whether the target is under pressure, if admission
+// control is enabled and it hasn't been checked recently. Errors are logged
+// rather than returned, so a failed check doesn't stop the run.
+func (p *Pacer) checkPressure(ctx context.Context) {
+	if p.c.pressure == nil || !p.c.Settings().AdmissionControl {
+		return
+	}
+
+	p.mu.Lock()
+	due := time.Since(p.checked) >= pressureInterval
+	p.mu.Unlock()
+	if !due {
+		return
+	}
+
+	pressured, err := p.c.pressure(ctx)
+	if err != nil {
+		slog.Warn("error checking target pressure", "table", p.table, "error", err)
+	}
+
+	p.mu.Lock()
+	p.checked = time.Now()
+	p.pressured = pressured
+	p.mu.Unlock()
+}
@@ -0,0 +1,320 @@
+package throttle
+
+import (
+	"context"
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/schedule"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacerObserve(t *testing.T) {
+	settings := model.Throttle{MaxBatchLatency: time.Second, MaxDelay: time.Second}
+
+	cases := []struct {
+		name      string
+		readDelay time.Duration
+		delay     time.Duration
+		read      time.Duration
+		write     time.Duration
+		exp       time.Duration
+	}{
+		{name: "healthy", write: 500 * time.Millisecond, exp: 0},
+		{name: "slow write", write: 2 * time.Second, exp: backoffStep},
+		{name: "slow read", read: 2 * time.Second, exp: backoffStep},
+		{name: "still slow", delay: 200 * time.Millisecond, write: 2 * time.Second, exp: 400 * time.Millisecond},
+		{name: "slow from read delay", readDelay: 300 * time.Millisecond, write: 2 * time.Second, exp: 600 * time.Millisecond},
+		{name: "limited", delay: 800 * time.Millisecond, write: 2 * time.Second, exp: time.Second},
+		{name: "recovering", delay: 800 * time.Millisecond, write: 500 * time.Millisecond, exp: 400 * time.Millisecond},
+		{name: "recovered", delay: 150 * time.Millisecond, write: 500 * time.Millisecond, exp: 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New(settings, model.BatchSize{}, nil).Pacer(model.Table{Name: "person", ReadDelay: c.readDelay}, nil)
+			p.delay = c.delay
+
+			p.Observe(0, 0, c.read, c.write)
+			assert.Equal(t, c.exp, p.Delay())
+		})
+	}
+}
+
+func TestPacerObserveWithoutLatency(t *testing.T) {
+	p := New(model.Throttle{}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person"}, nil)
+
+	p.Observe(0, 0, time.Hour, time.Hour)
+	assert.Equal(t, time.Duration(0), p.Delay())
+}
+
+func TestPacerLimit(t *testing.T) {
+	cases := []struct {
+		name      string
+		sizing    model.BatchSize
+		readLimit int
+		exp       int
+	}{
+		{name: "fixed", readLimit: 500, exp: 500},
+		{name: "fixed without read limit", exp: 0},
+		{name: "auto", sizing: model.BatchSize{TargetDuration: time.Second}, readLimit: 500, exp: 500},
+		{name: "auto without read limit", sizing: model.BatchSize{TargetDuration: time.Second}, exp: 1000},
+		{name: "auto below bounds", sizing: model.BatchSize{TargetDuration: time.Second, MinRows: 1000}, readLimit: 500, exp: 1000},
+		{name: "auto above bounds", sizing: model.BatchSize{TargetDuration: time.Second, MaxRows: 200}, readLimit: 500, exp: 200},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New(model.Throttle{}, c.sizing, nil).Pacer(model.Table{Name: "person"}, nil)
+			assert.Equal(t, c.exp, p.Limit(c.readLimit))
+		})
+	}
+}
+
+func TestPacerResize(t *testing.T) {
+	cases := []struct {
+		name    string
+		sizing  model.BatchSize
+		rows    int
+		bytes   int
+		latency time.Duration
+		exp     int
+	}{
+		{name: "on target duration", sizing: model.BatchSize{TargetDuration: time.Second}, rows: 1000, latency: time.Second, exp: 1000},
+		{name: "faster than target duration", sizing: model.BatchSize{TargetDuration: time.Second}, rows: 1000, latency: 800 * time.Millisecond, exp: 1250},
+		{name: "slower than target duration", sizing: model.BatchSize{TargetDuration: time.Second}, rows: 1000, latency: 1250 * time.Millisecond, exp: 800},
+		{name: "grows at most double", sizing: model.BatchSize{TargetDuration: time.Second}, rows: 1000, latency: time.Millisecond, exp: 2000},
+		{name: "shrinks at most half", sizing: model.BatchSize{TargetDuration: time.Second}, rows: 1000, latency: time.Minute, exp: 500},
+		{name: "smaller than target bytes", sizing: model.BatchSize{TargetBytes: 200000}, rows: 1000, bytes: 100000, exp: 2000},
+		{name: "larger than target bytes", sizing: model.BatchSize{TargetBytes: 100000}, rows: 1000, bytes: 125000, exp: 800},
+		{name: "favours smaller target", sizing: model.BatchSize{TargetDuration: time.Second, TargetBytes: 100000}, rows: 1000, bytes: 125000, latency: 500 * time.Millisecond, exp: 800},
+		{name: "within bounds", sizing: model.BatchSize{TargetDuration: time.Second, MaxRows: 1500}, rows: 1000, latency: 500 * time.Millisecond, exp: 1500},
+		{name: "fixed", rows: 1000, latency: time.Minute, exp: 1000},
+		{name: "empty batch", sizing: model.BatchSize{TargetDuration: time.Second}, latency: time.Minute, exp: 1000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New(model.Throttle{}, c.sizing, nil).Pacer(model.Table{Name: "person"}, nil)
+			p.limit = 1000
+
+			p.Observe(c.rows, c.bytes, 0, c.latency)
+			assert.Equal(t, c.exp, p.limit)
+		})
+	}
+}
+
+func TestPacerResizeAtRuntime(t *testing.T) {
+	c := New(model.Throttle{}, model.BatchSize{}, nil)
+	p := c.Pacer(model.Table{Name: "person"}, nil)
+	assert.Equal(t, 100, p.Limit(100))
+
+	c.Set(model.Throttle{}, model.BatchSize{TargetDuration: time.Second})
+	assert.Equal(t, 100, p.Limit(100))
+
+	p.Observe(100, 0, 0, 500*time.Millisecond)
+	assert.Equal(t, 200, p.Limit(100))
+
+	c.Set(model.Throttle{}, model.BatchSize{})
+	assert.Equal(t, 100, p.Limit(100))
+}
+
+func TestPacerNext(t *testing.T) {
+	cases := []struct {
+		name      string
+		settings  model.Throttle
+		readDelay time.Duration
+		delay     time.Duration
+		rows      int
+		exp       time.Duration
+	}{
+		{name: "unthrottled", rows: 100, exp: 0},
+		{name: "read delay", readDelay: time.Second, rows: 100, exp: time.Second},
+		{name: "adaptive delay", readDelay: time.Second, delay: 2 * time.Second, rows: 100, exp: 2 * time.Second},
+		{name: "rows per second", settings: model.Throttle{RowsPerSecond: 10}, rows: 100, exp: 10 * time.Second},
+		{name: "rows per second under read delay", settings: model.Throttle{RowsPerSecond: 1000}, readDelay: time.Second, rows: 100, exp: time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New(c.settings, model.BatchSize{}, nil).Pacer(model.Table{Name: "person", ReadDelay: c.readDelay}, nil)
+			p.delay = c.delay
+
+			// The rows per second cap counts the time since the batch
+			// started, so allow for the time taken to run the test.
+			assert.InDelta(t, c.exp, p.next(c.rows), float64(100*time.Millisecond))
+		})
+	}
+}
+
+func TestPacerWait(t *testing.T) {
+	p := New(model.Throttle{RowsPerSecond: 1000}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person"}, nil)
+
+	start := time.Now()
+	assert.Nil(t, p.Wait(context.Background(), 50))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, p.Wait(ctx, 1000))
+}
+
+func TestPacerPressure(t *testing.T) {
+	var calls int
+	pressure := func(context.Context) (bool, error) {
+		calls++
+		return true, nil
+	}
+
+	c := New(model.Throttle{AdmissionControl: true}, model.BatchSize{}, pressure)
+	p := c.Pacer(model.Table{Name: "person"}, nil)
+
+	assert.Nil(t, p.Wait(context.Background(), 1))
+	p.Observe(0, 0, 0, 0)
+	assert.Equal(t, backoffStep, p.Delay())
+
+	// Pressure is only checked periodically.
+	p.checkPressure(context.Background())
+	assert.Equal(t, 1, calls)
+
+	// Pressure is ignored once admission control is turned off.
+	c.Set(model.Throttle{}, model.BatchSize{})
+	p.Observe(0, 0, 0, 0)
+	assert.Equal(t, time.Duration(0), p.Delay())
+}
+
+func TestPacerPressureError(t *testing.T) {
+	pressure := func(context.Context) (bool, error) {
+		return false, fmt.Errorf("oh no")
+	}
+
+	p := New(model.Throttle{AdmissionControl: true}, model.BatchSize{}, pressure).Pacer(model.Table{Name: "person"}, nil)
+
+	p.checkPressure(context.Background())
+	p.Observe(0, 0, 0, 0)
+	assert.Equal(t, time.Duration(0), p.Delay())
+}
+
+func TestNilPacer(t *testing.T) {
+	var c *Controller
+	p := c.Pacer(model.Table{Name: "person", ReadDelay: time.Hour}, nil)
+
+	assert.NotPanics(t, func() {
+		assert.Nil(t, p.Wait(context.Background(), 1))
+		p.Observe(0, 0, time.Hour, time.Hour)
+	})
+}
+
+func TestPacerOpen(t *testing.T) {
+	always, err := schedule.NewWindow("* * * * *", time.Hour, "")
+	assert.Nil(t, err)
+
+	never, err := schedule.NewWindow("0 0 30 2 *", time.Hour, "")
+	assert.Nil(t, err)
+
+	// Opens at the start of next year, so it's closed for the test.
+	later, err := schedule.NewWindow("0 0 1 1 *", time.Minute, "")
+	assert.Nil(t, err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name    string
+		ctx     context.Context
+		windows []schedule.Window
+		expErr  error
+	}{
+		{name: "no windows", ctx: context.Background()},
+		{name: "open", ctx: context.Background(), windows: []schedule.Window{later, always}},
+		{name: "never opens", ctx: context.Background(), windows: []schedule.Window{never}, expErr: fmt.Errorf("no maintenance window opens in the next five years")},
+		{name: "cancelled while closed", ctx: cancelled, windows: []schedule.Window{later}, expErr: context.Canceled},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := New(model.Throttle{}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person"}, c.windows)
+			assert.Equal(t, c.expErr, p.Open(c.ctx))
+		})
+	}
+}
+
+func TestPacerPause(t *testing.T) {
+	p := New(model.Throttle{}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person"}, nil)
+
+	p.Pause()
+	assert.True(t, p.Paused())
+
+	opened := make(chan error)
+	go func() {
+		opened <- p.Open(context.Background())
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("expected paused table to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.Resume()
+	assert.False(t, p.Paused())
+	assert.Nil(t, <-opened)
+
+	// Paused tables still stop waiting if they're cancelled.
+	p.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, p.Open(ctx))
+}
+
+func TestPacerPauseOutsideWindows(t *testing.T) {
+	later, err := schedule.NewWindow("0 0 1 1 *", time.Minute, "")
+	assert.Nil(t, err)
+
+	p := New(model.Throttle{}, model.BatchSize{}, nil).Pacer(model.Table{Name: "person"}, []schedule.Window{later})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opened := make(chan error)
+	go func() {
+		opened <- p.Open(ctx)
+	}()
+
+	assert.Eventually(t, p.Closed, time.Second, 10*time.Millisecond)
+
+	// Pausing a table that's waiting for a window wakes it up, so it waits
+	// to be resumed instead.
+	p.Pause()
+	assert.Eventually(t, func() bool { return !p.Closed() }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-opened)
+}
+
+func TestPacerOverrides(t *testing.T) {
+	c := New(model.Throttle{}, model.BatchSize{}, nil)
+	p := c.Pacer(model.Table{Name: "person", ReadLimit: 100, ReadDelay: time.Second}, nil)
+
+	p.SetReadLimit(500)
+	assert.Equal(t, 500, p.Limit(100))
+	assert.Equal(t, 500, p.ReadLimit(100))
+
+	p.SetReadDelay(2 * time.Second)
+	assert.Equal(t, 2*time.Second, p.ReadDelay())
+	assert.Equal(t, 2*time.Second, p.next(0))
+
+	// Auto sizing starts again from the new limit.
+	c.Set(model.Throttle{}, model.BatchSize{TargetDuration: time.Second})
+	assert.Equal(t, 500, p.Limit(100))
+
+	p.Observe(500, 0, 0, 500*time.Millisecond)
+	assert.Equal(t, 1000, p.Limit(100))
+
+	p.SetReadLimit(200)
+	assert.Equal(t, 200, p.Limit(100))
+
+	// A limit of zero restores the configured one.
+	p.SetReadLimit(0)
+	assert.Equal(t, 100, p.Limit(100))
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const (
+	// ExporterNone disables tracing.
+	ExporterNone = "none"
+
+	// ExporterOTLP exports spans over OTLP/HTTP, configured using the standard
+	// OTEL_EXPORTER_OTLP_* environment variables.
+	ExporterOTLP = "otlp"
+
+	// ExporterFile writes spans as JSON to a local file.
+	ExporterFile = "file"
+)
+
+// Setup installs a global tracer provider that sends spans to the given
+// exporter. The returned function flushes any remaining spans and must be
+// called before the process exits.
+func Setup(ctx context.Context, exporter, path, version string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var closer io.Closer
+
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterOTLP:
+		var err error
+		if exp, err = otlptracehttp.New(ctx); err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+
+	case ExporterFile:
+		if path == "" {
+			return nil, fmt.Errorf("missing trace file for %s exporter", ExporterFile)
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating trace file: %w", err)
+		}
+		closer = f
+
+		if exp, err = stdouttrace.New(stdouttrace.WithWriter(f)); err != nil {
+			return nil, fmt.Errorf("creating file exporter: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid trace exporter: %q", exporter)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName("ds"),
+		semconv.ServiceVersion(version),
+	)
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		if err := tp.Shutdown(ctx); err != nil {
+			return fmt.Errorf("shutting down tracer provider: %w", err)
+		}
+
+		if closer != nil {
+			return closer.Close()
+		}
+		return nil
+	}, nil
+}
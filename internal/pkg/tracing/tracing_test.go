@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	cases := []struct {
+		name     string
+		exporter string
+		path     string
+		expErr   error
+	}{
+		{name: "none", exporter: ExporterNone},
+		{name: "default", exporter: ""},
+		{name: "file without path", exporter: ExporterFile, expErr: fmt.Errorf("missing trace file for file exporter")},
+		{name: "invalid", exporter: "zipkin", expErr: fmt.Errorf(`invalid trace exporter: "zipkin"`)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), c.exporter, c.path, "test")
+			assert.Equal(t, c.expErr, err)
+			if err != nil {
+				return
+			}
+
+			assert.Nil(t, shutdown(context.Background()))
+		})
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+
+	shutdown, err := Setup(context.Background(), ExporterFile, path, "test")
+	assert.Nil(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "insert")
+	span.End()
+
+	assert.Nil(t, shutdown(context.Background()))
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"Name":"insert"`)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"ds/internal/pkg/model"
+	"ds/internal/pkg/repo"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func validateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "validate [insert|update|apply]",
+		Short:     "Check the config for mistakes, without connecting to either database",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"insert", "update", "apply"},
+		RunE:      runValidate,
+	}
+}
+
+func planCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "plan [insert|update|apply]",
+		Short:     "Check each table against both databases and show what a run would do, without writing anything",
+		Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"insert", "update", "apply"},
+		RunE:      runPlan,
+	}
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	command := planCommand(config, args)
+	if err = validateConfig(config, command); err != nil {
+		problems := strings.Split(err.Error(), "\n")
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("config has %d problem(s) for %s", len(problems), command)
+	}
+
+	fmt.Printf("config is valid for %s\n", command)
+	return nil
+}
+
+// runPlan connects to the source and target, checks each table and prints
+// the statements it would run, without creating the state store or writing
+// to either database. Every table is checked, even if an earlier one fails.
+func runPlan(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	command := planCommand(config, args)
+	if err = checkConfig(config, command); err != nil {
+		return err
+	}
+
+	src, targetDB, disconnect, err := connect(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	if config, err = expandTables(ctx, config, command, src, targetDB); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sourceTable := range config.Source.Tables {
+		targetTable, err := config.Target.GetTargetTable(sourceTable)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var plan repo.Plan
+		if command == "apply" {
+			plan, err = repo.PlanApply(ctx, config.Source, targetDB, sourceTable, targetTable)
+		} else {
+			plan, err = repo.PlanTable(ctx, src, config.Target, targetDB, sourceTable, targetTable, command == "update")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s -> %s: %w", command, sourceTable.Name, targetTable.Name, err))
+			continue
+		}
+
+		// Automatically sized batches vary in size, so there's no telling
+		// how many there'll be.
+		if command != "apply" && config.BatchSize.Auto() {
+			plan.Batches = 0
+		}
+
+		if err = printPlan(sourceTable, targetTable, plan); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// planCommand returns the command to validate or plan the config for,
+// defaulting to apply for SQL sources and insert otherwise.
+func planCommand(config model.Config, args []string) string {
+	switch {
+	case len(args) == 1:
+		return args[0]
+	case config.Source.Driver == model.DriverSQL:
+		return "apply"
+	default:
+		return "insert"
+	}
+}
+
+func printPlan(sourceTable, targetTable model.Table, plan repo.Plan) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s -> %s\n", sourceTable.Name, targetTable.Name)
+
+	for _, read := range plan.Reads {
+		fmt.Fprintf(w, "  read:\t%s\n", read)
+	}
+	for _, stmt := range plan.Statements {
+		// Show each statement on one line.
+		fmt.Fprintf(w, "  write:\t%s\n", strings.Join(strings.Fields(stmt), " "))
+	}
+	for _, f := range plan.Files {
+		fmt.Fprintf(w, "  file:\t%s\n", f)
+	}
+
+	rows, batches := "unknown", "unknown"
+	if plan.Rows > 0 {
+		rows = fmt.Sprint(plan.Rows)
+	}
+	if plan.Batches > 0 {
+		batches = fmt.Sprint(plan.Batches)
+	}
+	fmt.Fprintf(w, "  rows:\t%s\n", rows)
+	fmt.Fprintf(w, "  batches:\t%s\n", batches)
+	fmt.Fprintln(w)
+
+	return w.Flush()
+}
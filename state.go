@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"ds/internal/pkg/checkpoint"
+	"ds/internal/pkg/model"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+func stateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect and manage the offsets of each table",
+	}
+
+	resetCmd := &cobra.Command{
+		Use:   "reset [table...]",
+		Short: "Reset the offset of the given tables (or all tables) to zero",
+		RunE:  runStateReset,
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <table> <offset>",
+		Short: "Set the offset of a table, so the next run resumes from there",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runStateSet,
+	}
+
+	for _, c := range []*cobra.Command{resetCmd, setCmd} {
+		c.Flags().BoolVar(&forceUnlock, "force-unlock", false, "release locks held by runs of the job before changing its state")
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "show [table...]",
+			Short: "Show the offset and status of each table",
+			RunE:  runStateShow,
+		},
+		resetCmd,
+		setCmd,
+	)
+
+	return cmd
+}
+
+func runStateShow(cmd *cobra.Command, args []string) error {
+	return withState(cmd.Context(), false, nil, func(ctx context.Context, store checkpoint.Store) error {
+		states, err := store.List(ctx, args...)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tOFFSET\tSTATUS\tUPDATED")
+		for _, s := range states {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", s.Table, s.Offset, s.Status, s.UpdatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	})
+}
+
+func runStateReset(cmd *cobra.Command, args []string) error {
+	return withState(cmd.Context(), true, args, func(ctx context.Context, store checkpoint.Store) error {
+		return store.Reset(ctx, args...)
+	})
+}
+
+func runStateSet(cmd *cobra.Command, args []string) error {
+	offset, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("parsing offset: %w", err)
+	}
+
+	return withState(cmd.Context(), true, args[:1], func(ctx context.Context, store checkpoint.Store) error {
+		return store.Set(ctx, args[0], offset)
+	})
+}
+
+// withState opens the configured state store, ensures it's initialised for
+// the job's tables, expanded as they are for a run, and then runs the given
+// function against the job's state. If exclusive, the given tables, or all of
+// the job's tables if none are given, are locked first, so their state can't
+// be changed under a run that's shifting them.
+func withState(ctx context.Context, exclusive bool, tables []string, fn func(context.Context, checkpoint.Store) error) (err error) {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	src, targetDB, disconnect, err := connect(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	if config, err = expandTables(ctx, config, planCommand(config, nil), src, targetDB); err != nil {
+		return err
+	}
+
+	store, err := checkpoint.New(ctx, config, targetDB)
+	if err != nil {
+		return fmt.Errorf("creating state store: %w", err)
+	}
+	defer store.Close()
+
+	if exclusive {
+		if len(tables) == 0 {
+			tables = lo.Map(config.Source.Tables, func(t model.Table, _ int) string {
+				return t.Name
+			})
+		}
+
+		if forceUnlock {
+			slog.Warn("forcing unlock", "tables", tables)
+			if err = store.ForceUnlock(ctx, tables...); err != nil {
+				return fmt.Errorf("unlocking tables: %w", err)
+			}
+		}
+
+		var lease *checkpoint.Lease
+		ctx, lease, err = checkpoint.Acquire(ctx, store, runID, config.State.LockDuration(), tables...)
+		if err != nil {
+			return fmt.Errorf("locking tables: %w", err)
+		}
+		defer func() {
+			if releaseErr := lease.Release(context.WithoutCancel(ctx)); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}()
+	}
+
+	if err = store.Ensure(ctx, config.Source, false); err != nil {
+		return fmt.Errorf("ensuring state table: %w", err)
+	}
+
+	return fn(ctx, store)
+}